@@ -2,10 +2,16 @@ package app
 
 import (
 	"context"
+	"errors"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/anacrolix/torrent"
+	"github.com/quintans/torflix/internal/lib/bandwidth"
 	"github.com/quintans/torflix/internal/lib/extractor"
+	"github.com/quintans/torflix/internal/lib/probe"
+	"github.com/quintans/torflix/internal/lib/stall"
 	"github.com/quintans/torflix/internal/model"
 )
 
@@ -30,6 +36,18 @@ const (
 	StatusReadyForPlayback
 )
 
+// FilePriority is the download priority of a file of the torrent, chosen by the user
+type FilePriority string
+
+const (
+	FilePrioritySkip   FilePriority = "skip"
+	FilePriorityNormal FilePriority = "normal"
+	FilePriorityHigh   FilePriority = "high"
+	FilePriorityNow    FilePriority = "now"
+)
+
+var FilePriorities = []FilePriority{FilePrioritySkip, FilePriorityNormal, FilePriorityHigh, FilePriorityNow}
+
 type Stats struct {
 	Stream         string
 	Status         Status
@@ -41,6 +59,10 @@ type Stats struct {
 	Done           bool
 	Pieces         []bool
 	PiecesComplete int // in percentage
+	// ReadyIn is the time until the file can be played through without stalling, negative if unknown
+	ReadyIn time.Duration
+	// Stall is the recovery action taken in this update, if the download stopped making progress
+	Stall stall.Action
 }
 
 type TorrentClient interface {
@@ -51,31 +73,203 @@ type TorrentClient interface {
 	GetFilteredFiles() []*torrent.File
 	GetName() string
 	Play(file *torrent.File)
+	// Probe reads the headers of a media file, downloading the pieces they are in
+	Probe(ctx context.Context, file *torrent.File) (probe.Info, error)
+	// NewReader opens a file of the torrent, whose reads wait for the pieces until the context is done
+	NewReader(ctx context.Context, file *torrent.File) (io.ReadSeekCloser, error)
+	// MovieHash computes the OpenSubtitles hash of the file, downloading its first and last chunks
+	MovieHash(ctx context.Context, file *torrent.File) (string, error)
+	// Completed returns the bytes of the file that are downloaded contiguously from its start
+	Completed(file *torrent.File) int64
+	// BufferedFrom returns the bytes of the file that are downloaded contiguously from the offset
+	BufferedFrom(file *torrent.File, offset int64) int64
+	// SetMediaDuration sets the duration of the media being played, used to estimate its bitrate
+	SetMediaDuration(duration time.Duration)
 	PauseTorrent()
+	ResumeTorrent()
+	// AnnounceToDHT asks the DHT for more peers
+	AnnounceToDHT()
+	AddTrackers(trackers []string)
+	SetMaxConnections(max int)
+	Recheck()
+	MetaInfo() TorrentInfo
+	// FilePriorities returns the priority of every file, by path
+	FilePriorities() map[string]FilePriority
+	SetFilePriority(file *torrent.File, priority FilePriority) error
+	SetLimits(limits bandwidth.Limits)
+	Transfer() Transfer
+	// ObserveRate sets the smoothed download rate, in bytes per second, used to estimate the playback readiness
+	ObserveRate(bytesPerSec float64)
+	StopSeeding()
+	Peers() []PeerInfo
+	// BlockedPeers returns the number of unique peer addresses refused by the IP blocklist of the torrent
+	BlockedPeers() int64
+}
+
+// PeerInfo describes a connected peer
+type PeerInfo struct {
+	Address string
+	Client  string
+	// Flags are the source of the peer (Tr: tracker, I: incoming, Hg/Ha: DHT, X: PEX, M: magnet, C: holepunch),
+	// followed by E if it prefers encryption and F if it supports the fast extension
+	Flags        string
+	Progress     float64 // percentage of the pieces the peer has
+	DownloadRate int64   // bytes per second
+	UploadRate   int64   // bytes per second
+	Connection   string
+}
+
+// Transfer holds the bytes transferred by a torrent since the client started
+type Transfer struct {
+	InfoHash string
+	// Started identifies the client session, since the counters restart with every session
+	Started    time.Time
+	Uploaded   int64
+	Downloaded int64
+	// Seeding is true when there is nothing left to download and uploading is allowed
+	Seeding bool
 }
 
-// VideoPlayer opens a stream URL in a video player.
+// TorrentInfo holds the torrent metadata that is available before any piece is downloaded.
+type TorrentInfo struct {
+	Name         string
+	InfoHash     string
+	Size         int64
+	PieceLength  int64
+	NumPieces    int
+	CreationDate time.Time
+	CreatedBy    string
+	Comment      string
+	Trackers     []string
+	Private      bool
+	Files        []TorrentFileInfo
+}
+
+type TorrentFileInfo struct {
+	Path string
+	Size int64
+}
+
+// VideoPlayer opens a stream URL in a video player, with the URLs of its subtitles, starting at the position.
 type VideoPlayer interface {
-	Open(ctx context.Context, player model.Player, url string, subtitlesDir string) error
+	Open(ctx context.Context, player model.Player, url string, subtitles []string, start time.Duration) (Playback, error)
+}
+
+// Playback is a running video player
+type Playback interface {
+	// Wait blocks until the player is closed
+	Wait() error
+}
+
+// PlaybackControl is a playback that can be controlled, eg: mpv through its JSON IPC
+type PlaybackControl interface {
+	Playback
+	Status(ctx context.Context) (PlaybackStatus, error)
+	SetPause(ctx context.Context, paused bool) error
+	// Seek moves the position by the offset
+	Seek(ctx context.Context, offset time.Duration) error
+	// AddSubtitle loads a subtitle file or URL, selecting it
+	AddSubtitle(ctx context.Context, url string) error
 }
 
-type SubtitlesClient interface {
-	Login() (string, error)
-	Logout(token string) error
-	Search(query string, season, episode int, languages []string) ([]SubtitleAttributes, error)
-	Download(token string, fileID int) (DownloadResponse, error)
+type PlaybackStatus struct {
+	Position time.Duration
+	// Duration is zero until the player knows it
+	Duration time.Duration
+	Paused   bool
+	// CacheAhead is the media the player has buffered ahead of the position, zero if unknown
+	CacheAhead time.Duration
+	// PausedForCache is set while the player waits for its buffer to fill
+	PausedForCache bool
+	// Starved is set when the playback was paused because the download fell behind
+	Starved bool
 }
 
-type SubtitleAttributes struct {
+// SubtitleProvider is a source of subtitles.
+// Providers holding a session may implement io.Closer, to end it after the subtitles are downloaded.
+type SubtitleProvider interface {
+	// Name identifies the provider in the settings
+	Name() string
+	Search(ctx context.Context, query SubtitleQuery) ([]Subtitle, error)
+	// Download returns the content of a subtitle found by the provider
+	Download(ctx context.Context, sub Subtitle) ([]byte, error)
+}
+
+// ErrSubtitleQuotaExhausted is returned by the providers that refuse downloads until the quota resets
+var ErrSubtitleQuotaExhausted = errors.New("subtitle download quota exhausted")
+
+// SubtitleQuotaProvider is implemented by the subtitle providers that limit the downloads
+type SubtitleQuotaProvider interface {
+	SubtitleProvider
+	// Quota returns the quota known from the last downloads, or asks the provider for it if refresh is set
+	Quota(ctx context.Context, refresh bool) (SubtitleQuota, error)
+}
+
+// SubtitleHashProvider is implemented by the subtitle providers that match the subtitles by the movie hash of the file
+type SubtitleHashProvider interface {
+	SubtitleProvider
+	// UsesMovieHash tells if the searches use the movie hash, that takes a while to compute
+	UsesMovieHash() bool
+}
+
+// SubtitleQuota is the number of downloads allowed until the quota resets
+type SubtitleQuota struct {
+	// Allowed is zero if the quota is unknown
+	Allowed   int
+	Remaining int
+	// ResetAt is zero if unknown
+	ResetAt time.Time
+}
+
+// Exhausted tells if no more downloads are allowed at the time
+func (q SubtitleQuota) Exhausted(now time.Time) bool {
+	return q.Allowed > 0 && q.Remaining <= 0 && (q.ResetAt.IsZero() || now.Before(q.ResetAt))
+}
+
+// SubtitleQuery describes the media to find subtitles for
+type SubtitleQuery struct {
+	File *torrent.File
+	// Query is the media name without the release details, eg: the lord of the rings
+	Query     string
+	Season    int
+	Episode   int
+	Languages []string
+	// Hash is the OpenSubtitles movie hash of the file, empty if unknown
+	Hash string
+}
+
+// SubtitleRequest is a media file of the torrent to download subtitles for
+type SubtitleRequest struct {
+	File *torrent.File
+	// MediaName names the subtitles directory of the media
+	MediaName string
+	// Query is the media name without the release details
+	Query   string
+	Season  int
+	Episode int
+}
+
+// Subtitle is a subtitle found by a provider
+type Subtitle struct {
+	Provider string
+	// ID identifies the subtitle in the provider
 	ID       string
 	Language string
-	FileID   int
 	Filename string
-}
-
-type DownloadResponse struct {
-	Link     string `json:"link"`
-	Filename string `json:"file_name"`
+	// HashMatch is set when the subtitle was made for the file, by matching its hash
+	HashMatch bool
+	// Release is the release name the subtitle was made for, if known
+	Release   string
+	Downloads int
+	// Rating is from 0 to 10, zero if not rated
+	Rating            float64
+	HearingImpaired   bool
+	FPS               float64
+	Trusted           bool
+	AITranslated      bool
+	MachineTranslated bool
+	// Live is set for subtitles that grow as the file downloads, so they are written while serving the file
+	Live bool
 }
 
 type Extractor interface {
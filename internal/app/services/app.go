@@ -3,6 +3,8 @@ package services
 import (
 	"github.com/quintans/faults"
 	"github.com/quintans/torflix/internal/app"
+	"github.com/quintans/torflix/internal/lib/netbind"
+	"github.com/quintans/torflix/internal/lib/proxy"
 	"github.com/quintans/torflix/internal/model"
 )
 
@@ -60,13 +62,65 @@ func (a *App) SetOpenSubtitles(username, password string) error {
 		return faults.Errorf("Failed to set open subtitles password: %w", err)
 	}
 
+	err = a.repo.UpdateSettings(func(settings *model.Settings) {
+		settings.OpenSubtitles.Username = username
+	})
+	if err != nil {
+		return faults.Errorf("Failed to save settings: %w", err)
+	}
+
+	return nil
+}
+
+func (a *App) Proxy() (proxy.Config, error) {
 	settings, err := a.repo.LoadSettings()
 	if err != nil {
-		return faults.Errorf("Failed to load settings: %w", err)
+		return proxy.Config{}, faults.Errorf("Failed to load settings: %w", err)
+	}
+
+	return settings.Proxy(), nil
+}
+
+func (a *App) BindInterface() (string, error) {
+	settings, err := a.repo.LoadSettings()
+	if err != nil {
+		return "", faults.Errorf("Failed to load settings: %w", err)
+	}
+
+	return settings.BindInterface(), nil
+}
+
+// SetBindInterface saves the interface, or IP, that the torrents are bound to.
+// Torrents already running keep the address they were started with.
+func (a *App) SetBindInterface(bind string) error {
+	if bind != "" {
+		_, err := netbind.Resolve(bind)
+		if err != nil {
+			return faults.Errorf("Invalid network interface: %w", err)
+		}
+	}
+
+	err := a.repo.UpdateSettings(func(settings *model.Settings) {
+		settings.SetBindInterface(bind)
+	})
+	if err != nil {
+		return faults.Errorf("Failed to save settings: %w", err)
 	}
 
-	settings.OpenSubtitles.Username = username
-	err = a.repo.SaveSettings(settings)
+	return nil
+}
+
+// SetProxy saves and applies the proxy configuration.
+// Torrents already running keep the proxy they were started with.
+func (a *App) SetProxy(cfg proxy.Config) error {
+	err := proxy.Set(cfg)
+	if err != nil {
+		return faults.Errorf("Invalid proxy: %w", err)
+	}
+
+	err = a.repo.UpdateSettings(func(settings *model.Settings) {
+		settings.SetProxy(cfg)
+	})
 	if err != nil {
 		return faults.Errorf("Failed to save settings: %w", err)
 	}
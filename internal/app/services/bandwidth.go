@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/quintans/faults"
+	"github.com/quintans/torflix/internal/lib/bandwidth"
+	"github.com/quintans/torflix/internal/model"
+)
+
+// Bandwidth decides the transfer limits in effect, following the schedule in the settings or the turbo mode,
+// and applies them whenever they change.
+type Bandwidth struct {
+	repo  Repository
+	apply func(bandwidth.Limits)
+
+	mu      sync.Mutex
+	turbo   bool
+	current *bandwidth.Limits
+}
+
+func NewBandwidth(repo Repository, apply func(bandwidth.Limits)) *Bandwidth {
+	return &Bandwidth{
+		repo:  repo,
+		apply: apply,
+	}
+}
+
+// Run re-evaluates the schedule every minute until the context is done
+func (b *Bandwidth) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		err := b.update()
+		if err != nil {
+			slog.Error("Failed to update bandwidth limits", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *Bandwidth) Limits() bandwidth.Limits {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.current == nil {
+		return bandwidth.Limits{}
+	}
+	return *b.current
+}
+
+func (b *Bandwidth) Turbo() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.turbo
+}
+
+// SetTurbo switches to the alternative limits, ignoring the schedule
+func (b *Bandwidth) SetTurbo(turbo bool) error {
+	b.mu.Lock()
+	b.turbo = turbo
+	b.mu.Unlock()
+
+	return b.update()
+}
+
+// Rates returns the download and upload limits, in bytes per second, used outside of the scheduled windows
+func (b *Bandwidth) Rates() (int, int, error) {
+	settings, err := b.repo.LoadSettings()
+	if err != nil {
+		return 0, 0, faults.Errorf("loading settings: %w", err)
+	}
+
+	return settings.DownloadRate(), settings.UploadRate(), nil
+}
+
+func (b *Bandwidth) SetRates(download, upload int) error {
+	err := b.repo.UpdateSettings(func(settings *model.Settings) {
+		settings.SetDownloadRate(download)
+		settings.SetUploadRate(upload)
+	})
+	if err != nil {
+		return faults.Errorf("saving settings: %w", err)
+	}
+
+	return b.update()
+}
+
+func (b *Bandwidth) update() error {
+	settings, err := b.repo.LoadSettings()
+	if err != nil {
+		return faults.Errorf("loading settings: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bw := settings.Bandwidth()
+	var limits bandwidth.Limits
+	if b.turbo {
+		limits = bandwidth.Limits{Download: bw.AltDownloadRate, Upload: bw.AltUploadRate}
+	} else {
+		base := bandwidth.Limits{Download: settings.DownloadRate(), Upload: settings.UploadRate()}
+		limits, err = bandwidth.Current(base, bw.Schedule, time.Now())
+		if err != nil {
+			// an invalid schedule should not stop the transfers
+			limits = base
+			err = faults.Errorf("evaluating bandwidth schedule: %w", err)
+		}
+	}
+
+	if b.current == nil || *b.current != limits {
+		b.current = &limits
+		b.apply(limits)
+	}
+
+	return err
+}
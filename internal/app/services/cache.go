@@ -2,6 +2,7 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -119,6 +120,12 @@ func (a *Cache) Delete(data *model.CacheData) error {
 		return faults.Errorf("Failed to delete torrent file %s: %w", torrentPath, err)
 	}
 
+	resumePath := filepath.Join(a.torrentsDir, strings.ToUpper(data.Hash)+".resume.json")
+	err = os.Remove(resumePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return faults.Errorf("Failed to delete resume file %s: %w", resumePath, err)
+	}
+
 	if data.FolderName != "" {
 		mediaPath := filepath.Join(a.mediaDir, data.FolderName)
 		err = os.RemoveAll(mediaPath)
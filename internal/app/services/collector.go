@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/quintans/faults"
+	"github.com/quintans/torflix/internal/lib/transfer"
+	"github.com/quintans/torflix/internal/model"
+)
+
+// saveTotalsEvery is how often the lifetime totals are persisted
+const saveTotalsEvery = 30 * time.Second
+
+// Collector samples the transfer of the torrent being downloaded, measuring its rates
+// and keeping the lifetime totals of every torrent.
+type Collector struct {
+	repo     Repository
+	download *Download
+
+	mu      sync.Mutex
+	hash    string
+	started time.Time
+	meter   *transfer.Meter
+	// transfers are the lifetime totals, loaded once and saved from time to time
+	transfers *model.Transfers
+	dirty     bool
+	saved     time.Time
+}
+
+func NewCollector(repo Repository, download *Download) *Collector {
+	return &Collector{
+		repo:     repo,
+		download: download,
+	}
+}
+
+// Run samples the transfer every interval until the context is done
+func (c *Collector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			err := c.tick(now)
+			if err != nil {
+				slog.Error("Failed to collect transfer stats", "error", err)
+			}
+		}
+	}
+}
+
+func (c *Collector) tick(now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tr, ok := c.download.Transfer()
+	if !ok || tr.InfoHash == "" {
+		c.hash = ""
+		c.meter = nil
+		return c.saveLocked(now)
+	}
+
+	// the counters restart with every session
+	if c.meter == nil || c.hash != tr.InfoHash || !c.started.Equal(tr.Started) {
+		c.hash = tr.InfoHash
+		c.started = tr.Started
+		c.meter = transfer.NewMeter(transfer.HistorySize)
+	}
+
+	downloaded, uploaded := c.meter.Add(now, tr.Downloaded, tr.Uploaded)
+	down, _ := c.meter.Rates()
+	c.download.ObserveRate(down)
+
+	if downloaded != 0 || uploaded != 0 {
+		transfers, err := c.totals()
+		if err != nil {
+			return err
+		}
+		transfers.All = transfers.All.Add(downloaded, uploaded)
+		transfers.Torrents[tr.InfoHash] = transfers.Torrents[tr.InfoHash].Add(downloaded, uploaded)
+		c.dirty = true
+	}
+
+	return c.saveLocked(now)
+}
+
+// saveLocked persists the totals if they changed and were not saved recently
+func (c *Collector) saveLocked(now time.Time) error {
+	if !c.dirty || now.Sub(c.saved) < saveTotalsEvery {
+		return nil
+	}
+	return c.flush(now)
+}
+
+// Save persists the totals that were not saved yet
+func (c *Collector) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+	return c.flush(time.Now())
+}
+
+// totals returns the lifetime totals, loading them the first time
+func (c *Collector) totals() (*model.Transfers, error) {
+	if c.transfers == nil {
+		transfers, err := c.repo.LoadTransfers()
+		if err != nil {
+			return nil, faults.Errorf("loading transfers: %w", err)
+		}
+		c.transfers = transfers
+	}
+	return c.transfers, nil
+}
+
+func (c *Collector) flush(now time.Time) error {
+	err := c.repo.SaveTransfers(c.transfers)
+	if err != nil {
+		return faults.Errorf("saving transfers: %w", err)
+	}
+	c.dirty = false
+	c.saved = now
+
+	return nil
+}
+
+// Rates returns the smoothed download and upload rates of the torrent, in bytes per second
+func (c *Collector) Rates(hash string) (float64, float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.meter == nil || c.hash != hash {
+		return 0, 0
+	}
+	return c.meter.Rates()
+}
+
+// History returns the recent rates of the torrent, from the oldest to the newest
+func (c *Collector) History(hash string) []transfer.Sample {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.meter == nil || c.hash != hash {
+		return nil
+	}
+	return c.meter.History()
+}
+
+// Totals returns the lifetime totals of the torrent and of all torrents
+func (c *Collector) Totals(hash string) (model.TransferTotals, model.TransferTotals, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	transfers, err := c.totals()
+	if err != nil {
+		return model.TransferTotals{}, model.TransferTotals{}, err
+	}
+	return transfers.Torrents[hash], transfers.All, nil
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -13,63 +14,271 @@ import (
 	gslices "slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/anacrolix/torrent"
 	"github.com/quintans/faults"
 	"github.com/quintans/torflix/internal/app"
-	"github.com/quintans/torflix/internal/lib/fails"
-	"github.com/quintans/torflix/internal/lib/https"
-	"github.com/quintans/torflix/internal/lib/retry"
+	"github.com/quintans/torflix/internal/lib/bandwidth"
+	"github.com/quintans/torflix/internal/lib/lang"
+	"github.com/quintans/torflix/internal/lib/probe"
+	"github.com/quintans/torflix/internal/lib/safety"
+	"github.com/quintans/torflix/internal/lib/stall"
+	"github.com/quintans/torflix/internal/lib/subrank"
+	"github.com/quintans/torflix/internal/model"
 	"github.com/quintans/torflix/internal/viewmodel"
 )
 
-const localhost = "http://localhost:%d/%s"
-
-type (
-	TorrentClientFactory       func(string) (app.TorrentClient, error)
-	OpenSubtitlesClientFactory func(usr, pwd string) app.SubtitlesClient
+const (
+	localhost = "http://localhost:%d/%s"
+	// probeTimeout is how long to wait for the pieces with the headers of a media file
+	probeTimeout = 2 * time.Minute
+	// movieHashTimeout is how long to wait for the first and last chunks of a file, to match subtitles by hash
+	movieHashTimeout = time.Minute
 )
 
-type Download struct {
-	repo                   Repository
-	client                 app.TorrentClient
-	torCliFact             TorrentClientFactory
-	videoPlayer            app.VideoPlayer
-	subtitlesClientFactory OpenSubtitlesClientFactory
-	torrentsDir            string
-	subtitlesRootDir       string
+// maxSubtitles is the number of subtitles downloaded for a media file
+const maxSubtitles = 10
 
-	secrets app.Secrets
+type TorrentClientFactory func(string) (app.TorrentClient, error)
+
+type Download struct {
+	repo             Repository
+	client           app.TorrentClient
+	torCliFact       TorrentClientFactory
+	videoPlayer      app.VideoPlayer
+	torrentsDir      string
+	subtitlesRootDir string
+	// providers are in the order their subtitles are preferred, for the same language
+	providers []app.SubtitleProvider
+	// fetched holds the content of the subtitles downloaded for the current torrent, so a preview is not downloaded again
+	fetched map[string][]byte
+	// prefetchCtx is cancelled when the torrent, whose subtitles are being prefetched, is closed
+	prefetchCtx    context.Context
+	prefetchCancel context.CancelFunc
+	// prefetching holds the media waiting for their subtitles to be prefetched
+	prefetching map[string]bool
+	// prefetchQueue holds the media to be prefetched by the worker, woken up by prefetchWake
+	prefetchQueue []app.SubtitleRequest
+	prefetchWake  chan struct{}
+	// extractions are the extractions of the embedded subtitles of the files of the torrent, by path
+	extractMu   sync.Mutex
+	extractions map[string]*extraction
+
+	// mu guards the client against the bandwidth scheduler and the kill switch
+	mu     sync.Mutex
+	limits bandwidth.Limits
+	// suspended is set while the bound network is unavailable
+	suspended bool
+	// suspendedClient is the client paused by Suspend, to be resumed by Unsuspend
+	suspendedClient app.TorrentClient
+	// staleClient is the client left paused by Release, since it is bound to an address that is gone
+	staleClient app.TorrentClient
+	// served is the file of the torrent served to the player
+	served *torrent.File
+	// servedHash is the info hash of the torrent of the served file
+	servedHash string
+	// servedDuration is the duration of the served file, zero if unknown
+	servedDuration time.Duration
+	// servedRead is the offset of the served file up to where the player read it
+	servedRead int64
+	// launched is the player opened by Play, while it is open
+	launched *launchedPlayer
+	// playback is the player that can be controlled, while it is open
+	playback       app.PlaybackControl
+	playbackMedia  string
+	playbackStatus app.PlaybackStatus
+
+	// historyMu guards the watch history, saved from time to time while playing
+	historyMu    sync.Mutex
+	historyDirty bool
+	historySaved time.Time
 }
 
 func NewDownload(
 	repo Repository,
 	videoPlayer app.VideoPlayer,
 	torCliFact TorrentClientFactory,
-	subtitlesClientFactory OpenSubtitlesClientFactory,
 	torrentsDir string,
 	subtitlesDir string,
-	secrets app.Secrets,
+	providers []app.SubtitleProvider,
 ) *Download {
-	return &Download{
-		repo:                   repo,
-		torCliFact:             torCliFact,
-		videoPlayer:            videoPlayer,
-		subtitlesClientFactory: subtitlesClientFactory,
-		torrentsDir:            torrentsDir,
-		subtitlesRootDir:       subtitlesDir,
-		secrets:                secrets,
+	c := &Download{
+		repo:             repo,
+		torCliFact:       torCliFact,
+		videoPlayer:      videoPlayer,
+		torrentsDir:      torrentsDir,
+		subtitlesRootDir: subtitlesDir,
 	}
+	// the tracks embedded in the file are the best match
+	c.providers = append([]app.SubtitleProvider{&embeddedProvider{download: c}}, providers...)
+	return c
+}
+
+// currentClient returns the client of the current torrent, if any
+func (c *Download) currentClient() app.TorrentClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.client
 }
 
 func (c *Download) Pause() {
-	c.client.PauseTorrent()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// a torrent paused by the user is not resumed when the network comes back
+	c.suspendedClient = nil
+	if c.client != nil {
+		c.client.PauseTorrent()
+	}
+}
+
+// Suspend pauses the torrent until Unsuspend is called, including the torrents played meanwhile
+func (c *Download) Suspend() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.suspended = true
+	c.suspend()
+}
+
+// suspend pauses the torrent and disallows its transfers, since a paused torrent still serves the readers and the peers
+func (c *Download) suspend() {
+	if c.client != nil && c.client != c.staleClient {
+		c.client.PauseTorrent()
+		c.client.SetLimits(c.effectiveLimits())
+		c.suspendedClient = c.client
+	}
+}
+
+// effectiveLimits are the transfer limits, with the transfers paused while suspended
+func (c *Download) effectiveLimits() bandwidth.Limits {
+	limits := c.limits
+	limits.Pause = limits.Pause || c.suspended || c.stale()
+	return limits
+}
+
+// stale tells if the current client is bound to an address that is gone
+func (c *Download) stale() bool {
+	return c.client != nil && c.client == c.staleClient
+}
+
+// Release ends the suspension for the torrents opened from now on.
+// The suspended torrent is kept paused, since it is bound to the address that is gone, until it is closed.
+func (c *Download) Release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.suspended = false
+	if c.suspendedClient != nil && c.suspendedClient == c.client {
+		c.staleClient = c.client
+	}
+	c.suspendedClient = nil
+}
+
+// Unsuspend resumes the torrent paused by Suspend, if it is still the current one
+func (c *Download) Unsuspend() {
+	c.mu.Lock()
+	c.suspended = false
+	var client app.TorrentClient
+	if c.suspendedClient != nil && c.suspendedClient == c.client {
+		client = c.client
+		client.SetLimits(c.effectiveLimits())
+	}
+	c.suspendedClient = nil
+	c.mu.Unlock()
+
+	// resuming may verify the file, which takes a while
+	if client != nil {
+		client.ResumeTorrent()
+	}
+}
+
+func (c *Download) Recheck() {
+	c.client.Recheck()
+}
+
+func (c *Download) FilePriorities() map[string]app.FilePriority {
+	return c.client.FilePriorities()
+}
+
+func (c *Download) SetFilePriority(file *torrent.File, priority app.FilePriority) error {
+	err := c.client.SetFilePriority(file, priority)
+	if err != nil {
+		return faults.Errorf("setting priority of '%s': %w", file.DisplayPath(), err)
+	}
+	return nil
+}
+
+// SetLimits applies the transfer limits to the current torrent and to the ones created after
+func (c *Download) SetLimits(limits bandwidth.Limits) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.limits = limits
+	if c.client != nil {
+		c.client.SetLimits(c.effectiveLimits())
+	}
+}
+
+func (c *Download) Peers() ([]app.PeerInfo, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == nil {
+		return nil, 0
+	}
+	return c.client.Peers(), c.client.BlockedPeers()
+}
+
+// Transfer returns the transfer of the current torrent, if any
+func (c *Download) Transfer() (app.Transfer, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == nil {
+		return app.Transfer{}, false
+	}
+	return c.client.Transfer(), true
+}
+
+func (c *Download) ObserveRate(bytesPerSec float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client != nil {
+		c.client.ObserveRate(bytesPerSec)
+	}
+}
+
+func (c *Download) StopSeeding() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client != nil {
+		c.client.StopSeeding()
+	}
 }
 
 func (c *Download) Close() {
-	c.client.Close()
+	// the players on other devices are only observed while serving
+	c.saveHistory()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client != nil {
+		c.client.Close()
+	}
 	c.client = nil
+	c.suspendedClient = nil
+	c.staleClient = nil
+	c.served = nil
+	c.fetched = nil
+	c.stopPrefetch()
+	c.closeExtractions()
 }
 
 func (c *Download) DownloadTorrent(link string) (viewmodel.DownloadTorrentResponse, error) {
@@ -77,11 +286,14 @@ func (c *Download) DownloadTorrent(link string) (viewmodel.DownloadTorrentRespon
 		c.Close()
 	}
 
-	var err error
-	c.client, err = c.torCliFact(link)
+	client, err := c.torCliFact(link)
 	if err != nil {
 		return viewmodel.DownloadTorrentResponse{}, faults.Errorf("creating torrent client: %w", err)
 	}
+	c.mu.Lock()
+	c.client = client
+	c.client.SetLimits(c.effectiveLimits())
+	c.mu.Unlock()
 
 	files := c.client.GetFilteredFiles()
 	if len(files) == 0 {
@@ -91,11 +303,25 @@ func (c *Download) DownloadTorrent(link string) (viewmodel.DownloadTorrentRespon
 	for _, f := range files {
 		size += f.Length()
 	}
+
+	settings, err := c.repo.LoadSettings()
+	if err != nil {
+		return viewmodel.DownloadTorrentResponse{}, faults.Errorf("loading settings: %w", err)
+	}
+
+	info := c.client.MetaInfo()
+	safetyFiles := make([]safety.File, 0, len(info.Files))
+	for _, f := range info.Files {
+		safetyFiles = append(safetyFiles, safety.File{Path: f.Path, Size: f.Size})
+	}
+
 	return viewmodel.DownloadTorrentResponse{
 		Name:   c.client.GetName(),
 		Files:  files,
 		Folder: folderName(files[0]),
 		Size:   size,
+		Info:   info,
+		Safety: safety.Scan(safetyRules(settings), qualityOf(info.Name, settings.Qualities()), safetyFiles),
 	}, nil
 }
 
@@ -121,10 +347,13 @@ func (c *Download) ServeFile(
 		return faults.Errorf("loading settings: %w", err)
 	}
 
+	detector := stall.NewDetector(settings.Stall())
 	go func() {
-		const interval = 2
+		const interval = 2 * time.Second
 		fn := func() {
 			stats := c.client.Stats()
+			stats.Stall = detector.Observe(time.Now(), stats.Complete, c.downloading(stats))
+			c.recover(stats.Stall, settings)
 			switch stats.Status {
 			case app.StatusReadyForPlayback:
 				stats.Stream = fmt.Sprintf(localhost, settings.Port(), mediaName)
@@ -132,11 +361,10 @@ func (c *Download) ServeFile(
 				stats.Stream = fmt.Sprintf("Scanning... %d%%", stats.PiecesComplete)
 			default:
 				stats.Stream = "Not ready for playback"
+				if stats.ReadyIn > 0 {
+					stats.Stream = fmt.Sprintf("Ready in %s", stats.ReadyIn.Round(time.Second))
+				}
 			}
-			// normalize speed
-			stats.DownloadSpeed = stats.DownloadSpeed / interval
-			stats.UploadSpeed = stats.UploadSpeed / interval
-
 			setStats(stats)
 		}
 		fn()
@@ -145,7 +373,7 @@ func (c *Download) ServeFile(
 			select {
 			case <-ctx.Done():
 				return
-			case <-time.After(interval * time.Second):
+			case <-time.After(interval):
 				fn()
 			}
 		}
@@ -158,8 +386,22 @@ func (c *Download) ServeFile(
 		return nil
 	}
 
+	go c.probeDuration(ctx, file)
+	go c.extractSubtitles(ctx, file, filepath.Join(c.subtitlesRootDir, mediaName))
+
+	c.mu.Lock()
+	c.served = file
+	c.servedHash = c.client.MetaInfo().InfoHash
+	c.servedDuration = 0
+	c.servedRead = 0
+	if c.suspended {
+		c.suspend()
+	}
+	c.mu.Unlock()
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/"+mediaName, c.client.GetFile(mediaName))
+	mux.HandleFunc("/"+mediaName, c.observeReads(file, c.client.GetFile(mediaName)))
+	mux.Handle(subtitlesPath, c.subtitlesHandler())
 
 	server := &http.Server{
 		Addr:    ":" + strconv.Itoa(settings.Port()),
@@ -184,6 +426,102 @@ func (c *Download) ServeFile(
 	return nil
 }
 
+// Probe reads the headers of a media file of the torrent, giving up after a while
+func (c *Download) Probe(ctx context.Context, file *torrent.File) (probe.Info, error) {
+	client := c.currentClient()
+	if client == nil {
+		return probe.Info{}, faults.New("no torrent is open")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	info, err := client.Probe(ctx, file)
+	if err != nil {
+		return probe.Info{}, faults.Errorf("probing file: %w", err)
+	}
+	return info, nil
+}
+
+// probeDuration reads the duration of the file being played, making the readiness estimate more accurate
+func (c *Download) probeDuration(ctx context.Context, file *torrent.File) {
+	if !probe.Supported(file.DisplayPath()) {
+		return
+	}
+
+	info, err := c.Probe(ctx, file)
+	if err != nil {
+		slog.Warn("Failed to probe media duration", "error", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client != nil {
+		// unknown if the probe failed, so a previous file does not count
+		c.client.SetMediaDuration(info.Duration)
+		c.servedDuration = info.Duration
+	}
+}
+
+// downloading tells if the stats are of a download that should be progressing
+func (c *Download) downloading(stats app.Stats) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return stats.Pieces != nil && stats.Status != app.StatusScanning && !stats.Done && !c.limits.Pause && !c.suspended && !c.stale()
+}
+
+// recover takes the recovery action of a stalled download.
+// Switching the source is left to the caller, since it changes the torrent.
+func (c *Download) recover(action stall.Action, settings *model.Settings) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == nil {
+		return
+	}
+
+	switch action {
+	case stall.AnnounceToDHT:
+		c.client.AnnounceToDHT()
+	case stall.AddTrackers:
+		c.client.AddTrackers(settings.FallbackTrackers())
+	case stall.WidenConnections:
+		c.client.SetMaxConnections(settings.MaxConnections() * 2)
+	}
+	if action != stall.None {
+		slog.Info("Stalled download recovery", "action", action.String())
+	}
+}
+
+// AutoPlay tells if the player is launched as soon as the file is ready for playback
+func (c *Download) AutoPlay() (bool, error) {
+	settings, err := c.repo.LoadSettings()
+	if err != nil {
+		return false, faults.Errorf("loading settings: %w", err)
+	}
+	return settings.AutoPlay(), nil
+}
+
+func (c *Download) SetAutoPlay(autoPlay bool) error {
+	err := c.repo.UpdateSettings(func(settings *model.Settings) {
+		settings.SetAutoPlay(autoPlay)
+	})
+	if err != nil {
+		return faults.Errorf("saving settings: %w", err)
+	}
+	return nil
+}
+
+// StallConfig returns the configuration of the stalled downloads recovery
+func (c *Download) StallConfig() (stall.Config, error) {
+	settings, err := c.repo.LoadSettings()
+	if err != nil {
+		return stall.Config{}, faults.Errorf("loading settings: %w", err)
+	}
+	return settings.Stall(), nil
+}
+
 func (c *Download) Play(ctx context.Context, asyncError app.AsyncError, servingFile, subtitlesDir string, onClose func()) error {
 	settings, err := c.repo.LoadSettings()
 	if err != nil {
@@ -207,7 +545,37 @@ func (c *Download) Play(ctx context.Context, asyncError app.AsyncError, servingF
 			}
 		}
 
-		err := c.videoPlayer.Open(ctx, settings.Player(), fmt.Sprintf(localhost, settings.Port(), servingFile), subtitlesDir)
+		var subs []string
+		if subtitlesDir != "" {
+			// the subtitles are loaded from the stream server, as a player on another device would
+			tracks, err := c.subtitleTracks(localBaseURL(settings.Port()), filepath.Base(subtitlesDir))
+			if err != nil {
+				asyncError(err, "Failed to list subtitles")
+			}
+			for _, t := range tracks {
+				subs = append(subs, t.SRT)
+			}
+		}
+
+		launched := c.launchPlayer()
+		p, err := c.videoPlayer.Open(ctx, settings.Player(), fmt.Sprintf(localhost, settings.Port(), servingFile), subs, c.resumePosition())
+		if err != nil {
+			c.closePlayer(launched)
+			asyncError(err, "Failed to open player")
+			onClose()
+			return
+		}
+
+		stop := func() {}
+		if control, ok := p.(app.PlaybackControl); ok {
+			stop = c.watchPlayback(ctx, control, servingFile)
+		} else {
+			c.playerUnreported(launched)
+		}
+		err = p.Wait()
+		stop()
+		c.closePlayer(launched)
+		c.saveHistory()
 		if err != nil {
 			asyncError(err, "Failed to open player")
 		}
@@ -229,87 +597,321 @@ func (c *Download) DownloadSubtitles(
 	if err != nil {
 		return "", 0, faults.Errorf("loading settings: %w", err)
 	}
-	if settings.OpenSubtitles.Username == "" {
-		return "", 0, nil
-	}
-
-	secret, err := c.secrets.GetOpenSubtitles()
-	if err != nil {
-		return "", 0, faults.Errorf("getting OpenSubtitles password: %w", err)
-	}
-	subtitlesClient := c.subtitlesClientFactory(settings.OpenSubtitles.Username, secret.Password)
 
 	subsDir := filepath.Join(c.subtitlesRootDir, mediaName)
-	// if subtitles already exist we will use it
-	if _, err := os.Stat(subsDir); err == nil {
+	// subtitles downloaded before are reused, unless the directory was left empty
+	if files, _ := SubtitleFiles(subsDir); len(files) > 0 {
 		return subsDir, -1, nil
 	}
 
+	// the directory also receives the subtitles embedded in the file, while serving it
 	err = os.MkdirAll(subsDir, os.ModePerm)
 	if err != nil {
 		return "", 0, faults.Errorf("creating subtitles directory: %w", err)
 	}
 
+	found := c.saveSubtitles(context.Background(), settings, app.SubtitleRequest{
+		File:      file,
+		MediaName: mediaName,
+		Query:     cleanedQuery,
+		Season:    season,
+		Episode:   episode,
+	}, subsDir, false)
+	return subsDir, found, nil
+}
+
+// saveSubtitles downloads the best subtitles of the media to its directory, returning how many were found.
+// When prefetching, only the best subtitle of each language is kept, to save the provider quotas,
+// and the movie hash is only computed for complete files, since it would download pieces of the others.
+func (c *Download) saveSubtitles(
+	ctx context.Context,
+	settings *model.Settings,
+	req app.SubtitleRequest,
+	subsDir string,
+	prefetch bool,
+) int {
+	var movieHash func() string
+	if !prefetch || req.File.BytesCompleted() == req.File.Length() {
+		movieHash = func() string {
+			return c.movieHash(ctx, req.File)
+		}
+	}
+
 	languages := settings.Languages()
-	subtitles, err := subtitlesClient.Search(cleanedQuery, season, episode, languages)
+	subtitles := searchSubtitles(ctx, c.enabledProviders(settings.SubtitleSources()), app.SubtitleQuery{
+		File:      req.File,
+		Query:     req.Query,
+		Season:    req.Season,
+		Episode:   req.Episode,
+		Languages: languages,
+	}, movieHash)
+	subtitles = c.rankSubtitles(subtitles, req.Query, languages, settings.SubtitlePreferences(), releaseOf(req.File))
+
+	found := 0
+	downloaded := 0
+	// exhausted are the providers that refuse downloads until their quota resets
+	exhausted := map[string]bool{}
+	// saved are the languages with a subtitle, when prefetching
+	saved := map[string]bool{}
+	for _, sub := range subtitles {
+		// live subtitles are written while serving the file
+		if sub.Live {
+			found++
+			continue
+		}
+		if downloaded >= maxSubtitles || exhausted[sub.Provider] || (prefetch && saved[lang.Base(sub.Language)]) {
+			continue
+		}
+
+		data, err := c.fetchSubtitle(ctx, sub)
+		if errors.Is(err, app.ErrSubtitleQuotaExhausted) {
+			slog.Warn("Subtitle download quota exhausted", "provider", sub.Provider, "error", err)
+			exhausted[sub.Provider] = true
+			continue
+		}
+		if err != nil {
+			slog.Error("Failed to download subtitle", "provider", sub.Provider, "id", sub.ID, "error", err)
+			continue
+		}
+
+		subPath := filepath.Join(subsDir, insertLang(downloaded, sub.Filename, sub.Language))
+		err = os.WriteFile(subPath, normalizeSubtitle(data, sub), 0o644)
+		if err != nil {
+			slog.Error("Failed to save subtitle file", "file", subPath, "error", err)
+			continue
+		}
+
+		downloaded++
+		found++
+		saved[lang.Base(sub.Language)] = true
+	}
+
+	return found
+}
+
+// SubtitleLanguages returns the preferred languages of the subtitles
+func (c *Download) SubtitleLanguages() ([]string, error) {
+	settings, err := c.repo.LoadSettings()
 	if err != nil {
-		return "", 0, faults.Errorf("searching subtitles: %w", err)
+		return nil, faults.Errorf("loading settings: %w", err)
 	}
+	return settings.Languages(), nil
+}
+
+// SubtitleProviders returns the names of the subtitle providers, in the order their subtitles are preferred
+func (c *Download) SubtitleProviders() []string {
+	names := make([]string, 0, len(c.providers))
+	for _, p := range c.providers {
+		names = append(names, p.Name())
+	}
+	return names
+}
 
-	if len(subtitles) == 0 {
-		return "", 0, nil
+func (c *Download) SubtitleSources() (model.SubtitleSources, error) {
+	settings, err := c.repo.LoadSettings()
+	if err != nil {
+		return model.SubtitleSources{}, faults.Errorf("loading settings: %w", err)
 	}
+	return settings.SubtitleSources(), nil
+}
 
-	token, err := subtitlesClient.Login()
+func (c *Download) SetSubtitleSources(sources model.SubtitleSources) error {
+	err := c.repo.UpdateSettings(func(settings *model.Settings) {
+		settings.SetSubtitleSources(sources)
+	})
 	if err != nil {
-		return "", 0, faults.Errorf("login: %w", err)
+		return faults.Errorf("saving settings: %w", err)
 	}
+	return nil
+}
 
-	defer func() {
-		err := subtitlesClient.Logout(token)
-		if err != nil {
-			slog.Error("Failed to logout from OpenSubtitles", "error", fmt.Sprintf("%+v", err))
+func (c *Download) SubtitlePreferences() (subrank.Preferences, error) {
+	settings, err := c.repo.LoadSettings()
+	if err != nil {
+		return subrank.Preferences{}, faults.Errorf("loading settings: %w", err)
+	}
+	return settings.SubtitlePreferences(), nil
+}
+
+func (c *Download) SetSubtitlePreferences(prefs subrank.Preferences) error {
+	err := c.repo.UpdateSettings(func(settings *model.Settings) {
+		settings.SetSubtitlePreferences(prefs)
+	})
+	if err != nil {
+		return faults.Errorf("saving settings: %w", err)
+	}
+	return nil
+}
+
+func (c *Download) enabledProviders(sources model.SubtitleSources) []app.SubtitleProvider {
+	var providers []app.SubtitleProvider
+	for _, p := range c.providers {
+		if sources.Enabled(p.Name()) {
+			providers = append(providers, p)
 		}
-	}()
+	}
+	return providers
+}
+
+func (c *Download) provider(name string) app.SubtitleProvider {
+	for _, p := range c.providers {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// searchSubtitles searches every provider at the same time.
+// The providers that use the movie hash wait for it, computed once if the function is set, while the others search.
+// A failing provider is logged and skipped, so the others still count.
+func searchSubtitles(
+	ctx context.Context,
+	providers []app.SubtitleProvider,
+	query app.SubtitleQuery,
+	movieHash func() string,
+) []app.Subtitle {
+	var hash func() string
+	if movieHash != nil {
+		hash = sync.OnceValue(movieHash)
+	}
+
+	results := make([][]app.Subtitle, len(providers))
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			query := query
+			if hp, ok := p.(app.SubtitleHashProvider); ok && hash != nil && hp.UsesMovieHash() {
+				query.Hash = hash()
+			}
+			subs, err := p.Search(ctx, query)
+			if err != nil {
+				slog.Warn("Failed to search subtitles", "provider", p.Name(), "error", err)
+				return
+			}
+			results[i] = subs
+		}()
+	}
+	wg.Wait()
+
+	return gslices.Concat(results...)
+}
+
+// movieHash computes the OpenSubtitles hash of the file, or returns empty if it takes too long
+func (c *Download) movieHash(ctx context.Context, file *torrent.File) string {
+	client := c.currentClient()
+	if client == nil || file == nil {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, movieHashTimeout)
+	defer cancel()
+	hash, err := client.MovieHash(ctx, file)
+	if err != nil {
+		slog.Warn("Failed to compute movie hash, searching subtitles by name", "error", err)
+		return ""
+	}
+	return hash
+}
+
+// rankSubtitles keeps the wanted subtitles that are made for the file or match the query,
+// sorting them by the preferred languages, then by how well they fit the release and then by provider
+func (c *Download) rankSubtitles(
+	subtitles []app.Subtitle,
+	query string,
+	languages []string,
+	prefs subrank.Preferences,
+	target subrank.Release,
+) []app.Subtitle {
+	tokens := strings.Split(strings.ToLower(query), " ")
+	subtitles = gslices.DeleteFunc(subtitles, func(s app.Subtitle) bool {
+		return !subrank.Accept(candidate(s), prefs) || (!exact(s) && !wordMatch(tokens, s.Filename))
+	})
+
+	c.sortSubtitles(subtitles, languages, target)
+	return subtitles
+}
+
+// sortSubtitles sorts the subtitles by the preferred languages, then by how well they fit the release and then by provider
+func (c *Download) sortSubtitles(subtitles []app.Subtitle, languages []string, target subrank.Release) {
+	scores := make(map[app.Subtitle]int, len(subtitles))
+	for _, s := range subtitles {
+		scores[s] = subrank.Score(candidate(s), target)
+	}
 
-	gslices.SortFunc(subtitles, func(i, j app.SubtitleAttributes) int {
-		gslices.Index(languages, i.Language)
-		return cmp.Compare(
-			gslices.Index(languages, i.Language),
-			gslices.Index(languages, j.Language),
+	order := c.SubtitleProviders()
+	gslices.SortStableFunc(subtitles, func(a, b app.Subtitle) int {
+		return cmp.Or(
+			cmp.Compare(lang.Rank(a.Language, languages), lang.Rank(b.Language, languages)),
+			cmp.Compare(scores[b], scores[a]),
+			cmp.Compare(gslices.Index(order, a.Provider), gslices.Index(order, b.Provider)),
 		)
 	})
+}
 
-	qry := strings.ToLower(cleanedQuery)
-	tokens := strings.Split(qry, " ")
+// exact tells if the subtitle was made for the file, being in it or matching its hash
+func exact(s app.Subtitle) bool {
+	return s.Live || s.HashMatch
+}
 
-	downloaded := 0
-	for _, sub := range subtitles {
-		if !wordMatch(tokens, sub.Filename) {
+func candidate(s app.Subtitle) subrank.Candidate {
+	return subrank.Candidate{
+		Release:           cmp.Or(s.Release, s.Filename),
+		Exact:             exact(s),
+		Downloads:         s.Downloads,
+		Rating:            s.Rating,
+		HearingImpaired:   s.HearingImpaired,
+		Trusted:           s.Trusted,
+		MachineTranslated: s.AITranslated || s.MachineTranslated,
+	}
+}
+
+// releaseOf returns the release details of the file, completed with the ones of the torrent
+func releaseOf(file *torrent.File) subrank.Release {
+	if file == nil {
+		return subrank.Release{}
+	}
+	release := subrank.ParseRelease(filepath.Base(file.DisplayPath()))
+	if t := file.Torrent(); t != nil && t.Info() != nil {
+		release = release.Merge(subrank.ParseRelease(t.Name()))
+	}
+	return release
+}
+
+// SubtitleQuotas returns the download quota of the providers that limit the downloads, by provider.
+// With refresh the providers are asked for it, otherwise it is the one known from the last downloads.
+func (c *Download) SubtitleQuotas(ctx context.Context, refresh bool) (map[string]app.SubtitleQuota, error) {
+	quotas := map[string]app.SubtitleQuota{}
+	for _, p := range c.providers {
+		qp, ok := p.(app.SubtitleQuotaProvider)
+		if !ok {
 			continue
 		}
-
-		download, err := subtitlesClient.Download(token, sub.FileID)
+		quota, err := qp.Quota(ctx, refresh)
 		if err != nil {
-			slog.Error("Failed to download subtitle", "error", err)
-			continue
+			return nil, faults.Errorf("getting %s quota: %w", p.Name(), err)
 		}
+		if quota.Allowed > 0 {
+			quotas[p.Name()] = quota
+		}
+	}
+	return quotas, nil
+}
 
-		subPath := filepath.Join(subsDir, insertLang(downloaded, download.Filename, sub.Language))
-		err = saveSubtitleFileRetry(download.Link, subPath)
-		if err != nil {
-			slog.Error("Failed to save subtitle file", "link", download.Link, "error", err)
+// CloseSubtitleProviders ends the sessions of the providers that hold one. They are kept while the app runs.
+func (c *Download) CloseSubtitleProviders() {
+	for _, p := range c.providers {
+		closer, ok := p.(io.Closer)
+		if !ok {
 			continue
 		}
-
-		downloaded++
-		// Download only the first 10 subtitles
-		if downloaded >= 10 {
-			break
+		err := closer.Close()
+		if err != nil {
+			slog.Error("Failed to close subtitle provider", "provider", p.Name(), "error", fmt.Sprintf("%+v", err))
 		}
 	}
-
-	return subsDir, downloaded, nil
 }
 
 func wordMatch(tokens []string, name string) bool {
@@ -327,39 +929,3 @@ func insertLang(index int, filename, language string) string {
 	name := strings.TrimSuffix(filename, ext)
 	return fmt.Sprintf("%02d-%s.%s%s", index, name, language, ext)
 }
-
-// saveSubtitleFileRetry downloads the subtitle file from the given URL and saves it locally
-func saveSubtitleFileRetry(downloadLink, fileName string) error {
-	return retry.Do(func() error {
-		return saveSubtitleFile(downloadLink, fileName)
-	}, retry.WithDelayFunc(https.DelayFunc))
-}
-
-func saveSubtitleFile(downloadLink, fileName string) error {
-	resp, err := http.Get(downloadLink)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		if resp.StatusCode == http.StatusTooManyRequests {
-			return fails.New("too many requests for downloading subtitle", "retry-after", resp.Header.Get("Retry-After"))
-		}
-		return retry.NewPermanentError(faults.Errorf("failed to fetch subtitle file, status code: %d", resp.StatusCode))
-	}
-
-	// Create a file locally to save the subtitle
-	outFile, err := os.Create(fileName)
-	if err != nil {
-		return err
-	}
-	defer outFile.Close()
-
-	_, err = io.Copy(outFile, resp.Body)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/quintans/faults"
+	"github.com/quintans/torflix/internal/app"
+	"github.com/quintans/torflix/internal/lib/probe"
+)
+
+// extractInterval is how often the downloaded part of the file is scanned for subtitles
+const extractInterval = 5 * time.Second
+
+// extractSubtitles writes the text subtitle tracks embedded in an MKV file to the subtitles directory,
+// as the file is downloaded. Nothing is done if the subtitles were not requested, since the directory does not exist.
+func (c *Download) extractSubtitles(ctx context.Context, file *torrent.File, subsDir string) {
+	if !hasEmbeddedSubtitles(file) {
+		return
+	}
+	if _, err := os.Stat(subsDir); err != nil {
+		return
+	}
+	settings, err := c.repo.LoadSettings()
+	if err != nil {
+		slog.Warn("Failed to load settings for the embedded subtitles", "error", err)
+		return
+	}
+	if !settings.SubtitleSources().Enabled(EmbeddedProviderName) {
+		return
+	}
+
+	err = c.extract(ctx, file, subsDir)
+	if err != nil && ctx.Err() == nil {
+		slog.Warn("Failed to extract embedded subtitles", "file", file.DisplayPath(), "error", err)
+	}
+}
+
+func (c *Download) extract(ctx context.Context, file *torrent.File, subsDir string) error {
+	client := c.currentClient()
+	if client == nil {
+		return nil
+	}
+
+	e, err := c.extraction(ctx, client, file)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(extractInterval)
+	defer ticker.Stop()
+	for {
+		var done bool
+		err := e.run(client.Completed(file), func(ex *probe.Extractor, found bool) error {
+			done = ex.Done()
+			if !found {
+				return nil
+			}
+			return writeTracks(ex.Tracks(), subsDir)
+		})
+		if err != nil {
+			return err
+		}
+		if done {
+			slog.Info("Extracted embedded subtitles", "file", file.DisplayPath())
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// extraction is the extractor of the subtitle tracks of a file, shared by the background extraction and the provider,
+// so the file is only read once as it downloads
+type extraction struct {
+	mu     sync.Mutex
+	ex     *probe.Extractor
+	cancel context.CancelFunc
+	closer io.Closer
+}
+
+// run extracts the cues of the part of the file available since the last run and calls fn with the extractor
+func (e *extraction) run(available int64, fn func(ex *probe.Extractor, found bool) error) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	found, err := e.ex.Extract(available)
+	if err != nil {
+		return faults.Errorf("extracting subtitles: %w", err)
+	}
+	return fn(e.ex, found)
+}
+
+func (e *extraction) close() {
+	e.cancel()
+	_ = e.closer.Close()
+}
+
+// extraction returns the extraction of the file, opening it the first time.
+// The headers are read within the context, but the extraction lasts until the torrent is closed.
+func (c *Download) extraction(ctx context.Context, client app.TorrentClient, file *torrent.File) (*extraction, error) {
+	c.extractMu.Lock()
+	defer c.extractMu.Unlock()
+
+	if e, ok := c.extractions[file.Path()]; ok {
+		return e, nil
+	}
+
+	readerCtx, cancel := context.WithCancel(context.Background())
+	stop := context.AfterFunc(ctx, cancel)
+	ex, closer, err := newExtractor(readerCtx, client, file)
+	if !stop() {
+		err = errors.Join(err, ctx.Err())
+	}
+	if err != nil {
+		cancel()
+		if closer != nil {
+			_ = closer.Close()
+		}
+		return nil, err
+	}
+
+	e := &extraction{ex: ex, cancel: cancel, closer: closer}
+	if c.extractions == nil {
+		c.extractions = map[string]*extraction{}
+	}
+	c.extractions[file.Path()] = e
+	return e, nil
+}
+
+// closeExtractions ends the extractions of the torrent being closed
+func (c *Download) closeExtractions() {
+	c.extractMu.Lock()
+	defer c.extractMu.Unlock()
+
+	for _, e := range c.extractions {
+		e.close()
+	}
+	c.extractions = nil
+}
+
+// hasEmbeddedSubtitles reports whether the file is in a container with text subtitle tracks that can be extracted
+func hasEmbeddedSubtitles(file *torrent.File) bool {
+	ext := strings.ToLower(filepath.Ext(file.DisplayPath()))
+	return ext == ".mkv" || ext == ".webm"
+}
+
+func newExtractor(ctx context.Context, client app.TorrentClient, file *torrent.File) (*probe.Extractor, io.Closer, error) {
+	r, err := client.NewReader(ctx, file)
+	if err != nil {
+		return nil, nil, faults.Errorf("opening file: %w", err)
+	}
+
+	ex, err := probe.NewExtractor(r, file.Length())
+	if err != nil {
+		r.Close()
+		return nil, nil, faults.Errorf("reading headers: %w", err)
+	}
+	return ex, r, nil
+}
+
+func trackFilename(t *probe.TextTrack) string {
+	return fmt.Sprintf("embedded-%02d.%s%s", t.Number, t.Language, t.Ext())
+}
+
+// writeTracks rewrites the subtitle files with the cues extracted so far
+func writeTracks(tracks []*probe.TextTrack, subsDir string) error {
+	for _, t := range tracks {
+		if len(t.Cues) == 0 {
+			continue
+		}
+		err := os.WriteFile(filepath.Join(subsDir, trackFilename(t)), t.Format(), 0o644)
+		if err != nil {
+			return faults.Errorf("writing subtitle track %d: %w", t.Number, err)
+		}
+	}
+	return nil
+}
+
+// EmbeddedProviderName is the name of the provider of the subtitle tracks embedded in the media file
+const EmbeddedProviderName = "embedded"
+
+// embeddedProvider finds the text subtitle tracks of the MKV file being downloaded.
+// Its subtitles are live, since they grow as the file downloads.
+type embeddedProvider struct {
+	download *Download
+}
+
+func (p *embeddedProvider) Name() string {
+	return EmbeddedProviderName
+}
+
+func (p *embeddedProvider) Search(ctx context.Context, query app.SubtitleQuery) ([]app.Subtitle, error) {
+	if query.File == nil || !hasEmbeddedSubtitles(query.File) {
+		return nil, nil
+	}
+
+	client := p.download.currentClient()
+	if client == nil {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	e, err := p.download.extraction(ctx, client, query.File)
+	if err != nil {
+		return nil, err
+	}
+
+	var subtitles []app.Subtitle
+	err = e.run(client.Completed(query.File), func(ex *probe.Extractor, _ bool) error {
+		for _, t := range ex.Tracks() {
+			subtitles = append(subtitles, app.Subtitle{
+				Provider: EmbeddedProviderName,
+				// the track number is paired with the file, since a torrent may have many
+				ID:       fmt.Sprintf("%d:%s", t.Number, query.File.Path()),
+				Language: t.Language,
+				Filename: trackFilename(t),
+				Live:     true,
+			})
+		}
+		return nil
+	})
+	return subtitles, err
+}
+
+// Download returns the cues of the track in the part of the file downloaded so far, from the extraction shared with the background one
+func (p *embeddedProvider) Download(ctx context.Context, sub app.Subtitle) ([]byte, error) {
+	number, path, ok := strings.Cut(sub.ID, ":")
+	if !ok {
+		return nil, faults.Errorf("invalid embedded subtitle ID '%s'", sub.ID)
+	}
+	client := p.download.currentClient()
+	if client == nil {
+		return nil, faults.New("no torrent is being downloaded")
+	}
+	idx := slices.IndexFunc(client.GetFilteredFiles(), func(f *torrent.File) bool {
+		return f.Path() == path
+	})
+	if idx < 0 {
+		return nil, faults.Errorf("file '%s' not found in the torrent", path)
+	}
+	file := client.GetFilteredFiles()[idx]
+
+	e, err := p.download.extraction(ctx, client, file)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the part downloaded since the last extraction is read
+	var data []byte
+	err = e.run(client.Completed(file), func(ex *probe.Extractor, _ bool) error {
+		for _, t := range ex.Tracks() {
+			if strconv.Itoa(t.Number) == number {
+				data = t.Format()
+				return nil
+			}
+		}
+		return faults.Errorf("subtitle track %s not found", number)
+	})
+	return data, err
+}
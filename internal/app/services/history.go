@@ -0,0 +1,241 @@
+package services
+
+import (
+	"log/slog"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/quintans/faults"
+	"github.com/quintans/torflix/internal/app"
+	"github.com/quintans/torflix/internal/model"
+)
+
+const (
+	// historySaveInterval is the least time between saves of the watch history while playing
+	historySaveInterval = 10 * time.Second
+	// readObserveInterval is the least time between observations of the reads of a stream
+	readObserveInterval = time.Second
+	// indexTail is the percentage at the end of the file where players read the index before playing
+	indexTail = 98
+)
+
+// observeWatch records how much of the served file was watched, saving the history from time to time
+func (c *Download) observeWatch(watched float64, position, duration time.Duration) {
+	c.mu.Lock()
+	file, infoHash := c.served, c.servedHash
+	c.mu.Unlock()
+	if file == nil || infoHash == "" {
+		return
+	}
+
+	c.historyMu.Lock()
+	defer c.historyMu.Unlock()
+
+	history, err := c.repo.LoadHistory()
+	if err != nil {
+		slog.Error("Failed to load the watch history", "error", err)
+		return
+	}
+	now := time.Now()
+	history.Observe(infoHash, file.Path(), watched, position, duration, now)
+	c.historyDirty = true
+	if now.Sub(c.historySaved) >= historySaveInterval {
+		c.saveHistoryLocked(history)
+	}
+}
+
+// saveHistory saves the watch history if there is something new
+func (c *Download) saveHistory() {
+	c.historyMu.Lock()
+	defer c.historyMu.Unlock()
+
+	if !c.historyDirty {
+		return
+	}
+	history, err := c.repo.LoadHistory()
+	if err != nil {
+		slog.Error("Failed to load the watch history", "error", err)
+		return
+	}
+	c.saveHistoryLocked(history)
+}
+
+func (c *Download) saveHistoryLocked(history *model.WatchHistory) {
+	err := c.repo.SaveHistory(history)
+	if err != nil {
+		slog.Error("Failed to save the watch history", "error", err)
+		return
+	}
+	c.historyDirty = false
+	c.historySaved = time.Now()
+}
+
+// resumePosition returns where the served file was left, to start playing it there
+func (c *Download) resumePosition() time.Duration {
+	c.mu.Lock()
+	file, infoHash := c.served, c.servedHash
+	c.mu.Unlock()
+	if file == nil {
+		return 0
+	}
+
+	c.historyMu.Lock()
+	defer c.historyMu.Unlock()
+
+	history, err := c.repo.LoadHistory()
+	if err != nil {
+		slog.Error("Failed to load the watch history", "error", err)
+		return 0
+	}
+	entry, _ := history.Entry(infoHash, file.Path())
+	return entry.Resume()
+}
+
+// WatchHistory returns what was watched of the files of the torrent, by path
+func (c *Download) WatchHistory(infoHash string) (map[string]model.WatchEntry, error) {
+	c.historyMu.Lock()
+	defer c.historyMu.Unlock()
+
+	history, err := c.repo.LoadHistory()
+	if err != nil {
+		return nil, faults.Errorf("loading watch history: %w", err)
+	}
+	return maps.Clone(history.Torrents[strings.ToUpper(infoHash)]), nil
+}
+
+// observePlayback records the position reported by a player that is controlled
+func (c *Download) observePlayback(status app.PlaybackStatus) {
+	if status.Duration <= 0 {
+		return
+	}
+	c.observeWatch(status.Position.Seconds()/status.Duration.Seconds()*100, status.Position, status.Duration)
+}
+
+// launchedPlayer is a player opened by Play on the served file
+type launchedPlayer struct {
+	// reports is true when the player reports its position, so the reads of its requests are not observed.
+	// It is assumed until the player is opened, since mpv reads the stream while its IPC is connecting.
+	// Guarded by Download.mu.
+	reports bool
+}
+
+// launchPlayer records that a player is being opened, to tell its requests apart from the ones of other players
+func (c *Download) launchPlayer() *launchedPlayer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.launched = &launchedPlayer{reports: true}
+	return c.launched
+}
+
+// playerUnreported falls back to observing the reads of the player, since it cannot report its position
+func (c *Download) playerUnreported(launched *launchedPlayer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	launched.reports = false
+}
+
+// closePlayer forgets the player, so new requests are observed.
+// The requests it made keep it, so reads finishing after it was closed do not overwrite its last position.
+func (c *Download) closePlayer(launched *launchedPlayer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.launched == launched {
+		c.launched = nil
+	}
+}
+
+// observeRead records where the player is reading the file and, for a player that does not report its position,
+// how far it was watched. It is ahead of the position by what the player buffers.
+func (c *Download) observeRead(file *torrent.File, launched *launchedPlayer, offset int64) {
+	c.mu.Lock()
+	if file == c.served {
+		c.servedRead = offset
+	}
+	reports := launched != nil && launched.reports
+	duration := c.servedDuration
+	c.mu.Unlock()
+	if reports || file.Length() == 0 {
+		return
+	}
+
+	watched := float64(offset) / float64(file.Length()) * 100
+	var position time.Duration
+	if duration > 0 {
+		position = time.Duration(watched / 100 * float64(duration))
+	}
+	c.observeWatch(watched, position, duration)
+}
+
+// observeReads records how far the players read the file, from the ranges they request and the bytes sent,
+// for the players that do not report their position, including the ones on other devices.
+// A request made while a player opened by Play is open is taken as one of its requests.
+func (c *Download) observeReads(file *torrent.File, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := rangeStart(r.Header.Get("Range"))
+		// the index at the end of the file is read before playing
+		if start >= file.Length()*indexTail/100 {
+			next(w, r)
+			return
+		}
+
+		// a seek of the player starts reading from the new range
+		c.mu.Lock()
+		if file == c.served {
+			c.servedRead = start
+		}
+		launched := c.launched
+		c.mu.Unlock()
+
+		// short reads, like the headers, are not observed
+		next(&readObserver{
+			ResponseWriter: w,
+			observe: func(read int64) {
+				c.observeRead(file, launched, start+read)
+			},
+			observed: time.Now(),
+		}, r)
+	}
+}
+
+// rangeStart returns the first byte of a range header, eg: 100 for bytes=100-, or zero if there is none
+func rangeStart(header string) int64 {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return 0
+	}
+	first, _, _ := strings.Cut(spec, "-")
+	start, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return start
+}
+
+// readObserver counts the bytes written to the player
+type readObserver struct {
+	http.ResponseWriter
+	observe  func(read int64)
+	read     int64
+	observed time.Time
+}
+
+func (o *readObserver) Write(b []byte) (int, error) {
+	n, err := o.ResponseWriter.Write(b)
+	o.read += int64(n)
+	if now := time.Now(); now.Sub(o.observed) >= readObserveInterval {
+		o.observed = now
+		o.observe(o.read)
+	}
+	return n, err
+}
+
+func (o *readObserver) Unwrap() http.ResponseWriter {
+	return o.ResponseWriter
+}
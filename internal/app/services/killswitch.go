@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/quintans/faults"
+	"github.com/quintans/torflix/internal/app"
+	"github.com/quintans/torflix/internal/lib/netbind"
+)
+
+// Suspender pauses the torrents while the network is unavailable
+type Suspender interface {
+	Suspend()
+	Unsuspend()
+	// Release ends the suspension for the new torrents, keeping the suspended one paused
+	Release()
+}
+
+// KillSwitch watches the interface the torrents are bound to, usually a VPN,
+// pausing the torrents when it disappears or changes address and resuming them when it comes back.
+type KillSwitch struct {
+	repo      Repository
+	torrents  Suspender
+	bus       app.EventBus
+	bind      string
+	bound     net.IP
+	suspended bool
+	resolve   func(bind string) (net.IP, error)
+}
+
+func NewKillSwitch(repo Repository, torrents Suspender, bus app.EventBus) *KillSwitch {
+	return &KillSwitch{
+		repo:     repo,
+		torrents: torrents,
+		bus:      bus,
+		resolve:  netbind.Resolve,
+	}
+}
+
+// Run checks the interface at every interval until the context is done
+func (k *KillSwitch) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := k.check()
+		if err != nil {
+			slog.Error("Failed to check the bound interface", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (k *KillSwitch) check() error {
+	settings, err := k.repo.LoadSettings()
+	if err != nil {
+		return faults.Errorf("loading settings: %w", err)
+	}
+
+	bind := settings.BindInterface()
+	if bind != k.bind {
+		// the setting changed, so the address is learned again
+		if k.suspended {
+			k.resume()
+		}
+		k.bind = bind
+		k.bound = nil
+	}
+	if bind == "" {
+		return nil
+	}
+
+	ip, err := k.resolve(bind)
+	if err != nil {
+		if !k.suspended {
+			slog.Warn("Bound interface unavailable", "interface", bind, "error", err)
+			k.suspend(app.NewNotifyError("Network %s is down. Torrents paused", bind))
+		}
+		return nil
+	}
+
+	switch {
+	case k.bound == nil:
+		k.bound = ip
+		if k.suspended {
+			k.resume()
+		}
+	case !ip.Equal(k.bound):
+		if !k.suspended {
+			k.suspend(app.NewNotifyError("Network %s changed address to %s. Torrents paused", bind, ip))
+			return nil
+		}
+		// the running torrent is still bound to the old address, so only the new ones can use the network
+		k.bound = ip
+		k.torrents.Release()
+		k.suspended = false
+		k.bus.Publish(app.NewNotifyWarn("Network %s is back with a new address. Open the torrent again to resume it", bind))
+	case k.suspended:
+		k.resume()
+	}
+
+	return nil
+}
+
+func (k *KillSwitch) suspend(msg app.Notify) {
+	k.suspended = true
+	k.torrents.Suspend()
+	k.bus.Publish(msg)
+}
+
+func (k *KillSwitch) resume() {
+	k.suspended = false
+	k.torrents.Unsuspend()
+	k.bus.Publish(app.NewNotifyInfo("Network %s is back. Torrents resumed", k.bind))
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/quintans/torflix/internal/app"
+	"github.com/quintans/torflix/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type settingsRepo struct {
+	Repository
+	settings *model.Settings
+}
+
+func (r settingsRepo) LoadSettings() (*model.Settings, error) {
+	return r.settings, nil
+}
+
+type fakeSuspender struct {
+	calls []string
+}
+
+func (s *fakeSuspender) Suspend()   { s.calls = append(s.calls, "suspend") }
+func (s *fakeSuspender) Unsuspend() { s.calls = append(s.calls, "unsuspend") }
+func (s *fakeSuspender) Release()   { s.calls = append(s.calls, "release") }
+
+type fakeBus struct {
+	msgs []app.Notify
+}
+
+func (b *fakeBus) Publish(m app.Message) {
+	b.msgs = append(b.msgs, m.(app.Notify))
+}
+
+func TestKillSwitchAddressChange(t *testing.T) {
+	settings := model.NewSettings()
+	settings.SetBindInterface("tun0")
+	torrents := &fakeSuspender{}
+	bus := &fakeBus{}
+	k := NewKillSwitch(settingsRepo{settings: settings}, torrents, bus)
+
+	ip := net.ParseIP("10.8.0.2")
+	k.resolve = func(string) (net.IP, error) {
+		if ip == nil {
+			return nil, errors.New("interface not found")
+		}
+		return ip, nil
+	}
+
+	require.NoError(t, k.check())
+	assert.Empty(t, torrents.calls)
+
+	// the torrent bound to the old address stays paused
+	ip = net.ParseIP("10.8.0.3")
+	require.NoError(t, k.check())
+	require.NoError(t, k.check())
+	assert.Equal(t, []string{"suspend", "release"}, torrents.calls)
+	require.Len(t, bus.msgs, 2)
+	assert.Equal(t, app.NotifyWarn, bus.msgs[1].Type)
+
+	// the new address is the one being watched
+	require.NoError(t, k.check())
+	assert.Equal(t, []string{"suspend", "release"}, torrents.calls)
+
+	// the same address coming back resumes the torrents
+	ip = nil
+	require.NoError(t, k.check())
+	ip = net.ParseIP("10.8.0.3")
+	require.NoError(t, k.check())
+	assert.Equal(t, []string{"suspend", "release", "suspend", "unsuspend"}, torrents.calls)
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/quintans/faults"
+	"github.com/quintans/torflix/internal/app"
+	"github.com/quintans/torflix/internal/lib/playback"
+	"github.com/quintans/torflix/internal/lib/subtitles"
+)
+
+// playbackInterval is how often the player is polled
+const playbackInterval = time.Second
+
+// watchPlayback polls the player until stop is called, pausing it while the download is behind the playback
+func (c *Download) watchPlayback(ctx context.Context, control app.PlaybackControl, mediaName string) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	c.mu.Lock()
+	c.playback = control
+	c.playbackMedia = mediaName
+	c.playbackStatus = app.PlaybackStatus{}
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		var starvation playback.Starvation
+		ticker := time.NewTicker(playbackInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			status, err := control.Status(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Debug("Failed to get the player status", "error", err)
+				}
+				continue
+			}
+
+			switch c.observeStarvation(&starvation, status) {
+			case playback.Pause:
+				err = control.SetPause(ctx, true)
+				if err == nil {
+					status.Paused = true
+					slog.Info("Paused the player until the download catches up")
+				}
+			case playback.Resume:
+				err = control.SetPause(ctx, false)
+				if err == nil {
+					status.Paused = false
+					slog.Info("Resumed the player")
+				}
+			}
+			if err != nil && ctx.Err() == nil {
+				slog.Warn("Failed to control the player", "error", err)
+			}
+			status.Starved = starvation.Starved()
+			c.observePlayback(status)
+
+			c.mu.Lock()
+			c.playbackStatus = status
+			c.mu.Unlock()
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+
+		c.mu.Lock()
+		c.playback = nil
+		c.playbackMedia = ""
+		c.playbackStatus = app.PlaybackStatus{}
+		c.mu.Unlock()
+	}
+}
+
+// observeStarvation measures the media buffered ahead of the position of the player:
+// what the player has in its cache, plus what is downloaded after the offset where the player is reading the file.
+// Only the downloaded part is converted from bytes with the average bitrate.
+func (c *Download) observeStarvation(starvation *playback.Starvation, status app.PlaybackStatus) playback.Action {
+	c.mu.Lock()
+	client, file, offset := c.client, c.served, c.servedRead
+	c.mu.Unlock()
+	if client == nil || file == nil || status.Duration <= 0 {
+		return playback.None
+	}
+
+	size := file.Length()
+	offset = min(offset, size)
+	buffered := client.BufferedFrom(file, offset)
+	toEnd := offset+buffered >= size
+
+	ahead := status.CacheAhead
+	if status.PausedForCache && !toEnd {
+		// the player is already waiting for the download
+		ahead = 0
+	} else if size > 0 {
+		bitrate := float64(size) / status.Duration.Seconds()
+		ahead += time.Duration(float64(buffered) / bitrate * float64(time.Second))
+	}
+	return starvation.Observe(ahead, toEnd, status.Paused)
+}
+
+// PlaybackStatus returns the status of the player, if it can be controlled
+func (c *Download) PlaybackStatus() (app.PlaybackStatus, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.playbackStatus, c.playback != nil
+}
+
+func (c *Download) currentPlayback() (app.PlaybackControl, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.playback == nil {
+		return nil, faults.New("the player cannot be controlled")
+	}
+	return c.playback, nil
+}
+
+// SetPlaybackPause pauses or resumes the player
+func (c *Download) SetPlaybackPause(ctx context.Context, paused bool) error {
+	control, err := c.currentPlayback()
+	if err != nil {
+		return err
+	}
+	err = control.SetPause(ctx, paused)
+	if err != nil {
+		return faults.Errorf("pausing player: %w", err)
+	}
+	return nil
+}
+
+// SeekPlayback moves the position of the player by the offset
+func (c *Download) SeekPlayback(ctx context.Context, offset time.Duration) error {
+	control, err := c.currentPlayback()
+	if err != nil {
+		return err
+	}
+	err = control.Seek(ctx, offset)
+	if err != nil {
+		return faults.Errorf("seeking player: %w", err)
+	}
+	return nil
+}
+
+// loadSubtitle adds the subtitle to the player, if it is playing the media and can be controlled
+func (c *Download) loadSubtitle(ctx context.Context, mediaName, name string) error {
+	c.mu.Lock()
+	control := c.playback
+	playing := c.playbackMedia == mediaName
+	c.mu.Unlock()
+	if control == nil || !playing {
+		return nil
+	}
+
+	settings, err := c.repo.LoadSettings()
+	if err != nil {
+		return faults.Errorf("loading settings: %w", err)
+	}
+	url := subtitleURL(localBaseURL(settings.Port()), mediaName, name, subtitles.SRT)
+	err = control.AddSubtitle(ctx, url)
+	if err != nil {
+		return faults.Errorf("adding subtitle to the player: %w", err)
+	}
+	return nil
+}
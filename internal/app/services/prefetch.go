@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/quintans/torflix/internal/app"
+)
+
+// prefetchInterval is the pause between the media whose subtitles are prefetched, to keep under the rate limits
+const prefetchInterval = 5 * time.Second
+
+// PrefetchSubtitles queues the media of the current torrent that have no subtitles yet, so that their subtitles
+// are downloaded in the background, one media at a time, and playing them does not wait for the providers.
+// A single worker serves the queue until the torrent is closed.
+func (c *Download) PrefetchSubtitles(requests []app.SubtitleRequest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == nil {
+		return
+	}
+	if c.prefetchCtx == nil {
+		c.prefetchCtx, c.prefetchCancel = context.WithCancel(context.Background())
+		c.prefetching = map[string]bool{}
+		c.prefetchWake = make(chan struct{}, 1)
+		go c.prefetchSubtitles(c.prefetchCtx, c.prefetchWake)
+	}
+
+	queued := false
+	for _, r := range requests {
+		if c.prefetching[r.MediaName] {
+			continue
+		}
+		if files, _ := SubtitleFiles(filepath.Join(c.subtitlesRootDir, r.MediaName)); len(files) > 0 {
+			continue
+		}
+		c.prefetching[r.MediaName] = true
+		c.prefetchQueue = append(c.prefetchQueue, r)
+		queued = true
+	}
+
+	if queued {
+		select {
+		case c.prefetchWake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// nextPrefetch takes the next media from the queue
+func (c *Download) nextPrefetch(ctx context.Context) (app.SubtitleRequest, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ctx.Err() != nil || len(c.prefetchQueue) == 0 {
+		return app.SubtitleRequest{}, false
+	}
+	r := c.prefetchQueue[0]
+	c.prefetchQueue = c.prefetchQueue[1:]
+	return r, true
+}
+
+// prefetchSubtitles serves the queue, waiting prefetchInterval between the media, whatever list they were queued from
+func (c *Download) prefetchSubtitles(ctx context.Context, wake <-chan struct{}) {
+	var last time.Time
+	for {
+		r, ok := c.nextPrefetch(ctx)
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-wake:
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(last.Add(prefetchInterval))):
+		}
+		last = time.Now()
+
+		c.prefetch(ctx, r)
+		if ctx.Err() != nil {
+			return
+		}
+
+		c.mu.Lock()
+		delete(c.prefetching, r.MediaName)
+		c.mu.Unlock()
+	}
+}
+
+func (c *Download) prefetch(ctx context.Context, r app.SubtitleRequest) {
+	subsDir := filepath.Join(c.subtitlesRootDir, r.MediaName)
+	// the media may have been played meanwhile
+	if files, _ := SubtitleFiles(subsDir); len(files) > 0 {
+		return
+	}
+
+	settings, err := c.repo.LoadSettings()
+	if err != nil {
+		slog.Error("Failed to load settings to prefetch subtitles", "error", err)
+		return
+	}
+	err = os.MkdirAll(subsDir, os.ModePerm)
+	if err != nil {
+		slog.Error("Failed to create subtitles directory", "dir", subsDir, "error", err)
+		return
+	}
+	found := c.saveSubtitles(ctx, settings, r, subsDir, true)
+	slog.Info("Prefetched subtitles", "media", r.MediaName, "found", found)
+}
+
+// stopPrefetch cancels the prefetch of the subtitles. It must be called with the lock held.
+func (c *Download) stopPrefetch() {
+	if c.prefetchCancel != nil {
+		c.prefetchCancel()
+	}
+	c.prefetchCtx = nil
+	c.prefetchCancel = nil
+	c.prefetchWake = nil
+	c.prefetchQueue = nil
+	c.prefetching = nil
+}
+
+// SubtitleAvailability tells if the subtitles of the media are waiting to be prefetched and how many it has
+func (c *Download) SubtitleAvailability(mediaName string) (pending bool, count int) {
+	c.mu.Lock()
+	pending = c.prefetching[mediaName]
+	c.mu.Unlock()
+
+	files, _ := c.MediaSubtitles(mediaName)
+	return pending, len(files)
+}
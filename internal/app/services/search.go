@@ -1,15 +1,25 @@
 package services
 
 import (
+	"context"
+	"log/slog"
+	"path/filepath"
 	"regexp"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/anacrolix/torrent/metainfo"
+	gohumanize "github.com/dustin/go-humanize"
 	"github.com/quintans/faults"
 	"github.com/quintans/torflix/internal/app"
 	"github.com/quintans/torflix/internal/lib/extractor"
 	"github.com/quintans/torflix/internal/lib/files"
+	"github.com/quintans/torflix/internal/lib/magnet"
+	"github.com/quintans/torflix/internal/lib/proxy"
+	"github.com/quintans/torflix/internal/lib/safety"
+	"github.com/quintans/torflix/internal/lib/scrape"
 	"github.com/quintans/torflix/internal/lib/values"
 	"github.com/quintans/torflix/internal/model"
 	"github.com/quintans/torflix/internal/viewmodel"
@@ -20,6 +30,7 @@ type Search struct {
 	extractors []app.Extractor
 	providers  []string
 	torrentDir string
+	scraper    *scrape.Scraper
 
 	search *model.Search
 }
@@ -60,11 +71,15 @@ func NewSearch(
 		repo.SaveSearch(model)
 	}
 
+	scraper := scrape.New()
+	scraper.DialUDP = proxy.DialUDP
+
 	return &Search{
 		repo:       repo,
 		extractors: extractors,
 		providers:  providers,
 		torrentDir: torrentDir,
+		scraper:    scraper,
 	}, nil
 }
 
@@ -94,6 +109,7 @@ func (c Search) Search(query string, selectedProviders []string) ([]*viewmodel.S
 		return nil, faults.Errorf("loading settings: %w", err)
 	}
 	qualities := settings.Qualities()
+	rules := safetyRules(settings)
 	count := 0
 	ch := make(chan *viewmodel.SearchResult, len(selectedProviders))
 	for _, slug := range selectedProviders {
@@ -112,7 +128,7 @@ func (c Search) Search(query string, selectedProviders []string) ([]*viewmodel.S
 					return
 				}
 
-				r, err := c.transformToMyResult(slug, res, qualities)
+				r, err := c.transformToMyResult(slug, res, qualities, rules)
 				if err != nil {
 					ch <- &viewmodel.SearchResult{
 						Error: faults.Errorf("transforming result from %s: %w", slug, err),
@@ -140,9 +156,98 @@ func (c Search) Search(query string, selectedProviders []string) ([]*viewmodel.S
 	return results, nil
 }
 
+// qualityOf returns the first quality found in the name or empty if none was found
+func qualityOf(name string, qualities []string) string {
+	name = strings.ToLower(name)
+	for _, q := range qualities {
+		if strings.Contains(name, q) {
+			return q
+		}
+	}
+	return ""
+}
+
+func safetyRules(settings *model.Settings) safety.Rules {
+	rules := settings.Safety()
+	rules.MediaExtensions = viewmodel.MediaExtensions
+	return rules
+}
+
+func scanTorrentFile(rules safety.Rules, quality, torrentFile string) (safety.Report, error) {
+	mi, err := metainfo.LoadFromFile(torrentFile)
+	if err != nil {
+		return safety.Report{}, faults.Errorf("loading torrent file '%s': %w", torrentFile, err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return safety.Report{}, faults.Errorf("unmarshalling torrent info '%s': %w", torrentFile, err)
+	}
+
+	var files []safety.File
+	for _, f := range info.UpvertedFiles() {
+		files = append(files, safety.File{
+			Path: f.DisplayPath(&info),
+			Size: f.Length,
+		})
+	}
+
+	return safety.Scan(rules, quality, files), nil
+}
+
+// Scrape asks the trackers of the magnet link, and the fallback trackers, for the real swarm size,
+// checking it against the seeders claimed by the provider
+func (c Search) Scrape(magnetLink string, claimedSeeds int) (viewmodel.ScrapeResult, error) {
+	settings, err := c.repo.LoadSettings()
+	if err != nil {
+		return viewmodel.ScrapeResult{}, faults.Errorf("loading settings: %w", err)
+	}
+
+	mag, err := magnet.Parse(magnetLink)
+	if err != nil {
+		return viewmodel.ScrapeResult{}, faults.Errorf("parsing magnet: %w", err)
+	}
+
+	hash, err := scrape.ParseInfoHash(mag.InfoHash)
+	if err != nil {
+		return viewmodel.ScrapeResult{}, faults.Errorf("parsing info hash: %w", err)
+	}
+
+	trackers := mag.Trackers
+	torrentFile := filepath.Join(c.torrentDir, strings.ToUpper(mag.InfoHash)+".torrent")
+	if files.Exists(torrentFile) {
+		mi, err := metainfo.LoadFromFile(torrentFile)
+		if err != nil {
+			slog.Warn("Failed to load cached torrent file", "file", torrentFile, "error", err)
+		} else {
+			for _, tier := range mi.UpvertedAnnounceList() {
+				trackers = append(trackers, tier...)
+			}
+		}
+	}
+	for _, tr := range settings.FallbackTrackers() {
+		if !slices.Contains(trackers, tr) {
+			trackers = append(trackers, tr)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	res, err := c.scraper.ScrapeAll(ctx, trackers, hash)
+	if err != nil {
+		return viewmodel.ScrapeResult{}, faults.Errorf("scraping trackers: %w", err)
+	}
+
+	return viewmodel.ScrapeResult{
+		Seeders:   res.Seeders,
+		Leechers:  res.Leechers,
+		FakeSeeds: safetyRules(settings).FakeSeeded(claimedSeeds, res.Seeders),
+	}, nil
+}
+
 var reHash = regexp.MustCompile(`urn:btih:([a-fA-F0-9]+)`)
 
-func (c Search) transformToMyResult(slug string, r []extractor.Result, qualities []string) ([]*viewmodel.SearchData, error) {
+func (c Search) transformToMyResult(slug string, r []extractor.Result, qualities []string, rules safety.Rules) ([]*viewmodel.SearchData, error) {
 	var results []*viewmodel.SearchData
 	for _, r := range r {
 		rep := strings.NewReplacer(",", "", ".", "")
@@ -157,28 +262,30 @@ func (c Search) transformToMyResult(slug string, r []extractor.Result, qualities
 			hash = match[1]
 		}
 
+		torrentFile := filepath.Join(c.torrentDir, strings.ToUpper(hash)+".torrent")
 		result := &viewmodel.SearchData{
-			Provider: values.Coalesce(r.Source, slug),
-			Name:     r.Name,
-			Magnet:   r.Magnet,
-			Size:     r.Size,
-			Seeds:    seeds,
-			Cached:   files.Exists(c.torrentDir, strings.ToUpper(hash)+".torrent"),
-			Hash:     hash,
+			Provider:     values.Coalesce(r.Source, slug),
+			Name:         r.Name,
+			Magnet:       r.Magnet,
+			Size:         r.Size,
+			Seeds:        seeds,
+			ClaimedSeeds: seeds,
+			Cached:       hash != "" && files.Exists(torrentFile),
+			Hash:         hash,
 		}
 
-		name := strings.ToLower(r.Name)
-		for i, q := range qualities {
-			if strings.Contains(name, q) {
-				result.Quality = i + 1
-				break
-			}
-		}
+		quality := qualityOf(r.Name, qualities)
+		result.Quality = slices.Index(qualities, quality) + 1
+		result.QualityName = values.Coalesce(quality, "SD")
 
-		if result.Quality != 0 {
-			result.QualityName = qualities[result.Quality-1]
+		if result.Cached {
+			result.Safety, err = scanTorrentFile(rules, quality, torrentFile)
+			if err != nil {
+				slog.Warn("Failed to scan cached torrent file", "file", torrentFile, "error", err)
+			}
 		} else {
-			result.QualityName = "SD"
+			size, _ := gohumanize.ParseBytes(r.Size)
+			result.Safety = safety.ScanName(rules, quality, r.Name, int64(size))
 		}
 
 		results = append(results, result)
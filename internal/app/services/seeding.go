@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/quintans/faults"
+	"github.com/quintans/torflix/internal/app"
+	"github.com/quintans/torflix/internal/lib/seeding"
+	"github.com/quintans/torflix/internal/model"
+)
+
+// Seeding supervises the torrent being transferred, keeping the time it seeds
+// and stopping the seeding when the goals of its policy are reached.
+// The bytes transferred are the lifetime totals of the collector.
+type Seeding struct {
+	repo      Repository
+	download  *Download
+	collector *Collector
+
+	mu       sync.Mutex
+	last     *app.Transfer
+	lastTick time.Time
+}
+
+func NewSeeding(repo Repository, download *Download, collector *Collector) *Seeding {
+	return &Seeding{
+		repo:      repo,
+		download:  download,
+		collector: collector,
+	}
+}
+
+// Run checks the transfer every interval until the context is done
+func (s *Seeding) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			err := s.tick(now)
+			if err != nil {
+				slog.Error("Failed to supervise seeding", "error", err)
+			}
+		}
+	}
+}
+
+func (s *Seeding) tick(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tr, ok := s.download.Transfer()
+	if !ok || tr.InfoHash == "" {
+		s.last = nil
+		return nil
+	}
+
+	settings, err := s.repo.LoadSettings()
+	if err != nil {
+		return faults.Errorf("loading settings: %w", err)
+	}
+	records, err := s.repo.LoadSeeding()
+	if err != nil {
+		return faults.Errorf("loading seeding: %w", err)
+	}
+
+	// the counters restart with every session
+	var uploaded bool
+	var elapsed time.Duration
+	if s.last != nil && s.last.InfoHash == tr.InfoHash && s.last.Started.Equal(tr.Started) {
+		uploaded = tr.Uploaded > s.last.Uploaded
+		elapsed = now.Sub(s.lastTick)
+	}
+	s.last = &tr
+	s.lastTick = now
+
+	if !tr.Seeding {
+		return nil
+	}
+
+	transfer, _, err := s.collector.Totals(tr.InfoHash)
+	if err != nil {
+		return err
+	}
+
+	rec := records[tr.InfoHash]
+	totals := rec.Totals(transfer).Seed(elapsed, uploaded)
+	rec.Seeding, rec.Idle = totals.Seeding, totals.Idle
+	records[tr.InfoHash] = rec
+
+	var reason string
+	done := !settings.SeedAfterComplete()
+	if done {
+		reason = "seeding after complete is disabled"
+	} else {
+		done, reason = policyOf(settings, rec).Done(totals)
+	}
+	if done {
+		slog.Info("Stopping seeding", "hash", tr.InfoHash, "reason", reason)
+		s.download.StopSeeding()
+	}
+
+	if elapsed == 0 {
+		return nil
+	}
+
+	err = s.repo.SaveSeeding(records)
+	if err != nil {
+		return faults.Errorf("saving seeding: %w", err)
+	}
+
+	return nil
+}
+
+func policyOf(settings *model.Settings, rec model.TorrentSeeding) seeding.Policy {
+	if rec.Policy != nil {
+		return *rec.Policy
+	}
+	return settings.SeedingPolicy()
+}
+
+// Status returns the lifetime totals of the torrent and the policy that applies to it
+func (s *Seeding) Status(hash string) (seeding.Totals, seeding.Policy, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings, err := s.repo.LoadSettings()
+	if err != nil {
+		return seeding.Totals{}, seeding.Policy{}, false, faults.Errorf("loading settings: %w", err)
+	}
+	records, err := s.repo.LoadSeeding()
+	if err != nil {
+		return seeding.Totals{}, seeding.Policy{}, false, faults.Errorf("loading seeding: %w", err)
+	}
+
+	transfer, _, err := s.collector.Totals(hash)
+	if err != nil {
+		return seeding.Totals{}, seeding.Policy{}, false, err
+	}
+
+	rec := records[hash]
+	return rec.Totals(transfer), policyOf(settings, rec), rec.Policy != nil, nil
+}
+
+// SetPolicy sets the policy of a torrent. A nil policy makes the torrent follow the global policy.
+func (s *Seeding) SetPolicy(hash string, policy *seeding.Policy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.repo.LoadSeeding()
+	if err != nil {
+		return faults.Errorf("loading seeding: %w", err)
+	}
+
+	rec := records[hash]
+	rec.Policy = policy
+	records[hash] = rec
+
+	err = s.repo.SaveSeeding(records)
+	if err != nil {
+		return faults.Errorf("saving seeding: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Seeding) GlobalPolicy() (seeding.Policy, error) {
+	settings, err := s.repo.LoadSettings()
+	if err != nil {
+		return seeding.Policy{}, faults.Errorf("loading settings: %w", err)
+	}
+	return settings.SeedingPolicy(), nil
+}
+
+func (s *Seeding) SetGlobalPolicy(policy seeding.Policy) error {
+	err := s.repo.UpdateSettings(func(settings *model.Settings) {
+		settings.SetSeedingPolicy(policy)
+	})
+	if err != nil {
+		return faults.Errorf("saving settings: %w", err)
+	}
+
+	return nil
+}
@@ -6,5 +6,11 @@ type Repository interface {
 	LoadSearch() (*model.Search, error)
 	SaveSearch(search *model.Search) error
 	LoadSettings() (*model.Settings, error)
-	SaveSettings(model *model.Settings) error
+	UpdateSettings(update func(settings *model.Settings)) error
+	LoadSeeding() (map[string]model.TorrentSeeding, error)
+	SaveSeeding(seeding map[string]model.TorrentSeeding) error
+	LoadTransfers() (*model.Transfers, error)
+	SaveTransfers(transfers *model.Transfers) error
+	LoadHistory() (*model.WatchHistory, error)
+	SaveHistory(history *model.WatchHistory) error
 }
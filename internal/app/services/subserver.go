@@ -0,0 +1,164 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/quintans/faults"
+	"github.com/quintans/torflix/internal/lib/lang"
+	"github.com/quintans/torflix/internal/lib/subtitles"
+)
+
+// subtitlesPath prefixes the subtitle endpoints of the stream server:
+// /subs/<media>/ lists the tracks and /subs/<media>/<file>.vtt or .srt serves one, converted if needed
+const subtitlesPath = "/subs/"
+
+// subtitleTrack is an entry of the subtitles index of a stream
+type subtitleTrack struct {
+	Name     string `json:"name"`
+	Language string `json:"language,omitempty"`
+	VTT      string `json:"vtt"`
+	SRT      string `json:"srt"`
+}
+
+// subtitlesHandler serves the subtitles of the media, for the players of other devices
+func (c *Download) subtitlesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		// browsers only load tracks from another origin if allowed
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		mediaName, file, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, subtitlesPath), "/")
+		if !validName(mediaName) || (file != "" && !validName(file)) {
+			http.NotFound(w, r)
+			return
+		}
+
+		if file == "" {
+			c.serveSubtitlesIndex(w, r, mediaName)
+			return
+		}
+		c.serveSubtitle(w, r, mediaName, file)
+	})
+}
+
+func (c *Download) serveSubtitlesIndex(w http.ResponseWriter, r *http.Request, mediaName string) {
+	tracks, err := c.subtitleTracks("http://"+r.Host, mediaName)
+	if err != nil {
+		slog.Error("Failed to list subtitles", "media", mediaName, "error", err)
+		http.Error(w, "failed to list subtitles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(tracks)
+	if err != nil {
+		slog.Error("Failed to write subtitles index", "error", err)
+	}
+}
+
+func (c *Download) serveSubtitle(w http.ResponseWriter, r *http.Request, mediaName, file string) {
+	ext := filepath.Ext(file)
+	format, ok := subtitles.FormatOf(file)
+	if !ok || format == subtitles.ASS {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := c.convertSubtitle(filepath.Join(c.subtitlesRootDir, mediaName), strings.TrimSuffix(file, ext), format)
+	if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to serve subtitle", "media", mediaName, "file", file, "error", err)
+		http.Error(w, "failed to convert subtitle", http.StatusInternalServerError)
+		return
+	}
+
+	contentType := "application/x-subrip; charset=utf-8"
+	if format == subtitles.VTT {
+		contentType = "text/vtt; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	_, _ = w.Write(data)
+}
+
+// convertSubtitle reads the subtitle file of the directory with the name, whatever its format, in the given format
+func (c *Download) convertSubtitle(dir, name string, format subtitles.Format) ([]byte, error) {
+	names, err := SubtitleFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range names {
+		from, ok := subtitles.FormatOf(n)
+		if !ok || strings.TrimSuffix(n, filepath.Ext(n)) != name {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, n))
+		if err != nil {
+			return nil, faults.Errorf("reading subtitle: %w", err)
+		}
+		data = subtitles.ToUTF8(data, "")
+		if from == format {
+			return data, nil
+		}
+
+		s, err := subtitles.Parse(data, from)
+		if err != nil {
+			return nil, faults.Errorf("parsing subtitle '%s': %w", n, err)
+		}
+		return s.Encode(format), nil
+	}
+	return nil, faults.Errorf("subtitle '%s': %w", name, os.ErrNotExist)
+}
+
+// subtitleTracks returns the subtitles of the media served by the stream server at the base URL
+func (c *Download) subtitleTracks(baseURL, mediaName string) ([]subtitleTrack, error) {
+	names, err := c.MediaSubtitles(mediaName)
+	if err != nil {
+		return nil, err
+	}
+
+	tracks := []subtitleTrack{}
+	for _, n := range names {
+		// MicroDVD files can not be converted
+		if _, ok := subtitles.FormatOf(n); !ok {
+			continue
+		}
+		tracks = append(tracks, subtitleTrack{
+			Name:     n,
+			Language: lang.OfFilename(n),
+			VTT:      subtitleURL(baseURL, mediaName, n, subtitles.VTT),
+			SRT:      subtitleURL(baseURL, mediaName, n, subtitles.SRT),
+		})
+	}
+	return tracks, nil
+}
+
+// localBaseURL is the address of the stream server for the players of this machine
+func localBaseURL(port int) string {
+	return fmt.Sprintf("http://localhost:%d", port)
+}
+
+func subtitleURL(baseURL, mediaName, name string, format subtitles.Format) string {
+	file := strings.TrimSuffix(name, filepath.Ext(name)) + "." + string(format)
+	return fmt.Sprintf("%s%s%s/%s", baseURL, subtitlesPath, url.PathEscape(mediaName), url.PathEscape(file))
+}
+
+// validName tells if the name is a single path element
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
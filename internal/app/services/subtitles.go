@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/quintans/faults"
+	"github.com/quintans/torflix/internal/app"
+	"github.com/quintans/torflix/internal/lib/subtitles"
+)
+
+// normalizeSubtitle re-encodes the downloaded subtitle to UTF-8 and removes its ads
+func normalizeSubtitle(data []byte, sub app.Subtitle) []byte {
+	return subtitles.Normalize(data, sub.Filename, sub.Language)
+}
+
+// CorrectSubtitle shifts a subtitle file of the media by the offset and, if both are set, changes its frame rate,
+// for subtitles made for another release of the media
+func (c *Download) CorrectSubtitle(ctx context.Context, mediaName, name string, offset time.Duration, fromFPS, toFPS float64) error {
+	// the name must not leave the directory
+	if filepath.Base(name) != name {
+		return faults.Errorf("invalid subtitle name '%s'", name)
+	}
+	format, ok := subtitles.FormatOf(name)
+	if !ok {
+		return faults.Errorf("unsupported subtitle format of '%s'", name)
+	}
+
+	path := filepath.Join(c.subtitlesRootDir, mediaName, name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return faults.Errorf("reading subtitle: %w", err)
+	}
+	s, err := subtitles.Parse(subtitles.ToUTF8(data, ""), format)
+	if err != nil {
+		return faults.Errorf("parsing subtitle '%s': %w", name, err)
+	}
+
+	s.ChangeFrameRate(fromFPS, toFPS)
+	s.Shift(offset)
+	err = os.WriteFile(path, s.Encode(format), 0o644)
+	if err != nil {
+		return faults.Errorf("writing subtitle: %w", err)
+	}
+
+	err = c.loadSubtitle(ctx, mediaName, name)
+	if err != nil {
+		slog.Warn("Failed to load the corrected subtitle in the player", "error", err)
+	}
+	return nil
+}
+
+// previewCues is the number of cues shown in a preview
+const previewCues = 5
+
+// SearchSubtitles searches the enabled providers with the query of the user, sorting the results without leaving any out
+func (c *Download) SearchSubtitles(ctx context.Context, query app.SubtitleQuery) ([]app.Subtitle, error) {
+	settings, err := c.repo.LoadSettings()
+	if err != nil {
+		return nil, faults.Errorf("loading settings: %w", err)
+	}
+	if len(query.Languages) == 0 {
+		query.Languages = settings.Languages()
+	}
+	var movieHash func() string
+	if query.File != nil {
+		movieHash = func() string {
+			return c.movieHash(ctx, query.File)
+		}
+	}
+
+	found := searchSubtitles(ctx, c.enabledProviders(settings.SubtitleSources()), query, movieHash)
+	c.sortSubtitles(found, query.Languages, releaseOf(query.File))
+	return found, nil
+}
+
+// PreviewSubtitle returns the first lines of the subtitle.
+// The content is kept, so downloading it after does not count again in the provider quota.
+func (c *Download) PreviewSubtitle(ctx context.Context, sub app.Subtitle) (string, error) {
+	data, err := c.fetchSubtitle(ctx, sub)
+	if err != nil {
+		return "", err
+	}
+	data = normalizeSubtitle(data, sub)
+
+	format, ok := subtitles.FormatOf(sub.Filename)
+	if !ok {
+		return firstLines(string(data), previewCues*2), nil
+	}
+	s, err := subtitles.Parse(data, format)
+	if err != nil {
+		return firstLines(string(data), previewCues*2), nil
+	}
+
+	var sb strings.Builder
+	for _, cue := range s.Cues[:min(len(s.Cues), previewCues)] {
+		fmt.Fprintf(&sb, "%s  %s\n", cue.Start.Truncate(time.Second), strings.ReplaceAll(cue.Text, "\n", " / "))
+	}
+	return sb.String(), nil
+}
+
+// DownloadSubtitle saves the subtitle in the subtitles directory of the media, returning the file name.
+// Live subtitles keep the name they are extracted to, so the extraction keeps updating them.
+func (c *Download) DownloadSubtitle(ctx context.Context, mediaName string, sub app.Subtitle) (string, error) {
+	subsDir, err := c.SubtitlesDir(mediaName)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := c.fetchSubtitle(ctx, sub)
+	if err != nil {
+		return "", err
+	}
+
+	name := sub.Filename
+	if !sub.Live {
+		for i := 0; ; i++ {
+			name = insertLang(i, sub.Filename, sub.Language)
+			if _, err := os.Stat(filepath.Join(subsDir, name)); errors.Is(err, os.ErrNotExist) {
+				break
+			}
+		}
+	}
+
+	err = os.WriteFile(filepath.Join(subsDir, name), normalizeSubtitle(data, sub), 0o644)
+	if err != nil {
+		return "", faults.Errorf("saving subtitle: %w", err)
+	}
+
+	err = c.loadSubtitle(ctx, mediaName, name)
+	if err != nil {
+		slog.Warn("Failed to load the subtitle in the player", "error", err)
+	}
+	return name, nil
+}
+
+// SubtitlesDir returns the subtitles directory of the media, creating it if needed
+func (c *Download) SubtitlesDir(mediaName string) (string, error) {
+	subsDir := filepath.Join(c.subtitlesRootDir, mediaName)
+	err := os.MkdirAll(subsDir, os.ModePerm)
+	if err != nil {
+		return "", faults.Errorf("creating subtitles directory: %w", err)
+	}
+	return subsDir, nil
+}
+
+// DeleteSubtitle removes a subtitle file from the subtitles directory of the media
+func (c *Download) DeleteSubtitle(mediaName, name string) error {
+	// the name must not leave the directory
+	if filepath.Base(name) != name {
+		return faults.Errorf("invalid subtitle name '%s'", name)
+	}
+	err := os.Remove(filepath.Join(c.subtitlesRootDir, mediaName, name))
+	if err != nil {
+		return faults.Errorf("deleting subtitle: %w", err)
+	}
+	return nil
+}
+
+// MediaSubtitles returns the names of the subtitle files of the media
+func (c *Download) MediaSubtitles(mediaName string) ([]string, error) {
+	return SubtitleFiles(filepath.Join(c.subtitlesRootDir, mediaName))
+}
+
+// SubtitleFiles returns the names of the subtitle files in the directory, or none if it does not exist
+func SubtitleFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, faults.Errorf("reading subtitles directory: %w", err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if _, ok := subtitles.FormatOf(e.Name()); ok || strings.EqualFold(filepath.Ext(e.Name()), ".sub") {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// fetchSubtitle downloads the subtitle from its provider, once for each torrent, except for the live ones that grow
+func (c *Download) fetchSubtitle(ctx context.Context, sub app.Subtitle) ([]byte, error) {
+	key := sub.Provider + ":" + sub.ID
+	c.mu.Lock()
+	data, ok := c.fetched[key]
+	c.mu.Unlock()
+	if ok {
+		return data, nil
+	}
+
+	provider := c.provider(sub.Provider)
+	if provider == nil {
+		return nil, faults.Errorf("unknown subtitle provider '%s'", sub.Provider)
+	}
+	data, err := provider.Download(ctx, sub)
+	if err != nil {
+		return nil, faults.Errorf("downloading subtitle from %s: %w", sub.Provider, err)
+	}
+
+	if !sub.Live {
+		c.mu.Lock()
+		if c.fetched == nil {
+			c.fetched = map[string][]byte{}
+		}
+		c.fetched[key] = data
+		c.mu.Unlock()
+	}
+	return data, nil
+}
+
+func firstLines(text string, n int) string {
+	lines := strings.SplitN(text, "\n", n+1)
+	return strings.Join(lines[:min(len(lines), n)], "\n")
+}
@@ -1,11 +1,22 @@
 package app
 
-import "github.com/anacrolix/torrent"
+import (
+	"github.com/anacrolix/torrent"
+	"github.com/quintans/torflix/internal/lib/safety"
+)
 
 type AppParams struct {
 	Query string
 }
 
+type PreviewParams struct {
+	Files         []*torrent.File
+	Info          TorrentInfo
+	Safety        safety.Report
+	OriginalQuery string
+	Subtitles     bool
+}
+
 type DownloadListParams struct {
 	Files         []*torrent.File
 	OriginalQuery string
@@ -15,9 +15,16 @@ type MagnetItem struct {
 	Name     string
 	Size     string
 	Seeds    string
-	Quality  string
-	Magnet   string
-	Cached   bool
+	// Peers is the number of leechers. Empty if unknown
+	Peers   string
+	Quality string
+	Magnet  string
+	Cached  bool
+	// Fake marks a result whose seeds were not confirmed by the trackers
+	Fake bool
+	// Safety is the safety level name. Empty if there is nothing to report
+	Safety      string
+	SafetyBlock bool
 }
 
 type MagnetListItem struct {
@@ -29,6 +36,8 @@ type MagnetListItem struct {
 	Seeds    *widget.Label
 	Quality  *Pill
 	Cached   *Pill
+	Safety   *Pill
+	Fake     *Pill
 }
 
 func NewMagnetListItem() *MagnetListItem {
@@ -39,7 +48,10 @@ func NewMagnetListItem() *MagnetListItem {
 		Seeds:    widget.NewLabel(""),
 		Cached:   NewPill("Cached"),
 		Quality:  NewPill(""),
+		Safety:   NewPill(""),
+		Fake:     NewPill("FAKE SEEDS"),
 	}
+	li.Fake.SetColor(color.RGBA{255, 0, 0, 255})
 	li.ExtendBaseWidget(li)
 	return li
 }
@@ -47,7 +59,16 @@ func NewMagnetListItem() *MagnetListItem {
 func (item *MagnetListItem) SetData(data *MagnetItem) {
 	item.Provider.SetText("Source: " + data.Provider)
 	item.Name.SetText(data.Name)
-	item.Seeds.SetText("Seeds: " + data.Seeds)
+	if data.Peers != "" {
+		item.Seeds.SetText("Seeds: " + data.Seeds + "  Peers: " + data.Peers)
+	} else {
+		item.Seeds.SetText("Seeds: " + data.Seeds)
+	}
+	if data.Fake {
+		item.Fake.Show()
+	} else {
+		item.Fake.Hide()
+	}
 	item.Bytes.SetText(data.Size)
 	item.Quality.SetText(data.Quality)
 	if data.Cached {
@@ -55,6 +76,17 @@ func (item *MagnetListItem) SetData(data *MagnetItem) {
 	} else {
 		item.Cached.Hide()
 	}
+	if data.Safety != "" {
+		item.Safety.SetText(data.Safety)
+		if data.SafetyBlock {
+			item.Safety.SetColor(color.RGBA{255, 0, 0, 255})
+		} else {
+			item.Safety.SetColor(color.RGBA{255, 165, 0, 255})
+		}
+		item.Safety.Show()
+	} else {
+		item.Safety.Hide()
+	}
 }
 
 func (item *MagnetListItem) CreateRenderer() fyne.WidgetRenderer {
@@ -62,6 +94,8 @@ func (item *MagnetListItem) CreateRenderer() fyne.WidgetRenderer {
 		item.Name,
 		container.NewHBox(
 			item.Quality,
+			item.Safety,
+			item.Fake,
 			item.Seeds,
 			item.Bytes,
 			layout.NewSpacer(),
@@ -40,6 +40,11 @@ func (p *Pill) SetText(text string) {
 	p.Refresh()
 }
 
+func (p *Pill) SetColor(c color.Color) {
+	p.rectangle.FillColor = c
+	p.rectangle.Refresh()
+}
+
 func (p *Pill) updateSelection() {
 	ms := p.text.MinSize()
 	p.rectangle.SetMinSize(fyne.NewSize(ms.Width+10, ms.Height+5))
@@ -0,0 +1,118 @@
+package components
+
+import (
+	"image/color"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+var (
+	downloadColor = color.NRGBA{0, 255, 0, 255}   // Green line
+	uploadColor   = color.NRGBA{255, 165, 0, 255} // Orange line
+)
+
+// SpeedGraph draws the recent download and upload rates, from the oldest to the newest,
+// scaled to the highest rate.
+type SpeedGraph struct {
+	widget.BaseWidget
+	download []float64
+	upload   []float64
+	// capacity is the number of samples that fill the width
+	capacity int
+}
+
+func NewSpeedGraph(capacity int) *SpeedGraph {
+	w := &SpeedGraph{
+		capacity: capacity,
+	}
+	w.ExtendBaseWidget(w)
+	return w
+}
+
+func (w *SpeedGraph) CreateRenderer() fyne.WidgetRenderer {
+	background := canvas.NewRectangle(color.NRGBA{0, 0, 64, 255}) // Dark blue background
+	objects := []fyne.CanvasObject{background}
+
+	return &speedGraphRenderer{
+		widget:     w,
+		background: background,
+		objects:    objects,
+	}
+}
+
+func (w *SpeedGraph) SetSamples(download, upload []float64) {
+	w.download = download
+	w.upload = upload
+	w.Refresh()
+}
+
+type speedGraphRenderer struct {
+	widget     *SpeedGraph
+	background *canvas.Rectangle
+	objects    []fyne.CanvasObject
+}
+
+func (r *speedGraphRenderer) Layout(size fyne.Size) {
+	r.background.Resize(size)
+
+	// Remove old lines before creating new ones
+	if len(r.objects) > 1 {
+		r.objects = r.objects[:1]
+	}
+
+	var top float64
+	for _, s := range [][]float64{r.widget.download, r.widget.upload} {
+		for _, v := range s {
+			top = max(top, v)
+		}
+	}
+	if top == 0 {
+		return
+	}
+
+	step := size.Width / float32(max(r.widget.capacity-1, 1))
+	r.addLines(r.widget.upload, uploadColor, size, step, top)
+	r.addLines(r.widget.download, downloadColor, size, step, top)
+
+	// Layout objects:
+	for _, obj := range r.objects {
+		obj.Refresh()
+	}
+}
+
+// addLines draws the samples aligned to the right, so that the newest is always at the edge
+func (r *speedGraphRenderer) addLines(samples []float64, c color.Color, size fyne.Size, step float32, top float64) {
+	offset := size.Width - step*float32(len(samples)-1)
+	point := func(i int) fyne.Position {
+		return fyne.NewPos(offset+step*float32(i), size.Height-float32(samples[i]/top)*size.Height)
+	}
+	for i := 1; i < len(samples); i++ {
+		line := canvas.NewLine(c)
+		line.StrokeWidth = 2
+		line.Position1 = point(i - 1)
+		line.Position2 = point(i)
+		r.objects = append(r.objects, line)
+	}
+}
+
+func (r *speedGraphRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(100, 60)
+}
+
+func (r *speedGraphRenderer) Refresh() {
+	r.Layout(r.widget.Size())
+	canvas.Refresh(r.widget)
+}
+
+func (r *speedGraphRenderer) BackgroundColor() color.Color {
+	return theme.BackgroundColor()
+}
+
+func (r *speedGraphRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+func (r *speedGraphRenderer) Destroy() {}
@@ -0,0 +1,115 @@
+// Package localsubs finds subtitles in local folders, by matching their names with the media.
+package localsubs
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/quintans/faults"
+	"github.com/quintans/torflix/internal/app"
+	"github.com/quintans/torflix/internal/lib/lang"
+)
+
+const ProviderName = "local"
+
+var (
+	extensions = []string{".srt", ".ass", ".ssa", ".vtt", ".sub"}
+	separators = regexp.MustCompile(`[\s._\-\[\]()]+`)
+)
+
+// Folders returns the folders to search
+type Folders func() ([]string, error)
+
+type Provider struct {
+	folders Folders
+}
+
+func NewProvider(folders Folders) *Provider {
+	return &Provider{
+		folders: folders,
+	}
+}
+
+func (p *Provider) Name() string {
+	return ProviderName
+}
+
+// Search finds the subtitles whose names have every word of the query and, for episodes, the season and episode
+func (p *Provider) Search(ctx context.Context, query app.SubtitleQuery) ([]app.Subtitle, error) {
+	folders, err := p.folders()
+	if err != nil {
+		return nil, faults.Errorf("getting folders: %w", err)
+	}
+
+	words := strings.Fields(normalize(query.Query))
+	var episode *regexp.Regexp
+	if query.Season > 0 || query.Episode > 0 {
+		episode = regexp.MustCompile(`\bs0*` + strconv.Itoa(query.Season) + `\s*e0*` + strconv.Itoa(query.Episode) + `\b`)
+	}
+
+	var subtitles []app.Subtitle
+	for _, folder := range folders {
+		err := filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// unreadable entries are skipped
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if d.IsDir() || !slices.Contains(extensions, strings.ToLower(filepath.Ext(path))) {
+				return nil
+			}
+
+			name := normalize(d.Name())
+			if !matches(name, words) || (episode != nil && !episode.MatchString(name)) {
+				return nil
+			}
+			language := lang.OfFilename(d.Name())
+			if language != "" && len(query.Languages) > 0 && lang.Rank(language, query.Languages) == len(query.Languages) {
+				return nil
+			}
+
+			subtitles = append(subtitles, app.Subtitle{
+				Provider: ProviderName,
+				ID:       path,
+				Language: language,
+				Filename: d.Name(),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, faults.Errorf("searching folder '%s': %w", folder, err)
+		}
+	}
+
+	return subtitles, nil
+}
+
+func (p *Provider) Download(_ context.Context, sub app.Subtitle) ([]byte, error) {
+	data, err := os.ReadFile(sub.ID)
+	if err != nil {
+		return nil, faults.Errorf("reading subtitle: %w", err)
+	}
+	return data, nil
+}
+
+// normalize lower cases the name, replacing the separators by spaces
+func normalize(name string) string {
+	return " " + strings.TrimSpace(separators.ReplaceAllString(strings.ToLower(name), " ")) + " "
+}
+
+func matches(name string, words []string) bool {
+	for _, w := range words {
+		if !strings.Contains(name, " "+w+" ") {
+			return false
+		}
+	}
+	return true
+}
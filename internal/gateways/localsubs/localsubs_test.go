@@ -0,0 +1,47 @@
+package localsubs_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/quintans/torflix/internal/app"
+	"github.com/quintans/torflix/internal/gateways/localsubs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearch(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"The.Lioness.S02E01.1080p.en.srt",
+		"The.Lioness.S02E01.720p.HDR.srt",
+		"The.Lioness.S02E01.fre.srt",
+		"The.Lioness.S02E02.en.srt",
+		"Another.Show.S02E01.en.srt",
+		"The.Lioness.S02E01.en.txt",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644))
+	}
+
+	p := localsubs.NewProvider(func() ([]string, error) {
+		return []string{dir}, nil
+	})
+	subs, err := p.Search(context.Background(), app.SubtitleQuery{
+		Query:     "the lioness",
+		Season:    2,
+		Episode:   1,
+		Languages: []string{"pt-PT", "en"},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, subs, 2)
+	require.Equal(t, "The.Lioness.S02E01.1080p.en.srt", subs[0].Filename)
+	require.Equal(t, "en", subs[0].Language)
+	require.Equal(t, "The.Lioness.S02E01.720p.HDR.srt", subs[1].Filename)
+	require.Empty(t, subs[1].Language)
+
+	data, err := p.Download(context.Background(), subs[0])
+	require.NoError(t, err)
+	require.Equal(t, "The.Lioness.S02E01.1080p.en.srt", string(data))
+}
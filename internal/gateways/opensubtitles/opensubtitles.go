@@ -8,6 +8,7 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/quintans/faults"
 	"github.com/quintans/torflix/internal/app"
@@ -34,6 +35,20 @@ func IsAvailable() bool {
 
 type LoginResponse struct {
 	Token string `json:"token"`
+	// BaseURL is the host for the requests of the user, that is another one for VIP users
+	BaseURL string `json:"base_url"`
+	User    struct {
+		AllowedDownloads int  `json:"allowed_downloads"`
+		VIP              bool `json:"vip"`
+	} `json:"user"`
+}
+
+type UserInfo struct {
+	AllowedDownloads   int  `json:"allowed_downloads"`
+	RemainingDownloads int  `json:"remaining_downloads"`
+	VIP                bool `json:"vip"`
+	// ResetTimeUTC is when the quota resets, in RFC 3339, if known
+	ResetTimeUTC string `json:"reset_time_utc"`
 }
 
 type SearchResponse struct {
@@ -43,14 +58,50 @@ type SearchResponse struct {
 }
 
 type SubtitleAttributes struct {
-	SubtitleID string `json:"subtitle_id"`
-	Language   string `json:"language"`
-	Files      []struct {
+	SubtitleID        string  `json:"subtitle_id"`
+	Language          string  `json:"language"`
+	MoviehashMatch    bool    `json:"moviehash_match"`
+	DownloadCount     int     `json:"download_count"`
+	Ratings           float64 `json:"ratings"`
+	HearingImpaired   bool    `json:"hearing_impaired"`
+	FPS               float64 `json:"fps"`
+	Release           string  `json:"release"`
+	FromTrusted       bool    `json:"from_trusted"`
+	AITranslated      bool    `json:"ai_translated"`
+	MachineTranslated bool    `json:"machine_translated"`
+	Files             []struct {
 		FileID   int    `json:"file_id"`
 		Filename string `json:"file_name"`
 	} `json:"files"`
 }
 
+// Subtitle is a subtitle found by a search
+type Subtitle struct {
+	ID       string
+	Language string
+	FileID   int
+	Filename string
+	// HashMatch is set when the subtitle matches the movie hash of the search
+	HashMatch         bool
+	Release           string
+	Downloads         int
+	Rating            float64
+	HearingImpaired   bool
+	FPS               float64
+	Trusted           bool
+	AITranslated      bool
+	MachineTranslated bool
+}
+
+type DownloadResponse struct {
+	Link     string `json:"link"`
+	Filename string `json:"file_name"`
+	// Requests is the number of downloads in the current quota period
+	Requests     int       `json:"requests"`
+	Remaining    int       `json:"remaining"`
+	ResetTimeUTC time.Time `json:"reset_time_utc"`
+}
+
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
@@ -63,9 +114,14 @@ type OpenSubtitles struct {
 }
 
 func New(username, password string) *OpenSubtitles {
+	return NewWithURL(BaseURL, username, password)
+}
+
+// NewWithURL creates a client for another server, like a fake one in tests
+func NewWithURL(baseURL, username, password string) *OpenSubtitles {
 	return &OpenSubtitles{
 		client: https.Client{
-			BaseURL: BaseURL,
+			BaseURL: baseURL,
 			Header: http.Header{
 				"Api-Key":      {apiKey},
 				"User-Agent":   {fmt.Sprintf("%s v%s", app.Name, app.Version)},
@@ -79,7 +135,7 @@ func New(username, password string) *OpenSubtitles {
 }
 
 // Login authenticates and retrieves a Bearer token using username and password
-func (o *OpenSubtitles) Login() (string, error) {
+func (o *OpenSubtitles) Login() (LoginResponse, error) {
 	loginData := LoginRequest{
 		Username: o.username,
 		Password: o.password,
@@ -88,10 +144,34 @@ func (o *OpenSubtitles) Login() (string, error) {
 	var loginResp LoginResponse
 	err := o.request(http.MethodPost, "/login", "", loginData, &loginResp)
 	if err != nil {
-		return "", faults.Errorf("logging in: %w", err)
+		return LoginResponse{}, faults.Errorf("logging in: %w", err)
+	}
+
+	return loginResp, nil
+}
+
+// SetHost sends the next requests to another host, keeping the scheme and the path of the API
+func (o *OpenSubtitles) SetHost(host string) error {
+	u, err := url.Parse(o.client.BaseURL)
+	if err != nil {
+		return faults.Errorf("parsing base URL '%s': %w", o.client.BaseURL, err)
+	}
+	u.Host = host
+	o.client.BaseURL = u.String()
+	return nil
+}
+
+// UserInfo returns the download quota of the user
+func (o *OpenSubtitles) UserInfo(token string) (UserInfo, error) {
+	var res struct {
+		Data UserInfo `json:"data"`
+	}
+	err := o.request(http.MethodGet, "/infos/user", token, nil, &res)
+	if err != nil {
+		return UserInfo{}, faults.Errorf("getting user info: %w", err)
 	}
 
-	return loginResp.Token, nil
+	return res.Data, nil
 }
 
 // Logout invalidates the access token
@@ -104,8 +184,9 @@ func (o *OpenSubtitles) Logout(token string) error {
 	return nil
 }
 
-// Search searches for subtitles in specified languages for a given query
-func (o *OpenSubtitles) Search(query string, season, episode int, languages []string) ([]app.SubtitleAttributes, error) {
+// Search searches for subtitles in specified languages for a given query.
+// The movie hash, if not empty, marks the subtitles made for the file.
+func (o *OpenSubtitles) Search(query, moviehash string, season, episode int, languages []string) ([]Subtitle, error) {
 	type Params struct {
 		Key, Value string
 	}
@@ -117,6 +198,9 @@ func (o *OpenSubtitles) Search(query string, season, episode int, languages []st
 	params := []Params{
 		{"query", url.QueryEscape(query)},
 	}
+	if moviehash != "" {
+		params = append(params, Params{"moviehash", moviehash})
+	}
 	if len(languages) > 0 {
 		params = append(params, Params{"languages", strings.Join(languages, ",")})
 	}
@@ -155,7 +239,7 @@ func (o *OpenSubtitles) Search(query string, season, episode int, languages []st
 		return nil, faults.Errorf("searching subtitles: %w", err)
 	}
 
-	var subtitles []app.SubtitleAttributes
+	var subtitles []Subtitle
 	for _, data := range searchResp.Data {
 		attr := data.Attributes
 		var fileId int
@@ -164,11 +248,20 @@ func (o *OpenSubtitles) Search(query string, season, episode int, languages []st
 			fileId = attr.Files[0].FileID
 			filename = attr.Files[0].Filename
 		}
-		subtitles = append(subtitles, app.SubtitleAttributes{
-			ID:       attr.SubtitleID,
-			Language: attr.Language,
-			FileID:   fileId,
-			Filename: filename,
+		subtitles = append(subtitles, Subtitle{
+			ID:                attr.SubtitleID,
+			Language:          attr.Language,
+			FileID:            fileId,
+			Filename:          filename,
+			HashMatch:         attr.MoviehashMatch,
+			Release:           attr.Release,
+			Downloads:         attr.DownloadCount,
+			Rating:            attr.Ratings,
+			HearingImpaired:   attr.HearingImpaired,
+			FPS:               attr.FPS,
+			Trusted:           attr.FromTrusted,
+			AITranslated:      attr.AITranslated,
+			MachineTranslated: attr.MachineTranslated,
 		})
 	}
 
@@ -176,10 +269,10 @@ func (o *OpenSubtitles) Search(query string, season, episode int, languages []st
 }
 
 // Download retrieves the download link for a given subtitle ID
-func (o *OpenSubtitles) Download(token string, fileID int) (app.DownloadResponse, error) {
+func (o *OpenSubtitles) Download(token string, fileID int) (DownloadResponse, error) {
 	body := map[string]string{"file_id": strconv.Itoa(fileID)}
 
-	var res app.DownloadResponse
+	var res DownloadResponse
 	err := o.request(http.MethodPost, "/download", token, body, &res)
 	if err != nil {
 		return res, faults.Errorf("downloading subtitle: %w", err)
@@ -9,7 +9,7 @@ import (
 func TestSearch(t *testing.T) {
 	osd := New("", "")
 
-	subs, err := osd.Search("lioness", 2, 1, []string{"en", "pt"})
+	subs, err := osd.Search("lioness", "", 2, 1, []string{"en", "pt"})
 	require.NoError(t, err)
 	require.NotEmpty(t, subs)
 }
@@ -0,0 +1,354 @@
+package opensubtitles
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quintans/faults"
+	"github.com/quintans/torflix/internal/app"
+	"github.com/quintans/torflix/internal/lib/fails"
+	"github.com/quintans/torflix/internal/lib/https"
+	"github.com/quintans/torflix/internal/lib/retry"
+)
+
+const (
+	ProviderName = "opensubtitles"
+	// tokenValidity is used when the expiry cannot be read from the token
+	tokenValidity = 23 * time.Hour
+	// tokenMargin renews the token before it expires, so it does not expire in the middle of a request
+	tokenMargin = time.Minute
+	// refusalBackoff is how long downloads are not asked after a refusal that does not tell when the quota resets
+	refusalBackoff = time.Hour
+)
+
+// Credentials returns the username and password of the OpenSubtitles.com account
+type Credentials func() (string, string, error)
+
+// Provider finds subtitles in OpenSubtitles.com.
+// It logs in on the first download, keeping the token until it expires, and tracks the daily download quota.
+type Provider struct {
+	credentials Credentials
+	baseURL     string
+	now         func() time.Time
+
+	mu       sync.Mutex
+	client   *OpenSubtitles
+	username string
+	token    string
+	expiry   time.Time
+	quota    app.SubtitleQuota
+}
+
+func NewProvider(credentials Credentials) *Provider {
+	return &Provider{
+		credentials: credentials,
+		baseURL:     BaseURL,
+		now:         time.Now,
+	}
+}
+
+func (p *Provider) Name() string {
+	return ProviderName
+}
+
+// Search finds the subtitles, if there is an API key and an account
+func (p *Provider) Search(_ context.Context, query app.SubtitleQuery) ([]app.Subtitle, error) {
+	client, err := p.session()
+	if err != nil || client == nil {
+		return nil, err
+	}
+
+	found, err := client.Search(query.Query, query.Hash, query.Season, query.Episode, query.Languages)
+	if err != nil {
+		return nil, faults.Errorf("searching subtitles: %w", err)
+	}
+
+	subtitles := make([]app.Subtitle, 0, len(found))
+	for _, s := range found {
+		subtitles = append(subtitles, app.Subtitle{
+			Provider:          ProviderName,
+			ID:                strconv.Itoa(s.FileID),
+			Language:          s.Language,
+			Filename:          s.Filename,
+			HashMatch:         s.HashMatch,
+			Release:           s.Release,
+			Downloads:         s.Downloads,
+			Rating:            s.Rating,
+			HearingImpaired:   s.HearingImpaired,
+			FPS:               s.FPS,
+			Trusted:           s.Trusted,
+			AITranslated:      s.AITranslated,
+			MachineTranslated: s.MachineTranslated,
+		})
+	}
+	return subtitles, nil
+}
+
+// UsesMovieHash tells if the searches use the movie hash, which needs an API key and an account
+func (p *Provider) UsesMovieHash() bool {
+	if !IsAvailable() {
+		return false
+	}
+	username, _, err := p.credentials()
+	return err == nil && username != ""
+}
+
+// session returns the client for the current account, or nil if there is none
+func (p *Provider) session() (*OpenSubtitles, error) {
+	if !IsAvailable() {
+		return nil, nil
+	}
+	username, password, err := p.credentials()
+	if err != nil {
+		return nil, faults.Errorf("getting credentials: %w", err)
+	}
+	if username == "" {
+		return nil, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client == nil || p.username != username {
+		// another account has its own token and quota
+		p.client = NewWithURL(p.baseURL, username, password)
+		p.username = username
+		p.token = ""
+		p.quota = app.SubtitleQuota{}
+	}
+	return p.client, nil
+}
+
+// login returns the cached token, logging in again if it is about to expire. It must be called with the lock held.
+func (p *Provider) login() (string, error) {
+	if p.token != "" && p.now().Add(tokenMargin).Before(p.expiry) {
+		return p.token, nil
+	}
+
+	// logins always go to the main host, since the one returned may be stale
+	base, err := url.Parse(p.baseURL)
+	if err != nil {
+		return "", faults.Errorf("parsing base URL '%s': %w", p.baseURL, err)
+	}
+	err = p.client.SetHost(base.Host)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := p.client.Login()
+	if err != nil {
+		return "", faults.Errorf("login: %w", err)
+	}
+	if res.BaseURL != "" {
+		err = p.client.SetHost(res.BaseURL)
+		if err != nil {
+			return "", err
+		}
+	}
+	p.token = res.Token
+	p.expiry = tokenExpiry(res.Token, p.now())
+	if p.quota.Allowed == 0 {
+		p.quota.Allowed = res.User.AllowedDownloads
+		p.quota.Remaining = res.User.AllowedDownloads
+	}
+	return p.token, nil
+}
+
+func (p *Provider) Download(ctx context.Context, sub app.Subtitle) ([]byte, error) {
+	client, err := p.session()
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, faults.New("no OpenSubtitles account")
+	}
+	fileID, err := strconv.Atoi(sub.ID)
+	if err != nil {
+		return nil, faults.Errorf("invalid file ID '%s': %w", sub.ID, err)
+	}
+
+	res, err := p.downloadLink(client, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := fetchRetry(ctx, res.Link)
+	if err != nil {
+		return nil, faults.Errorf("fetching subtitle from '%s': %w", res.Link, err)
+	}
+	return data, nil
+}
+
+// downloadLink asks for the link of the file, counting it in the quota
+func (p *Provider) downloadLink(client *OpenSubtitles, fileID int) (DownloadResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// the download is refused before asking, since the server counts the refused ones
+	if p.quota.Exhausted(p.now()) {
+		return DownloadResponse{}, faults.Errorf("%w: %d downloads per day, resets at %s",
+			app.ErrSubtitleQuotaExhausted, p.quota.Allowed, resetTime(p.quota))
+	}
+
+	token, err := p.login()
+	if err != nil {
+		return DownloadResponse{}, err
+	}
+
+	res, err := client.Download(token, fileID)
+	var status *https.StatusError
+	if errors.As(err, &status) {
+		switch status.Code {
+		case http.StatusUnauthorized:
+			// the token was revoked, so the next download logs in again
+			p.token = ""
+		case http.StatusNotAcceptable:
+			// the quota ran out, maybe with downloads from elsewhere
+			p.refused(status.Body)
+			return DownloadResponse{}, faults.Errorf("%w: %d downloads per day, resets at %s",
+				app.ErrSubtitleQuotaExhausted, p.quota.Allowed, resetTime(p.quota))
+		}
+	}
+	if err != nil {
+		return DownloadResponse{}, faults.Errorf("getting download link: %w", err)
+	}
+	p.quota = app.SubtitleQuota{
+		Allowed:   res.Requests + res.Remaining,
+		Remaining: res.Remaining,
+		ResetAt:   res.ResetTimeUTC,
+	}
+	return res, nil
+}
+
+// refused exhausts the quota after a refused download, keeping what the refusal tells of it.
+// It must be called with the lock held.
+func (p *Provider) refused(body []byte) {
+	var res DownloadResponse
+	// the refusal has the same fields as a download, eg: {"requests": 21, "remaining": -1, "reset_time_utc": "..."}
+	_ = json.Unmarshal(body, &res)
+	if allowed := res.Requests + res.Remaining; res.Requests > 0 && allowed > 0 {
+		p.quota.Allowed = allowed
+	}
+	// a quota must be known to be exhausted
+	p.quota.Allowed = max(p.quota.Allowed, 1)
+	p.quota.Remaining = 0
+	switch {
+	case !res.ResetTimeUTC.IsZero():
+		p.quota.ResetAt = res.ResetTimeUTC
+	case !p.quota.ResetAt.After(p.now()):
+		p.quota.ResetAt = p.now().Add(refusalBackoff)
+	}
+}
+
+// Quota returns the daily download quota, that is unknown until the first download unless refreshed
+func (p *Provider) Quota(_ context.Context, refresh bool) (app.SubtitleQuota, error) {
+	client, err := p.session()
+	if err != nil || client == nil {
+		return app.SubtitleQuota{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !refresh {
+		return p.quota, nil
+	}
+
+	token, err := p.login()
+	if err != nil {
+		return app.SubtitleQuota{}, err
+	}
+	info, err := client.UserInfo(token)
+	if err != nil {
+		var status *https.StatusError
+		if errors.As(err, &status) && status.Code == http.StatusUnauthorized {
+			p.token = ""
+		}
+		return app.SubtitleQuota{}, err
+	}
+	p.quota.Allowed = info.AllowedDownloads
+	p.quota.Remaining = info.RemainingDownloads
+	if resetAt, err := time.Parse(time.RFC3339, info.ResetTimeUTC); err == nil {
+		p.quota.ResetAt = resetAt
+	}
+	return p.quota, nil
+}
+
+// Close logs out, if logged in
+func (p *Provider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token == "" {
+		return nil
+	}
+	err := p.client.Logout(p.token)
+	p.token = ""
+	if err != nil {
+		return faults.Errorf("logging out: %w", err)
+	}
+	return nil
+}
+
+// tokenExpiry reads the expiry of the JWT, without verifying it
+func tokenExpiry(token string, now time.Time) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) == 3 {
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err == nil {
+			var claims struct {
+				Exp int64 `json:"exp"`
+			}
+			if json.Unmarshal(payload, &claims) == nil && claims.Exp > 0 {
+				return time.Unix(claims.Exp, 0)
+			}
+		}
+	}
+	return now.Add(tokenValidity)
+}
+
+func resetTime(q app.SubtitleQuota) string {
+	if q.ResetAt.IsZero() {
+		return "an unknown time"
+	}
+	return q.ResetAt.Local().Format("15:04")
+}
+
+// fetchRetry downloads the subtitle file from the given URL
+func fetchRetry(ctx context.Context, link string) ([]byte, error) {
+	var data []byte
+	err := retry.Do(func() error {
+		var err error
+		data, err = fetch(ctx, link)
+		return err
+	}, retry.WithDelayFunc(https.DelayFunc))
+	return data, err
+}
+
+func fetch(ctx context.Context, link string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, retry.NewPermanentError(faults.Errorf("creating request: %w", err))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return nil, fails.New("too many requests for downloading subtitle", "retry-after", resp.Header.Get("Retry-After"))
+		}
+		return nil, retry.NewPermanentError(faults.Errorf("failed to fetch subtitle file, status code: %d", resp.StatusCode))
+	}
+
+	return io.ReadAll(resp.Body)
+}
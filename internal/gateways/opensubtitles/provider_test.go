@@ -0,0 +1,220 @@
+package opensubtitles
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quintans/torflix/internal/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer imitates OpenSubtitles.com: logins go to the main host and the other requests to the VIP host it returns
+type fakeServer struct {
+	main      *httptest.Server
+	vip       *httptest.Server
+	now       time.Time
+	logins    atomic.Int32
+	downloads atomic.Int32
+	allowed   atomic.Int32
+	// revoked refuses the token of the next download
+	revoked atomic.Bool
+}
+
+func newFakeServer(t *testing.T, now time.Time, allowed int) *fakeServer {
+	f := &fakeServer{now: now}
+	f.allowed.Store(int32(allowed))
+
+	f.vip = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/download":
+			if f.revoked.CompareAndSwap(true, false) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			n := int(f.downloads.Add(1))
+			allowed := int(f.allowed.Load())
+			if n > allowed {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusNotAcceptable)
+				_ = json.NewEncoder(w).Encode(map[string]any{
+					"requests":       n,
+					"remaining":      allowed - n,
+					"message":        fmt.Sprintf("You have downloaded your allowed %d subtitles for 24h", allowed),
+					"reset_time_utc": f.now.Add(5 * time.Hour).UTC().Format(time.RFC3339),
+				})
+				return
+			}
+			writeJSON(w, map[string]any{
+				"link":           f.vip.URL + "/file",
+				"file_name":      "movie.srt",
+				"requests":       n,
+				"remaining":      allowed - n,
+				"reset_time_utc": f.now.Add(5 * time.Hour).UTC().Format(time.RFC3339),
+			})
+		case "/api/v1/infos/user":
+			writeJSON(w, map[string]any{"data": map[string]any{
+				"allowed_downloads":   f.allowed.Load(),
+				"remaining_downloads": f.allowed.Load() - f.downloads.Load(),
+				"reset_time_utc":      f.now.Add(5 * time.Hour).UTC().Format(time.RFC3339),
+			}})
+		case "/file":
+			fmt.Fprint(w, "1\n00:00:01,000 --> 00:00:02,000\nHello\n")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(f.vip.Close)
+
+	f.main = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/login" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f.logins.Add(1)
+		vip, _ := url.Parse(f.vip.URL)
+		writeJSON(w, map[string]any{
+			"token":    jwt(f.now.Add(time.Hour)),
+			"base_url": vip.Host,
+			"user":     map[string]any{"allowed_downloads": f.allowed.Load(), "vip": true},
+		})
+	}))
+	t.Cleanup(f.main.Close)
+
+	return f
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func jwt(exp time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, exp.Unix())))
+	return "header." + payload + ".signature"
+}
+
+func newTestProvider(t *testing.T, f *fakeServer, now *time.Time) *Provider {
+	key := apiKey
+	apiKey = "test"
+	t.Cleanup(func() { apiKey = key })
+
+	p := NewProvider(func() (string, string, error) {
+		return "user", "secret", nil
+	})
+	p.baseURL = f.main.URL + "/api/v1"
+	p.now = func() time.Time { return *now }
+	return p
+}
+
+func TestProviderKeepsSession(t *testing.T) {
+	now := time.Now()
+	f := newFakeServer(t, now, 10)
+	p := newTestProvider(t, f, &now)
+	ctx := context.Background()
+	sub := app.Subtitle{Provider: ProviderName, ID: "1"}
+
+	for range 2 {
+		data, err := p.Download(ctx, sub)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "Hello")
+	}
+	// the downloads went to the VIP host with the same token
+	assert.Equal(t, int32(1), f.logins.Load())
+	assert.Equal(t, int32(2), f.downloads.Load())
+
+	// the token is renewed when it expires
+	now = now.Add(2 * time.Hour)
+	_, err := p.Download(ctx, sub)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), f.logins.Load())
+}
+
+func TestProviderQuota(t *testing.T) {
+	now := time.Now()
+	f := newFakeServer(t, now, 2)
+	p := newTestProvider(t, f, &now)
+	ctx := context.Background()
+	sub := app.Subtitle{Provider: ProviderName, ID: "1"}
+
+	quota, err := p.Quota(ctx, false)
+	require.NoError(t, err)
+	assert.Zero(t, quota.Allowed, "unknown before the first download")
+
+	quota, err = p.Quota(ctx, true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, quota.Allowed)
+	assert.Equal(t, 2, quota.Remaining)
+	assert.WithinDuration(t, now.Add(5*time.Hour), quota.ResetAt, time.Second)
+
+	for range 2 {
+		_, err = p.Download(ctx, sub)
+		require.NoError(t, err)
+	}
+	quota, err = p.Quota(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, 0, quota.Remaining)
+	assert.True(t, quota.Exhausted(now))
+
+	// refused without asking the server
+	_, err = p.Download(ctx, sub)
+	require.ErrorIs(t, err, app.ErrSubtitleQuotaExhausted)
+	assert.Equal(t, int32(2), f.downloads.Load())
+
+	// allowed again after the reset
+	now = now.Add(6 * time.Hour)
+	f.allowed.Store(4)
+	_, err = p.Download(ctx, sub)
+	require.NoError(t, err)
+}
+
+func TestProviderQuotaUsedElsewhere(t *testing.T) {
+	now := time.Now()
+	f := newFakeServer(t, now, 5)
+	// the quota was used on another device
+	f.downloads.Store(5)
+	p := newTestProvider(t, f, &now)
+	ctx := context.Background()
+	sub := app.Subtitle{Provider: ProviderName, ID: "1"}
+
+	_, err := p.Download(ctx, sub)
+	require.ErrorIs(t, err, app.ErrSubtitleQuotaExhausted)
+
+	quota, err := p.Quota(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, 5, quota.Allowed)
+	assert.Equal(t, 0, quota.Remaining)
+	assert.WithinDuration(t, now.Add(5*time.Hour), quota.ResetAt, time.Second)
+
+	// refused without asking the server nor logging in again
+	_, err = p.Download(ctx, sub)
+	require.ErrorIs(t, err, app.ErrSubtitleQuotaExhausted)
+	assert.Equal(t, int32(6), f.downloads.Load())
+	assert.Equal(t, int32(1), f.logins.Load())
+}
+
+func TestProviderRevokedToken(t *testing.T) {
+	now := time.Now()
+	f := newFakeServer(t, now, 10)
+	p := newTestProvider(t, f, &now)
+	ctx := context.Background()
+	sub := app.Subtitle{Provider: ProviderName, ID: "1"}
+
+	f.revoked.Store(true)
+	_, err := p.Download(ctx, sub)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, app.ErrSubtitleQuotaExhausted)
+
+	// the next download logs in again
+	_, err = p.Download(ctx, sub)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), f.logins.Load())
+}
@@ -0,0 +1,117 @@
+package player
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/quintans/faults"
+	"github.com/quintans/torflix/internal/app"
+	"github.com/quintans/torflix/internal/lib/mpv"
+	"github.com/quintans/torflix/internal/model"
+)
+
+// connectTimeout is how long mpv has to create its IPC socket
+const connectTimeout = 10 * time.Second
+
+var sockets atomic.Int64
+
+// isMPV tells if the player is mpv that can be controlled.
+// On Windows the IPC uses named pipes, that are not supported.
+func isMPV(p model.Player) bool {
+	return runtime.GOOS != "windows" && p.IsMPV()
+}
+
+// mpvPlayback controls mpv through its JSON IPC
+type mpvPlayback struct {
+	process
+	client *mpv.Client
+	socket string
+}
+
+// openMPV starts mpv with its JSON IPC, falling back to a player that cannot be controlled if it cannot connect
+func openMPV(ctx context.Context, p model.Player, url string, subtitles []string, extra []string) (app.Playback, error) {
+	socket := filepath.Join(os.TempDir(), fmt.Sprintf("torflix-mpv-%d-%d.sock", os.Getpid(), sockets.Add(1)))
+	c := command(ctx, p, url, subtitles, append(extra, "--input-ipc-server="+socket)...)
+	err := c.Start()
+	if err != nil {
+		return nil, faults.Errorf("error opening player: %w", err)
+	}
+	proc := process{cmd: c}
+
+	ctx2, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	client, err := mpv.Dial(ctx2, socket)
+	if err != nil {
+		slog.Warn("Failed to connect to mpv, it will not be controlled", "error", err)
+		return proc, nil
+	}
+
+	return &mpvPlayback{
+		process: proc,
+		client:  client,
+		socket:  socket,
+	}, nil
+}
+
+func (m *mpvPlayback) Wait() error {
+	err := m.process.Wait()
+	_ = m.client.Close()
+	_ = os.Remove(m.socket)
+	return err
+}
+
+func (m *mpvPlayback) Status(ctx context.Context) (app.PlaybackStatus, error) {
+	var status app.PlaybackStatus
+	err := m.client.Get(ctx, "pause", &status.Paused)
+	if err != nil {
+		return app.PlaybackStatus{}, err
+	}
+
+	// the position, the duration and the cache are unavailable until the file is loaded
+	var position, duration, cacheAhead float64
+	err = m.client.Get(ctx, "time-pos", &position)
+	if err != nil && !errors.Is(err, mpv.ErrUnavailable) {
+		return app.PlaybackStatus{}, err
+	}
+	err = m.client.Get(ctx, "duration", &duration)
+	if err != nil && !errors.Is(err, mpv.ErrUnavailable) {
+		return app.PlaybackStatus{}, err
+	}
+	err = m.client.Get(ctx, "demuxer-cache-duration", &cacheAhead)
+	if err != nil && !errors.Is(err, mpv.ErrUnavailable) {
+		return app.PlaybackStatus{}, err
+	}
+	err = m.client.Get(ctx, "paused-for-cache", &status.PausedForCache)
+	if err != nil && !errors.Is(err, mpv.ErrUnavailable) {
+		return app.PlaybackStatus{}, err
+	}
+	status.Position = seconds(position)
+	status.Duration = seconds(duration)
+	status.CacheAhead = seconds(cacheAhead)
+	return status, nil
+}
+
+func (m *mpvPlayback) SetPause(ctx context.Context, paused bool) error {
+	return m.client.Set(ctx, "pause", paused)
+}
+
+func (m *mpvPlayback) Seek(ctx context.Context, offset time.Duration) error {
+	_, err := m.client.Command(ctx, "seek", offset.Seconds(), "relative")
+	return err
+}
+
+func (m *mpvPlayback) AddSubtitle(ctx context.Context, url string) error {
+	_, err := m.client.Command(ctx, "sub-add", url, "select")
+	return err
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -2,55 +2,73 @@ package player
 
 import (
 	"context"
-	"os"
+	"fmt"
 	"os/exec"
+	"time"
 
 	"github.com/quintans/faults"
+	"github.com/quintans/torflix/internal/app"
 	"github.com/quintans/torflix/internal/model"
 )
 
-type Player struct {
-	DefaultSubtitlesDir string
-}
+type Player struct{}
 
-func (p Player) Open(ctx context.Context, player model.Player, url string, subtitlesDir string) error {
+func (p Player) Open(ctx context.Context, player model.Player, url string, subtitles []string, start time.Duration) (app.Playback, error) {
 	if len(player.Args) == 0 {
-		return faults.New("player is undefined")
+		return nil, faults.New("player is undefined")
 	}
 
-	subDir := p.DefaultSubtitlesDir
-	if subtitlesDir != "" {
-		subDir = subDir + string(os.PathListSeparator) + subtitlesDir
+	var extra []string
+	if player.Start != "" && start > 0 {
+		extra = append(extra, fmt.Sprintf("%s%d", player.Start, int(start.Seconds())))
 	}
 
-	return open(ctx, player, url, subDir)
+	if isMPV(player) {
+		return openMPV(ctx, player, url, subtitles, extra)
+	}
+	return open(ctx, player, url, subtitles, extra)
 }
 
 // GenericPlayer represents most players. The stream URL will be appended to the arguments.
 type GenericPlayer struct {
 	Commands []string
-	Subs     string
+	SubFile  string
 }
 
-// Open the given stream in a GenericPlayer.
-func open(ctx context.Context, p model.Player, url string, subtitlesDir string) error {
-	if p.Subs != "" && subtitlesDir != "" {
-		p.Args = append(p.Args, p.Subs+subtitlesDir)
+// process is a player that cannot be controlled
+type process struct {
+	cmd *exec.Cmd
+}
+
+func (p process) Wait() error {
+	err := p.cmd.Wait()
+	if err != nil {
+		return faults.Errorf("waiting player to close: %w", err)
 	}
-	command := append(p.Args, url)
+	return nil
+}
 
-	// #nosec
-	// It is the user's responsibility to pass the correct arguments to open the url.
-	c := exec.CommandContext(ctx, command[0], command[1:]...)
+// Open the given stream in a GenericPlayer.
+func open(ctx context.Context, p model.Player, url string, subtitles []string, extra []string) (app.Playback, error) {
+	c := command(ctx, p, url, subtitles, extra...)
 	err := c.Start()
 	if err != nil {
-		return faults.Errorf("error opening player: %w", err)
+		return nil, faults.Errorf("error opening player: %w", err)
 	}
+	return process{cmd: c}, nil
+}
 
-	err = c.Wait()
-	if err != nil {
-		return faults.Errorf("waiting player to close: %w", err)
+func command(ctx context.Context, p model.Player, url string, subtitles []string, extra ...string) *exec.Cmd {
+	args := append([]string{}, p.Args...)
+	if p.SubFile != "" {
+		for _, sub := range subtitles {
+			args = append(args, p.SubFile+sub)
+		}
 	}
+	args = append(args, extra...)
+	command := append(args, url)
 
-	return nil
+	// #nosec
+	// It is the user's responsibility to pass the correct arguments to open the url.
+	return exec.CommandContext(ctx, command[0], command[1:]...)
 }
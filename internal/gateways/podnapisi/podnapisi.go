@@ -0,0 +1,187 @@
+// Package podnapisi finds subtitles in podnapisi.net, a public subtitle site that does not require an account.
+package podnapisi
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/quintans/faults"
+	"github.com/quintans/torflix/internal/app"
+	"github.com/quintans/torflix/internal/lib/fails"
+	"github.com/quintans/torflix/internal/lib/https"
+	"github.com/quintans/torflix/internal/lib/lang"
+	"github.com/quintans/torflix/internal/lib/retry"
+)
+
+const (
+	ProviderName = "podnapisi"
+	BaseURL      = "https://www.podnapisi.net/subtitles/"
+)
+
+var extensions = []string{".srt", ".ass", ".ssa", ".vtt", ".sub"}
+
+type searchResponse struct {
+	Subtitles []struct {
+		PID      string `xml:"pid"`
+		Language string `xml:"language"`
+		Release  string `xml:"release"`
+		Title    string `xml:"title"`
+	} `xml:"subtitle"`
+}
+
+type Provider struct {
+	baseURL string
+}
+
+func NewProvider() *Provider {
+	return &Provider{
+		baseURL: BaseURL,
+	}
+}
+
+func (p *Provider) Name() string {
+	return ProviderName
+}
+
+// Search finds the subtitles of every language, since the site searches one language at a time
+func (p *Provider) Search(ctx context.Context, query app.SubtitleQuery) ([]app.Subtitle, error) {
+	var languages []string
+	for _, l := range query.Languages {
+		base := lang.Base(l)
+		if !slices.Contains(languages, base) {
+			languages = append(languages, base)
+		}
+	}
+	if len(languages) == 0 {
+		languages = []string{""}
+	}
+
+	var subtitles []app.Subtitle
+	for _, language := range languages {
+		found, err := p.search(ctx, query, language)
+		if err != nil {
+			return nil, err
+		}
+		subtitles = append(subtitles, found...)
+	}
+	return subtitles, nil
+}
+
+func (p *Provider) search(ctx context.Context, query app.SubtitleQuery, language string) ([]app.Subtitle, error) {
+	params := url.Values{}
+	params.Set("sXML", "1")
+	params.Set("sK", strings.TrimSpace(query.Query))
+	if language != "" {
+		params.Set("sL", language)
+	}
+	if query.Season > 0 {
+		params.Set("sTS", strconv.Itoa(query.Season))
+	}
+	if query.Episode > 0 {
+		params.Set("sTE", strconv.Itoa(query.Episode))
+	}
+
+	var body []byte
+	err := retry.Do(func() error {
+		var err error
+		body, err = p.get(ctx, p.baseURL+"search/old?"+params.Encode())
+		return err
+	}, retry.WithDelayFunc(https.DelayFunc))
+	if err != nil {
+		return nil, faults.Errorf("searching subtitles: %w", err)
+	}
+
+	var res searchResponse
+	err = xml.Unmarshal(body, &res)
+	if err != nil {
+		return nil, faults.Errorf("unmarshalling search response: %w", err)
+	}
+
+	subtitles := make([]app.Subtitle, 0, len(res.Subtitles))
+	for _, s := range res.Subtitles {
+		// the release holds every release name the subtitle fits, separated by spaces
+		name := s.Title
+		if releases := strings.Fields(s.Release); len(releases) > 0 {
+			name = releases[0]
+		}
+		subtitles = append(subtitles, app.Subtitle{
+			Provider: ProviderName,
+			ID:       s.PID,
+			Language: s.Language,
+			Filename: name + ".srt",
+			Release:  name,
+		})
+	}
+	return subtitles, nil
+}
+
+// Download fetches the zip of the subtitle, returning the first subtitle file in it
+func (p *Provider) Download(ctx context.Context, sub app.Subtitle) ([]byte, error) {
+	var body []byte
+	err := retry.Do(func() error {
+		var err error
+		body, err = p.get(ctx, p.baseURL+url.PathEscape(sub.ID)+"/download")
+		return err
+	}, retry.WithDelayFunc(https.DelayFunc))
+	if err != nil {
+		return nil, faults.Errorf("downloading subtitle: %w", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, faults.Errorf("opening subtitle zip: %w", err)
+	}
+	for _, f := range zr.File {
+		if !slices.Contains(extensions, strings.ToLower(filepath.Ext(f.Name))) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, faults.Errorf("opening '%s' in the zip: %w", f.Name, err)
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			return nil, faults.Errorf("reading '%s' in the zip: %w", f.Name, err)
+		}
+		return data, nil
+	}
+	return nil, faults.New("no subtitle in the zip")
+}
+
+func (p *Provider) get(ctx context.Context, uri string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, retry.NewPermanentError(faults.Errorf("creating request: %w", err))
+	}
+	req.Header.Set("User-Agent", fmt.Sprintf("%s v%s", app.Name, app.Version))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, faults.Errorf("requesting %s: %w", uri, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return nil, fails.New("too many requests", "url", uri, "retry-after", resp.Header.Get("Retry-After"))
+		}
+		return nil, retry.NewPermanentError(faults.Errorf("response status code %d for %s", resp.StatusCode, uri))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, faults.Errorf("reading response of %s: %w", uri, err)
+	}
+	return body, nil
+}
@@ -2,18 +2,33 @@ package repository
 
 import (
 	"encoding/json"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"sync"
 
 	"github.com/quintans/faults"
 	"github.com/quintans/torflix/internal/lib/files"
+	"github.com/quintans/torflix/internal/lib/proxy"
+	"github.com/quintans/torflix/internal/lib/safety"
+	"github.com/quintans/torflix/internal/lib/seeding"
+	"github.com/quintans/torflix/internal/lib/stall"
+	"github.com/quintans/torflix/internal/lib/subrank"
 	"github.com/quintans/torflix/internal/model"
 )
 
 type DB struct {
-	dir      string
-	search   *model.Search
-	settings *model.Settings
+	// mu serializes the access to the files and their caches, shared by the UI and the background jobs
+	mu     sync.Mutex
+	dir    string
+	search *model.Search
+	// settings is the saved settings file, parsed on every load so that each caller has its own copy
+	settings []byte
+	// seeding and transfers are copied in and out, so the callers never share them
+	seeding   map[string]model.TorrentSeeding
+	transfers *model.Transfers
+	history   *model.WatchHistory
 }
 
 func NewDB(cacheDir string) *DB {
@@ -33,6 +48,9 @@ type Search struct {
 }
 
 func (d *DB) SaveSearch(search *model.Search) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	selected := make([]string, 0, len(search.SelectedProviders()))
 	for k, v := range search.SelectedProviders() {
 		if v {
@@ -40,7 +58,7 @@ func (d *DB) SaveSearch(search *model.Search) error {
 		}
 	}
 
-	err := d.write("search.json", Search{
+	_, err := d.write("search.json", Search{
 		LastQuery:         search.Query(),
 		MediaName:         search.MediaName(),
 		SelectedProviders: selected,
@@ -55,6 +73,9 @@ func (d *DB) SaveSearch(search *model.Search) error {
 }
 
 func (d *DB) LoadSearch() (*model.Search, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	if d.search == nil {
 		s := Search{}
 		err := d.read("search.json", &s)
@@ -77,89 +98,317 @@ func (d *DB) LoadSearch() (*model.Search, error) {
 }
 
 type Settings struct {
-	TorrentPort             int                 `json:"torrentPort"`
-	Port                    int                 `json:"port"`
-	Player                  model.Player        `json:"player"`
-	Tcp                     bool                `json:"tcp"`
-	MaxConnections          int                 `json:"maxConnections"`
-	Seed                    bool                `json:"seed"`
-	SeedAfterComplete       bool                `json:"seedAfterComplete"`
-	Languages               []string            `json:"languages"`
-	HtmlSearchConfig        json.RawMessage     `json:"htmlSearchConfig"`
-	HtmlDetailsSearchConfig json.RawMessage     `json:"htmlDetailsSearchConfig"`
-	ApiSearchConfig         json.RawMessage     `json:"apiSearchConfig"`
-	Qualities               []string            `json:"qualities"`
-	OpenSubtitles           model.OpenSubtitles `json:"openSubtitles"`
-	UploadRate              int                 `json:"uploadRate"`
+	TorrentPort             int                   `json:"torrentPort"`
+	Port                    int                   `json:"port"`
+	Player                  *Player               `json:"player"`
+	Tcp                     bool                  `json:"tcp"`
+	MaxConnections          int                   `json:"maxConnections"`
+	Seed                    bool                  `json:"seed"`
+	SeedAfterComplete       bool                  `json:"seedAfterComplete"`
+	Languages               []string              `json:"languages"`
+	HtmlSearchConfig        json.RawMessage       `json:"htmlSearchConfig"`
+	HtmlDetailsSearchConfig json.RawMessage       `json:"htmlDetailsSearchConfig"`
+	ApiSearchConfig         json.RawMessage       `json:"apiSearchConfig"`
+	Qualities               []string              `json:"qualities"`
+	OpenSubtitles           model.OpenSubtitles   `json:"openSubtitles"`
+	UploadRate              int                   `json:"uploadRate"`
+	Safety                  safety.Rules          `json:"safety"`
+	FallbackTrackers        []string              `json:"fallbackTrackers"`
+	DownloadRate            int                   `json:"downloadRate"`
+	Bandwidth               model.Bandwidth       `json:"bandwidth"`
+	SeedingPolicy           seeding.Policy        `json:"seedingPolicy"`
+	Blocklists              []string              `json:"blocklists"`
+	Proxy                   proxy.Config          `json:"proxy"`
+	BindInterface           string                `json:"bindInterface"`
+	Stall                   stall.Config          `json:"stall"`
+	AutoPlay                bool                  `json:"autoPlay"`
+	SubtitleSources         model.SubtitleSources `json:"subtitleSources"`
+	SubtitlePreferences     subrank.Preferences   `json:"subtitlePreferences"`
+}
+
+// Player is the saved player, where the options missing from older files are nil
+type Player struct {
+	Args    []string `json:"args"`
+	SubFile *string  `json:"subFile,omitempty"`
+	Start   *string  `json:"start,omitempty"`
+	// Subs is the option of older files, that loaded the subtitles of a directory, replaced by SubFile
+	Subs *string `json:"subs,omitempty"`
+}
+
+// legacySubs is the Subs option of the older default player
+const legacySubs = "--sub-file-paths="
+
+// legacyArgs are the arguments of the older default player,
+// whose --save-position-on-quit would start the media at the position saved by mpv instead of the one passed with Start
+var legacyArgs = []string{"mpv", "--save-position-on-quit", "--sub-auto=all", "--profile=fast", "--hwdec=auto-safe", "--fs"}
+
+// toModel fills in the missing options with the ones of the default player, mpv, if it is the player.
+// Other players keep them unset, since their options differ, eg: VLC starts at a position with --start-time.
+// The older default player is replaced by the current one, and a customised Subs option becomes SubFile.
+func (p *Player) toModel(def model.Player) model.Player {
+	if p == nil {
+		return def
+	}
+
+	player := model.Player{Args: p.Args}
+	if slices.Equal(p.Args, legacyArgs) {
+		player.Args = slices.Clone(def.Args)
+	}
+	if player.IsMPV() {
+		player.SubFile, player.Start = def.SubFile, def.Start
+	}
+	if p.Subs != nil && *p.Subs != legacySubs {
+		player.SubFile = *p.Subs
+	}
+	if p.SubFile != nil {
+		player.SubFile = *p.SubFile
+	}
+	if p.Start != nil {
+		player.Start = *p.Start
+	}
+	return player
 }
 
 func (d *DB) SaveSettings(settings *model.Settings) error {
-	err := d.write("settings.json", Settings{
-		TorrentPort:    settings.TorrentPort(),
-		Port:           settings.Port(),
-		Player:         settings.Player(),
-		Tcp:            settings.TCP(),
-		MaxConnections: settings.MaxConnections(),
-		Seed:           settings.Seed(),
-		Languages:      settings.Languages(),
-		Qualities:      settings.Qualities(),
-		UploadRate:     settings.UploadRate(),
-		OpenSubtitles:  settings.OpenSubtitles,
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.saveSettings(settings)
+}
+
+// LoadSettings returns a copy of the settings, to be changed only through SaveSettings or UpdateSettings
+func (d *DB) LoadSettings() (*model.Settings, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.loadSettings()
+}
+
+// UpdateSettings changes the settings and saves them, with no other change in between
+func (d *DB) UpdateSettings(update func(settings *model.Settings)) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	settings, err := d.loadSettings()
+	if err != nil {
+		return err
+	}
+	update(settings)
+	return d.saveSettings(settings)
+}
+
+func (d *DB) saveSettings(settings *model.Settings) error {
+	player := settings.Player()
+	b, err := d.write("settings.json", Settings{
+		TorrentPort: settings.TorrentPort(),
+		Port:        settings.Port(),
+		Player: &Player{
+			Args:    player.Args,
+			SubFile: &player.SubFile,
+			Start:   &player.Start,
+		},
+		Tcp:                 settings.TCP(),
+		MaxConnections:      settings.MaxConnections(),
+		Seed:                settings.Seed(),
+		SeedAfterComplete:   settings.SeedAfterComplete(),
+		Languages:           settings.Languages(),
+		Qualities:           settings.Qualities(),
+		UploadRate:          settings.UploadRate(),
+		Safety:              settings.Safety(),
+		FallbackTrackers:    settings.FallbackTrackers(),
+		DownloadRate:        settings.DownloadRate(),
+		Bandwidth:           settings.Bandwidth(),
+		SeedingPolicy:       settings.SeedingPolicy(),
+		Blocklists:          settings.Blocklists(),
+		Proxy:               settings.Proxy(),
+		BindInterface:       settings.BindInterface(),
+		Stall:               settings.Stall(),
+		AutoPlay:            settings.AutoPlay(),
+		SubtitleSources:     settings.SubtitleSources(),
+		SubtitlePreferences: settings.SubtitlePreferences(),
+		OpenSubtitles:       settings.OpenSubtitles,
 	})
 	if err != nil {
 		return faults.Errorf("saving settings: %w", err)
 	}
 
-	d.settings = settings
+	d.settings = b
 
 	return nil
 }
 
-func (d *DB) LoadSettings() (*model.Settings, error) {
+func (d *DB) loadSettings() (*model.Settings, error) {
 	if d.settings == nil {
-		settings := Settings{}
-		err := d.read("settings.json", &settings)
+		b, err := d.readFile("settings.json")
 		if err != nil {
 			return nil, faults.Errorf("loading settings: %w", err)
 		}
+		d.settings = b
+	}
+
+	// missing entries will keep the default values
+	def := model.NewSettings()
+	settings := Settings{
+		Safety:           def.Safety(),
+		FallbackTrackers: def.FallbackTrackers(),
+		Stall:            def.Stall(),
+		AutoPlay:         def.AutoPlay(),
+	}
+	err := json.Unmarshal(d.settings, &settings)
+	if err != nil {
+		return nil, faults.Errorf("unmarshalling settings: %w", err)
+	}
+
+	s := model.NewSettings()
+	s.Hydrate(
+		settings.TorrentPort,
+		settings.Port,
+		settings.Player.toModel(def.Player()),
+		settings.Tcp,
+		settings.MaxConnections,
+		settings.Seed,
+		settings.SeedAfterComplete,
+		settings.Languages,
+		settings.HtmlSearchConfig,
+		settings.HtmlDetailsSearchConfig,
+		settings.ApiSearchConfig,
+		settings.Qualities,
+		settings.UploadRate,
+		settings.Safety,
+		settings.FallbackTrackers,
+		settings.DownloadRate,
+		settings.Bandwidth,
+		settings.SeedingPolicy,
+		settings.Blocklists,
+		settings.Proxy,
+		settings.BindInterface,
+		settings.Stall,
+		settings.AutoPlay,
+		settings.SubtitleSources,
+		settings.SubtitlePreferences,
+		settings.OpenSubtitles,
+	)
+
+	return s, nil
+}
+
+// SaveSeeding saves the seeding data of every torrent, by info hash
+func (d *DB) SaveSeeding(seeding map[string]model.TorrentSeeding) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, err := d.write("seeding.json", seeding)
+	if err != nil {
+		return faults.Errorf("saving seeding: %w", err)
+	}
+	d.seeding = maps.Clone(seeding)
+
+	return nil
+}
+
+// LoadSeeding returns a copy of the seeding data, to be changed only through SaveSeeding
+func (d *DB) LoadSeeding() (map[string]model.TorrentSeeding, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.seeding == nil {
+		seeding := map[string]model.TorrentSeeding{}
+		if d.Exists("seeding.json") {
+			err := d.read("seeding.json", &seeding)
+			if err != nil {
+				return nil, faults.Errorf("loading seeding: %w", err)
+			}
+		}
+		d.seeding = seeding
+	}
+
+	return maps.Clone(d.seeding), nil
+}
 
-		s := model.NewSettings()
-		s.Hydrate(
-			settings.TorrentPort,
-			settings.Port,
-			settings.Player,
-			settings.Tcp,
-			settings.MaxConnections,
-			settings.Seed,
-			settings.SeedAfterComplete,
-			settings.Languages,
-			settings.HtmlSearchConfig,
-			settings.HtmlDetailsSearchConfig,
-			settings.ApiSearchConfig,
-			settings.Qualities,
-			settings.UploadRate,
-			settings.OpenSubtitles,
-		)
+// SaveTransfers saves the lifetime transfer totals
+func (d *DB) SaveTransfers(transfers *model.Transfers) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
-		d.settings = s
+	_, err := d.write("transfers.json", transfers)
+	if err != nil {
+		return faults.Errorf("saving transfers: %w", err)
+	}
+	d.transfers = transfers.Clone()
+
+	return nil
+}
+
+// LoadTransfers returns a copy of the lifetime transfer totals, to be changed only through SaveTransfers
+func (d *DB) LoadTransfers() (*model.Transfers, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.transfers == nil {
+		transfers := &model.Transfers{}
+		if d.Exists("transfers.json") {
+			err := d.read("transfers.json", transfers)
+			if err != nil {
+				return nil, faults.Errorf("loading transfers: %w", err)
+			}
+		}
+		if transfers.Torrents == nil {
+			transfers.Torrents = map[string]model.TransferTotals{}
+		}
+		d.transfers = transfers
 	}
 
-	return d.settings, nil
+	return d.transfers.Clone(), nil
 }
 
-func (d *DB) write(file string, data any) error {
+// SaveHistory saves what was watched of every torrent
+func (d *DB) SaveHistory(history *model.WatchHistory) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, err := d.write("history.json", history)
+	if err != nil {
+		return faults.Errorf("saving watch history: %w", err)
+	}
+	d.history = history
+
+	return nil
+}
+
+func (d *DB) LoadHistory() (*model.WatchHistory, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.history == nil {
+		history := &model.WatchHistory{}
+		if d.Exists("history.json") {
+			err := d.read("history.json", history)
+			if err != nil {
+				return nil, faults.Errorf("loading watch history: %w", err)
+			}
+		}
+		if history.Torrents == nil {
+			history.Torrents = map[string]map[string]model.WatchEntry{}
+		}
+		d.history = history
+	}
+
+	return d.history, nil
+}
+
+func (d *DB) write(file string, data any) ([]byte, error) {
 	b, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
-		return faults.Errorf("marshalling data for '%s': %w", file, err)
+		return nil, faults.Errorf("marshalling data for '%s': %w", file, err)
 	}
 
 	path := filepath.Join(d.dir, file)
 	err = os.WriteFile(path, b, os.ModePerm)
 	if err != nil {
-		return faults.Errorf("writing data for '%s': %w", path, err)
+		return nil, faults.Errorf("writing data for '%s': %w", path, err)
 	}
 
-	return nil
+	return b, nil
 }
 
 func (d *DB) Exists(file string) bool {
@@ -167,16 +416,23 @@ func (d *DB) Exists(file string) bool {
 }
 
 func (d *DB) read(file string, data any) error {
-	path := filepath.Join(d.dir, file)
-	b, err := os.ReadFile(path)
+	b, err := d.readFile(file)
 	if err != nil {
-		return faults.Errorf("reading data for '%s': %w", file, err)
+		return err
 	}
 
 	err = json.Unmarshal(b, data)
 	if err != nil {
-		return faults.Errorf("unmarshalling data for '%s': %w", path, err)
+		return faults.Errorf("unmarshalling data for '%s': %w", filepath.Join(d.dir, file), err)
 	}
 
 	return nil
 }
+
+func (d *DB) readFile(file string) ([]byte, error) {
+	b, err := os.ReadFile(filepath.Join(d.dir, file))
+	if err != nil {
+		return nil, faults.Errorf("reading data for '%s': %w", file, err)
+	}
+	return b, nil
+}
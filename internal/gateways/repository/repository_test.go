@@ -0,0 +1,40 @@
+package repository_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/quintans/torflix/internal/gateways/repository"
+	"github.com/quintans/torflix/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadPlayer(t *testing.T, player string) model.Player {
+	dir := t.TempDir()
+	db := repository.NewDB(dir)
+	err := os.WriteFile(filepath.Join(dir, "data", "settings.json"), []byte(`{"player": `+player+`}`), 0o644)
+	require.NoError(t, err)
+
+	settings, err := db.LoadSettings()
+	require.NoError(t, err)
+	return settings.Player()
+}
+
+func TestLoadLegacyPlayer(t *testing.T) {
+	def := model.NewSettings().Player()
+
+	// the older default player becomes the current one
+	player := loadPlayer(t, `{"args": ["mpv", "--save-position-on-quit", "--sub-auto=all", "--profile=fast", "--hwdec=auto-safe", "--fs"], "subs": "--sub-file-paths="}`)
+	assert.Equal(t, def, player)
+
+	// customised players keep their arguments and subs option
+	player = loadPlayer(t, `{"args": ["vlc", "--fullscreen"], "subs": "--sub-file="}`)
+	assert.Equal(t, model.Player{Args: []string{"vlc", "--fullscreen"}, SubFile: "--sub-file="}, player)
+
+	player = loadPlayer(t, `{"args": ["mpv", "--save-position-on-quit"], "subs": "--sub-files="}`)
+	assert.Equal(t, []string{"mpv", "--save-position-on-quit"}, player.Args)
+	assert.Equal(t, "--sub-files=", player.SubFile)
+	assert.Equal(t, def.Start, player.Start)
+}
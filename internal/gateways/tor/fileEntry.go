@@ -1,9 +1,11 @@
 package tor
 
 import (
+	"context"
 	"io"
 
 	"github.com/anacrolix/torrent"
+	"github.com/quintans/faults"
 )
 
 // SeekableContent describes an io.ReadSeeker that can be closed as well.
@@ -19,8 +21,17 @@ type FileEntry struct {
 }
 
 // Seek seeks to the correct file position, paying attention to the offset.
+// The positions are relative to the file, including the end, and not to the torrent.
 func (f *FileEntry) Seek(offset int64, whence int) (int64, error) {
-	return f.Reader.Seek(offset+f.File.Offset(), whence)
+	switch whence {
+	case io.SeekStart:
+		offset += f.File.Offset()
+	case io.SeekEnd:
+		offset += f.File.Offset() + f.File.Length()
+		whence = io.SeekStart
+	}
+	pos, err := f.Reader.Seek(offset, whence)
+	return pos - f.File.Offset(), err
 }
 
 // NewFileReader sets up a torrent file for streaming reading.
@@ -31,10 +42,33 @@ func NewFileReader(f *torrent.File) (SeekableContent, error) {
 	// We read ahead 0.5% of the file continuously.
 	reader.SetReadahead(f.Length() / 200)
 	reader.SetResponsive()
+	return newFileEntry(f, reader)
+}
+
+// probeReadahead covers the blocks read by the probe, that are scattered over the file
+const probeReadahead = 256 << 10
+
+// NewProbeReader sets up a torrent file for reading its headers.
+// The pieces being read get the highest priority, so only the ranges needed are downloaded first.
+// Reads wait for the pieces to be downloaded, until the context is done.
+func NewProbeReader(ctx context.Context, f *torrent.File) (SeekableContent, error) {
+	reader := f.Torrent().NewReader()
+	reader.SetContext(ctx)
+	reader.SetReadahead(probeReadahead)
+	reader.SetResponsive()
+	return newFileEntry(f, reader)
+}
+
+// newFileEntry positions the reader at the start of the file, closing it if that fails
+func newFileEntry(f *torrent.File, reader torrent.Reader) (SeekableContent, error) {
 	_, err := reader.Seek(f.Offset(), io.SeekStart)
+	if err != nil {
+		_ = reader.Close()
+		return nil, faults.Errorf("seeking to the start of '%s': %w", f.DisplayPath(), err)
+	}
 
 	return &FileEntry{
 		File:   f,
 		Reader: reader,
-	}, err
+	}, nil
 }
@@ -0,0 +1,73 @@
+package tor_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/quintans/torflix/internal/gateways/tor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileEntrySeek(t *testing.T) {
+	dir := t.TempDir()
+	first := bytes.Repeat([]byte("a"), 1000)
+	second := []byte("0123456789abcdefghij")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "content"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "content", "a.mkv"), first, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "content", "b.mkv"), second, 0o644))
+
+	info := metainfo.Info{PieceLength: 256}
+	require.NoError(t, info.BuildFromFilePath(filepath.Join(dir, "content")))
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(t, err)
+
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = dir
+	cfg.NoDHT = true
+	cfg.DisableTrackers = true
+	cfg.ListenPort = 0
+	cfg.NoDefaultPortForwarding = true
+	client, err := torrent.NewClient(cfg)
+	require.NoError(t, err)
+	defer client.Close()
+
+	tt, err := client.AddTorrent(&metainfo.MetaInfo{InfoBytes: infoBytes})
+	require.NoError(t, err)
+	require.NoError(t, tt.VerifyData())
+
+	file := tt.Files()[1]
+	require.Equal(t, "b.mkv", file.DisplayPath())
+	entry, err := tor.NewFileReader(file)
+	require.NoError(t, err)
+	defer entry.Close()
+
+	// the size of the file, as http.ServeContent gets it
+	pos, err := entry.Seek(0, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(second)), pos)
+
+	pos, err = entry.Seek(-5, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), pos)
+	b, err := io.ReadAll(entry)
+	require.NoError(t, err)
+	assert.Equal(t, "fghij", string(b))
+
+	pos, err = entry.Seek(3, io.SeekStart)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), pos)
+	pos, err = entry.Seek(2, io.SeekCurrent)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), pos)
+	b = make([]byte, 4)
+	_, err = io.ReadFull(entry, b)
+	require.NoError(t, err)
+	assert.Equal(t, "5678", string(b))
+}
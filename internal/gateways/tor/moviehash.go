@@ -0,0 +1,48 @@
+package tor
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/anacrolix/torrent"
+	"github.com/quintans/faults"
+	"github.com/quintans/torflix/internal/lib/moviehash"
+)
+
+// MovieHash computes the OpenSubtitles hash of a file of the torrent.
+// Only the pieces of its first and last chunks are read, so they get the highest priority.
+func (c *TorrentClient) MovieHash(ctx context.Context, file *torrent.File) (string, error) {
+	reader := file.Torrent().NewReader()
+	reader.SetContext(ctx)
+	reader.SetReadahead(moviehash.ChunkSize)
+	reader.SetResponsive()
+	entry := &FileEntry{
+		File:   file,
+		Reader: reader,
+	}
+	defer func() {
+		if err := entry.Close(); err != nil {
+			slog.Error("Failed closing movie hash reader.", "error", err)
+		}
+	}()
+
+	hash, err := moviehash.Compute(readerAt{entry}, file.Length())
+	if err != nil {
+		return "", faults.Errorf("computing movie hash of '%s': %w", file.DisplayPath(), err)
+	}
+	return hash, nil
+}
+
+// readerAt reads at a position of the file by seeking to it
+type readerAt struct {
+	rs io.ReadSeeker
+}
+
+func (r readerAt) ReadAt(p []byte, off int64) (int, error) {
+	_, err := r.rs.Seek(off, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	return io.ReadFull(r.rs, p)
+}
@@ -0,0 +1,73 @@
+package tor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/anacrolix/torrent"
+	"github.com/quintans/torflix/internal/app"
+)
+
+// Peers returns the peers the torrent is connected to
+func (c *TorrentClient) Peers() []app.PeerInfo {
+	t := c.Torrent
+	if t == nil || t.Info() == nil {
+		return nil
+	}
+
+	conns := t.PeerConns()
+	peers := make([]app.PeerInfo, 0, len(conns))
+	for _, pc := range conns {
+		stats := pc.Stats()
+		peers = append(peers, app.PeerInfo{
+			Address:      fmt.Sprintf("%v", pc.RemoteAddr),
+			Client:       clientName(pc),
+			Flags:        peerFlags(pc),
+			Progress:     float64(stats.RemotePieceCount) / float64(t.NumPieces()) * 100,
+			DownloadRate: int64(stats.DownloadRate),
+			UploadRate:   int64(stats.LastWriteUploadRate),
+			Connection:   connection(pc),
+		})
+	}
+
+	return peers
+}
+
+func (c *TorrentClient) BlockedPeers() int64 {
+	return c.Config.IPBlocklist.Blocked()
+}
+
+// clientName returns the name sent in the extended handshake, falling back to the Azureus style peer id, eg: -qB4250-
+func clientName(pc *torrent.PeerConn) string {
+	if name, ok := pc.PeerClientName.Load().(string); ok && name != "" {
+		return name
+	}
+	id := pc.PeerID
+	if id[0] == '-' && id[7] == '-' {
+		return string(id[1:7])
+	}
+	return "unknown"
+}
+
+func peerFlags(pc *torrent.PeerConn) string {
+	flags := string(pc.Discovery)
+	if pc.PeerPrefersEncryption {
+		flags += "E"
+	}
+	if pc.PeerExtensionBytes.SupportsFast() {
+		flags += "F"
+	}
+	return flags
+}
+
+func connection(pc *torrent.PeerConn) string {
+	direction := "out"
+	if pc.Discovery == torrent.PeerSourceIncoming {
+		direction = "in"
+	}
+	network := pc.Network
+	if network == "" {
+		network = "?"
+	}
+	return strings.ToLower(network) + " " + direction
+}
@@ -0,0 +1,58 @@
+package tor
+
+import (
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/quintans/torflix/internal/lib/playback"
+)
+
+// ObserveRate sets the smoothed download rate, in bytes per second, measured by the stats collector
+func (c *TorrentClient) ObserveRate(bytesPerSec float64) {
+	c.downloadRate.Store(int64(bytesPerSec))
+}
+
+// Completed returns the bytes of the file that are downloaded contiguously from its start
+func (c *TorrentClient) Completed(file *torrent.File) int64 {
+	return contiguous(file.State())
+}
+
+// BufferedFrom returns the bytes of the file that are downloaded contiguously from the offset
+func (c *TorrentClient) BufferedFrom(file *torrent.File, offset int64) int64 {
+	return contiguousFrom(file.State(), offset)
+}
+
+func contiguousFrom(states []torrent.FilePieceState, offset int64) int64 {
+	var start, n int64
+	for _, s := range states {
+		end := start + s.Bytes
+		if end > offset {
+			if !s.Complete {
+				break
+			}
+			n += end - max(start, offset)
+		}
+		start = end
+	}
+	return n
+}
+
+func contiguous(states []torrent.FilePieceState) int64 {
+	var n int64
+	for _, s := range states {
+		if !s.Complete {
+			break
+		}
+		n += s.Bytes
+	}
+	return n
+}
+
+// readyIn estimates how long until the file being played can be played through without stalling
+func (c *TorrentClient) readyIn(states []torrent.FilePieceState) (time.Duration, bool) {
+	// the player reads from the start, so only the contiguous bytes count
+	buffered := contiguous(states)
+	size := c.File.Length()
+	bitrate := playback.Bitrate(size, time.Duration(c.mediaDuration.Load()), c.File.DisplayPath())
+	return playback.ETA(size, buffered, bitrate, float64(c.downloadRate.Load()))
+}
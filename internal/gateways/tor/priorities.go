@@ -0,0 +1,62 @@
+package tor
+
+import (
+	"maps"
+
+	"github.com/anacrolix/torrent"
+	"github.com/quintans/faults"
+	"github.com/quintans/torflix/internal/app"
+)
+
+var piecePriorities = map[app.FilePriority]torrent.PiecePriority{
+	app.FilePrioritySkip:   torrent.PiecePriorityNone,
+	app.FilePriorityNormal: torrent.PiecePriorityNormal,
+	app.FilePriorityHigh:   torrent.PiecePriorityHigh,
+	app.FilePriorityNow:    torrent.PiecePriorityNow,
+}
+
+// loadPriorities restores the persisted file priorities.
+// Files wanted by the user will keep downloading in the background, independently of the file being streamed.
+func (c *TorrentClient) loadPriorities() error {
+	c.priorities = map[string]app.FilePriority{}
+	data, err := c.loadResume()
+	if err != nil {
+		return faults.Errorf("loading file priorities: %w", err)
+	}
+
+	for _, f := range c.Torrent.Files() {
+		p, ok := data.Priorities[f.Path()]
+		if !ok {
+			continue
+		}
+		c.priorities[f.Path()] = p
+		f.SetPriority(piecePriorities[p])
+	}
+
+	return nil
+}
+
+func (c *TorrentClient) FilePriorities() map[string]app.FilePriority {
+	return maps.Clone(c.priorities)
+}
+
+func (c *TorrentClient) SetFilePriority(file *torrent.File, priority app.FilePriority) error {
+	pp, ok := piecePriorities[priority]
+	if !ok {
+		return faults.Errorf("unknown file priority '%s'", priority)
+	}
+
+	file.SetPriority(pp)
+	if priority == app.FilePrioritySkip {
+		delete(c.priorities, file.Path())
+	} else {
+		c.priorities[file.Path()] = priority
+	}
+
+	err := c.saveResume()
+	if err != nil {
+		return faults.Errorf("saving file priorities: %w", err)
+	}
+
+	return nil
+}
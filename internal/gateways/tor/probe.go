@@ -0,0 +1,45 @@
+package tor
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/quintans/faults"
+	"github.com/quintans/torflix/internal/lib/probe"
+)
+
+// Probe reads the headers of a media file of the torrent, downloading the pieces they are in
+func (c *TorrentClient) Probe(ctx context.Context, file *torrent.File) (probe.Info, error) {
+	entry, err := NewProbeReader(ctx, file)
+	if err != nil {
+		return probe.Info{}, faults.Errorf("creating reader for '%s': %w", file.DisplayPath(), err)
+	}
+	defer func() {
+		if err := entry.Close(); err != nil {
+			slog.Error("Failed closing probe reader.", "error", err)
+		}
+	}()
+	info, err := probe.Probe(entry, file.Length())
+	if err != nil {
+		return probe.Info{}, faults.Errorf("probing '%s': %w", file.DisplayPath(), err)
+	}
+	return info, nil
+}
+
+// NewReader opens a file of the torrent for reading its structure.
+// Reads wait for the pieces to be downloaded, until the context is done.
+func (c *TorrentClient) NewReader(ctx context.Context, file *torrent.File) (io.ReadSeekCloser, error) {
+	entry, err := NewProbeReader(ctx, file)
+	if err != nil {
+		return nil, faults.Errorf("creating reader for '%s': %w", file.DisplayPath(), err)
+	}
+	return entry, nil
+}
+
+// SetMediaDuration sets the duration of the media being played, used to estimate its bitrate
+func (c *TorrentClient) SetMediaDuration(duration time.Duration) {
+	c.mediaDuration.Store(int64(duration))
+}
@@ -0,0 +1,40 @@
+package tor
+
+import (
+	"log/slog"
+	"time"
+)
+
+// dhtAnnounceTimeout bounds each DHT announce, which otherwise runs until stopped
+const dhtAnnounceTimeout = time.Minute
+
+// AnnounceToDHT asks the DHT for peers.
+// The trackers cannot be forced: while the torrent wants peers they are already announced to every minute.
+func (c *TorrentClient) AnnounceToDHT() {
+	for _, s := range c.Client.DhtServers() {
+		done, stop, err := c.Torrent.AnnounceToDht(s)
+		if err != nil {
+			slog.Warn("Failed to announce to DHT", "error", err)
+			continue
+		}
+		go func() {
+			defer stop()
+			select {
+			case <-done:
+			case <-time.After(dhtAnnounceTimeout):
+			}
+		}()
+	}
+}
+
+// AddTrackers adds to the first tier the trackers that are not yet known by the torrent
+func (c *TorrentClient) AddTrackers(trackers []string) {
+	if len(trackers) == 0 {
+		return
+	}
+	c.Torrent.AddTrackers([][]string{trackers})
+}
+
+func (c *TorrentClient) SetMaxConnections(max int) {
+	c.Torrent.SetMaxEstablishedConns(max)
+}
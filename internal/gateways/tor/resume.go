@@ -0,0 +1,117 @@
+package tor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/quintans/faults"
+	"github.com/quintans/torflix/internal/app"
+)
+
+// The piece completion state is persisted by the torrent storage (sqlite or bolt db in the media dir).
+// That state can only be trusted if the media files were not changed outside of the client,
+// so we keep, per info hash, the size and modification time of the files as they were when the client last wrote them.
+// The file priorities chosen by the user are also kept here.
+
+type resumeData struct {
+	Files      map[string]fileStamp        `json:"files"`
+	Priorities map[string]app.FilePriority `json:"priorities,omitempty"`
+}
+
+type fileStamp struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// resumeFilename is the name of the file holding the resume data of a torrent
+func resumeFilename(hash string) string {
+	return fmt.Sprintf("%s.resume.json", strings.ToUpper(hash))
+}
+
+func (c *TorrentClient) resumePath() string {
+	return filepath.Join(c.resumeDir, resumeFilename(c.Torrent.InfoHash().HexString()))
+}
+
+func (c *TorrentClient) loadResume() (resumeData, error) {
+	data := resumeData{}
+	b, err := os.ReadFile(c.resumePath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return data, nil
+		}
+		return data, faults.Errorf("reading resume data: %w", err)
+	}
+
+	err = json.Unmarshal(b, &data)
+	if err != nil {
+		return data, faults.Errorf("unmarshalling resume data: %w", err)
+	}
+
+	return data, nil
+}
+
+// saveResume records the current state of the media files on disk
+func (c *TorrentClient) saveResume() error {
+	if c.Torrent == nil || c.Torrent.Info() == nil {
+		return nil
+	}
+
+	data := resumeData{
+		Files:      map[string]fileStamp{},
+		Priorities: c.priorities,
+	}
+	for _, f := range c.Torrent.Files() {
+		stamp, ok := c.diskStamp(f)
+		if ok {
+			data.Files[f.Path()] = stamp
+		}
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return faults.Errorf("marshalling resume data: %w", err)
+	}
+
+	err = os.WriteFile(c.resumePath(), b, 0o644)
+	if err != nil {
+		return faults.Errorf("writing resume data: %w", err)
+	}
+
+	return nil
+}
+
+// diskStamp returns the size and modification time of the file on disk, considering that incomplete files have the .part suffix
+func (c *TorrentClient) diskStamp(f *torrent.File) (fileStamp, bool) {
+	path := filepath.Join(c.TorrentDir, filepath.FromSlash(f.Path()))
+	for _, p := range []string{path, path + ".part"} {
+		fi, err := os.Stat(p)
+		if err == nil {
+			return fileStamp{Size: fi.Size(), ModTime: fi.ModTime()}, true
+		}
+	}
+
+	return fileStamp{}, false
+}
+
+// needsRecheck tells if the persisted piece completion of the file can no longer be trusted
+func (c *TorrentClient) needsRecheck(f *torrent.File) bool {
+	data, err := c.loadResume()
+	if err != nil {
+		return true
+	}
+
+	current, onDisk := c.diskStamp(f)
+	stamp, known := data.Files[f.Path()]
+	if !onDisk {
+		// nothing was downloaded yet, but we can't trust a completion state that refers to it
+		return known || f.BytesCompleted() > 0
+	}
+
+	return !known || stamp.Size != current.Size || !stamp.ModTime.Equal(current.ModTime)
+}
@@ -4,21 +4,28 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/dialer"
 	"github.com/quintans/faults"
 	"github.com/quintans/torflix/internal/app"
+	"github.com/quintans/torflix/internal/lib/bandwidth"
+	"github.com/quintans/torflix/internal/lib/blocklist"
 	"github.com/quintans/torflix/internal/lib/files"
 	"github.com/quintans/torflix/internal/lib/gracefull"
 	"github.com/quintans/torflix/internal/lib/magnet"
-	"golang.org/x/time/rate"
+	"github.com/quintans/torflix/internal/lib/netbind"
+	"github.com/quintans/torflix/internal/lib/proxy"
 )
 
 var isHTTP = regexp.MustCompile(`^https?:\/\/`)
@@ -35,14 +42,19 @@ const (
 type TorrentClient struct {
 	Client         *torrent.Client
 	Torrent        *torrent.Torrent
-	Progress       int64
-	Uploaded       int64
-	Size           int64
 	Config         ClientConfig
 	File           *torrent.File
 	TorrentDir     string
 	status         Status
 	piecesComplete int
+	resumeDir      string
+	priorities     map[string]app.FilePriority
+	started        time.Time
+	seedingStopped bool
+	// downloadRate is the smoothed download rate, in bytes per second
+	downloadRate atomic.Int64
+	// mediaDuration is the duration of the media, when known from its container
+	mediaDuration atomic.Int64
 
 	torrentConfig *torrent.ClientConfig
 	shutdown      *gracefull.Gracefull
@@ -52,13 +64,17 @@ type TorrentClient struct {
 type ClientConfig struct {
 	TorrentPort          int
 	Seed                 bool
-	SeedAfterComplete    bool
 	TCP                  bool
 	MaxConnections       int
 	DownloadAheadPercent float64 // Prioritize next % of the file.
 	FirstDownloadPercent float64 // Prioritize first % of the file.
 	ValidMediaExtensions []string
 	UploadRate           int // bytes per second
+	DownloadRate         int // bytes per second
+	IPBlocklist          *blocklist.Counter
+	Proxy                proxy.Config
+	// BindIP is the local address of every listener and outgoing connection. Nil binds to all.
+	BindIP net.IP
 }
 
 // NewTorrentClient creates a new torrent client based on a magnet or a torrent file.
@@ -91,6 +107,8 @@ func NewTorrentClient(cfg ClientConfig, torrentDir, mediaDir string, resource st
 		TorrentDir: mediaDir,
 		Config:     cfg,
 		shutdown:   gracefull.New(),
+		resumeDir:  torrentDir,
+		started:    time.Now(),
 	}
 
 	torrentConfig := torrent.NewDefaultClientConfig()
@@ -99,8 +117,56 @@ func NewTorrentClient(cfg ClientConfig, torrentDir, mediaDir string, resource st
 	torrentConfig.NoUpload = !cfg.Seed
 	torrentConfig.DisableTCP = !cfg.TCP
 	torrentConfig.ListenPort = cfg.TorrentPort
-	if cfg.UploadRate > 0 {
-		torrentConfig.UploadRateLimiter = rate.NewLimiter(rate.Limit(cfg.UploadRate), cfg.UploadRate)
+	if cfg.IPBlocklist != nil {
+		torrentConfig.IPBlocklist = cfg.IPBlocklist
+	}
+	// the limiters are always set so that the limits can be changed while running
+	torrentConfig.UploadRateLimiter = bandwidth.NewLimiter(cfg.UploadRate)
+	torrentConfig.DownloadRateLimiter = bandwidth.NewLimiter(cfg.DownloadRate)
+
+	var boundDialer *net.Dialer
+	if cfg.BindIP != nil {
+		host := cfg.BindIP.String()
+		torrentConfig.ListenHost = func(string) string { return host }
+		// only the family of the address can be bound
+		if cfg.BindIP.To4() != nil {
+			torrentConfig.DisableIPv6 = true
+		} else {
+			torrentConfig.DisableIPv4 = true
+		}
+		boundDialer = netbind.Dialer(cfg.BindIP)
+		torrentConfig.DialForPeerConns = false
+		torrentConfig.TrackerDialContext = boundDialer.DialContext
+		torrentConfig.HTTPDialContext = boundDialer.DialContext
+		torrentConfig.TrackerListenPacket = netbind.ListenPacket(cfg.BindIP)
+	}
+
+	var peerDialer dialer.WithContext
+	proxyDialer, err := proxy.Dialer(cfg.Proxy, boundDialer)
+	if err != nil {
+		return nil, faults.Errorf("creating proxy dialer: %w", err)
+	}
+	switch {
+	case proxyDialer != nil:
+		peerDialer = proxyDialer
+	case boundDialer != nil:
+		peerDialer = boundDialer
+	}
+	if proxyDialer != nil {
+		proxyURL, _ := url.Parse(cfg.Proxy.URL)
+		// trackers and web seeds
+		torrentConfig.HTTPProxy = http.ProxyURL(proxyURL)
+		// peers are only dialed through the proxy
+		torrentConfig.DialForPeerConns = false
+		if cfg.Proxy.Only {
+			// refuse everything that would bypass the proxy
+			torrentConfig.NoDHT = true
+			torrentConfig.DisableUTP = true
+			torrentConfig.DisableWebtorrent = true
+			torrentConfig.AcceptPeerConnections = false
+			torrentConfig.NoDefaultPortForwarding = true
+			torrentConfig.TrackerListenPacket = proxy.RefuseUDP
+		}
 	}
 
 	// Create client.
@@ -108,6 +174,13 @@ func NewTorrentClient(cfg ClientConfig, torrentDir, mediaDir string, resource st
 	if err != nil {
 		return nil, faults.Errorf("creating lib torrent client: %w", err)
 	}
+	if peerDialer != nil {
+		network := "tcp"
+		if proxyDialer == nil {
+			network = netbind.Network(cfg.BindIP)
+		}
+		c.AddDialer(torrent.NetworkDialer{Network: network, Dialer: peerDialer})
+	}
 
 	client.Client = c
 	client.torrentConfig = torrentConfig
@@ -146,6 +219,12 @@ func NewTorrentClient(cfg ClientConfig, torrentDir, mediaDir string, resource st
 		}
 	}
 
+	err = client.loadPriorities()
+	if err != nil {
+		// not being able to restore the priorities should not prevent streaming
+		slog.Warn("Failed to restore file priorities", "error", err)
+	}
+
 	return client, nil
 }
 
@@ -198,8 +277,32 @@ func isMagnet(s string) bool {
 
 func (c *TorrentClient) Play(file *torrent.File) {
 	c.File = file
-	c.status = StatusScanning
 
+	// the piece completion is persisted, so we only verify the data if the file changed since we last wrote it
+	if c.needsRecheck(file) {
+		c.verify(file)
+	}
+
+	c.status = StatusPlaying
+	c.torrentConfig.Seed = c.Config.Seed
+	c.torrentConfig.NoUpload = !c.Config.Seed
+
+	t := c.Torrent
+	// downloading only the pieces we need
+	t.DownloadPieces(file.BeginPieceIndex(), file.EndPieceIndex())
+
+	firstPieceIndex := file.Offset() * int64(t.NumPieces()) / t.Length()
+	endPieceIndex := (file.Offset() + file.Length()) * int64(t.NumPieces()) / t.Length()
+	// Prioritize the first % of the file.
+	firstPercentage := int64(float64(endPieceIndex) * (c.Config.FirstDownloadPercent / 100.0))
+	for idx := firstPieceIndex; idx <= firstPercentage; idx++ {
+		t.Piece(int(idx)).SetPriority(torrent.PiecePriorityNow)
+	}
+}
+
+// verify hashes every piece of the file, blocking until done
+func (c *TorrentClient) verify(file *torrent.File) {
+	c.status = StatusScanning
 	c.piecesComplete = 0
 	done := make(chan struct{})
 	c.shutdown.Enter()
@@ -212,7 +315,7 @@ func (c *TorrentClient) Play(file *torrent.File) {
 			}
 			err := v.VerifyData()
 			if err != nil {
-				slog.Error("Failed to verify piece data on startup", "error", err)
+				slog.Error("Failed to verify piece data", "error", err)
 				return
 			}
 			c.piecesComplete++
@@ -220,21 +323,77 @@ func (c *TorrentClient) Play(file *torrent.File) {
 	}()
 	<-done
 
-	c.status = StatusPlaying
-	c.torrentConfig.Seed = c.Config.Seed
-	c.torrentConfig.NoUpload = !c.Config.Seed
+	if c.shutdown.IsShuttingDown() {
+		return
+	}
+
+	err := c.saveResume()
+	if err != nil {
+		slog.Error("Failed to save resume data after verification", "error", err)
+	}
+}
+
+// Recheck verifies again all the pieces of the file being played
+func (c *TorrentClient) Recheck() {
+	if c.File == nil || c.status == StatusScanning {
+		return
+	}
+
+	previous := c.status
+	c.verify(c.File)
+	c.status = previous
+}
+
+// SetLimits changes the transfer limits of the running torrent
+func (c *TorrentClient) SetLimits(limits bandwidth.Limits) {
+	bandwidth.SetRate(c.torrentConfig.DownloadRateLimiter, limits.Download)
+	bandwidth.SetRate(c.torrentConfig.UploadRateLimiter, limits.Upload)
+
+	if limits.Pause {
+		c.Torrent.DisallowDataDownload()
+		c.Torrent.DisallowDataUpload()
+		return
+	}
 
+	c.Torrent.AllowDataDownload()
+	if !c.seedingStopped {
+		c.Torrent.AllowDataUpload()
+	}
+}
+
+// Transfer returns the bytes transferred since the client started
+func (c *TorrentClient) Transfer() app.Transfer {
 	t := c.Torrent
-	// downloading only the pieces we need
-	t.DownloadPieces(file.BeginPieceIndex(), file.EndPieceIndex())
+	if t == nil || t.Info() == nil {
+		return app.Transfer{}
+	}
 
-	firstPieceIndex := file.Offset() * int64(t.NumPieces()) / t.Length()
-	endPieceIndex := (file.Offset() + file.Length()) * int64(t.NumPieces()) / t.Length()
-	// Prioritize the first % of the file.
-	firstPercentage := int64(float64(endPieceIndex) * (c.Config.FirstDownloadPercent / 100.0))
-	for idx := firstPieceIndex; idx <= firstPercentage; idx++ {
-		t.Piece(int(idx)).SetPriority(torrent.PiecePriorityNow)
+	tStats := t.Stats()
+	uploaded := tStats.BytesWrittenData
+	downloaded := tStats.BytesReadUsefulData
+	complete := c.File != nil && c.File.BytesCompleted() >= c.File.Length()
+
+	return app.Transfer{
+		InfoHash:   strings.ToUpper(t.InfoHash().HexString()),
+		Started:    c.started,
+		Uploaded:   (&uploaded).Int64(),
+		Downloaded: (&downloaded).Int64(),
+		Seeding:    complete && c.status == StatusPlaying && c.Config.Seed && !c.seedingStopped,
+	}
+}
+
+// StopSeeding stops uploading for the rest of the session
+func (c *TorrentClient) StopSeeding() {
+	c.seedingStopped = true
+	c.Torrent.DisallowDataUpload()
+}
+
+// ResumeTorrent restarts the download of the file being played, if the torrent is paused
+func (c *TorrentClient) ResumeTorrent() {
+	if c.File == nil || c.status != StatusPaused {
+		return
 	}
+	c.Play(c.File)
 }
 
 func (c *TorrentClient) PauseTorrent() {
@@ -242,6 +401,11 @@ func (c *TorrentClient) PauseTorrent() {
 	c.torrentConfig.NoUpload = true
 	c.torrentConfig.Seed = false
 	c.Torrent.CancelPieces(0, c.Torrent.NumPieces())
+
+	err := c.saveResume()
+	if err != nil {
+		slog.Error("Failed to save resume data on pause", "error", err)
+	}
 }
 
 // Close cleans up the connections.
@@ -252,9 +416,16 @@ func (c *TorrentClient) Close() {
 		slog.Error("Failed closing torrent client.", "error", err)
 	}
 	c.shutdown = gracefull.New()
+
+	// after closing the client, all the data was written to disk
+	err := c.saveResume()
+	if err != nil {
+		slog.Error("Failed to save resume data on close", "error", err)
+	}
 }
 
-// Render outputs the command line interface for the client.
+// Stats returns the state of the file being played.
+// The transfer rates are not included, since they are measured over time by the stats collector.
 func (c *TorrentClient) Stats() app.Stats {
 	if c.File == nil || c.status == StatusPaused {
 		return app.Stats{}
@@ -267,7 +438,7 @@ func (c *TorrentClient) Stats() app.Stats {
 	}
 	if c.status == StatusScanning {
 		return app.Stats{
-			Complete:       c.Progress,
+			Complete:       c.File.BytesCompleted(),
 			Size:           c.File.Length(),
 			Pieces:         pieces,
 			Status:         app.StatusScanning,
@@ -280,43 +451,30 @@ func (c *TorrentClient) Stats() app.Stats {
 		return app.Stats{}
 	}
 
-	tStats := t.Stats()
-	// upload
-	bytesWrittenData := tStats.BytesWrittenData
-	currentUpload := (&bytesWrittenData).Int64()
-
-	currentProgress := c.File.BytesCompleted()
+	complete := c.File.BytesCompleted()
 	size := c.File.Length()
 
 	stats := app.Stats{
-		Complete:      currentProgress,
-		Size:          size,
-		DownloadSpeed: currentProgress - c.Progress,
-		UploadSpeed:   currentUpload - c.Uploaded,
-		Seeders:       tStats.ConnectedSeeders,
-		Done:          currentProgress >= size,
-		Pieces:        pieces,
-	}
-
-	c.Progress = currentProgress
-	c.Uploaded = currentUpload
-	c.Size = size
-
-	if stats.Done && !c.Config.SeedAfterComplete {
-		c.PauseTorrent()
-		stats.UploadSpeed = 0
-		stats.DownloadSpeed = 0
-		stats.Seeders = 0
+		Complete: complete,
+		Size:     size,
+		Seeders:  t.Stats().ConnectedSeeders,
+		Done:     complete >= size,
+		Pieces:   pieces,
+		ReadyIn:  -1,
 	}
 
-	if c.ReadyForPlayback() {
-		stats.Status = app.StatusReadyForPlayback
+	eta, known := c.readyIn(fps)
+	if known {
+		stats.ReadyIn = eta
+		if eta == 0 {
+			stats.Status = app.StatusReadyForPlayback
+		}
 	}
 
 	return stats
 }
 
-func (c TorrentClient) GetFilteredFiles() []*torrent.File {
+func (c *TorrentClient) GetFilteredFiles() []*torrent.File {
 	var maxSize int64
 
 	files := c.Torrent.Files()
@@ -346,7 +504,52 @@ func (c TorrentClient) GetFilteredFiles() []*torrent.File {
 	return result
 }
 
-func (c TorrentClient) GetName() string {
+// MetaInfo returns the torrent metadata without requiring any piece to be downloaded.
+func (c *TorrentClient) MetaInfo() app.TorrentInfo {
+	t := c.Torrent
+	if t == nil || t.Info() == nil {
+		return app.TorrentInfo{}
+	}
+
+	info := t.Info()
+	mi := t.Metainfo()
+
+	var trackers []string
+	for _, tier := range mi.UpvertedAnnounceList() {
+		for _, tr := range tier {
+			if !slices.Contains(trackers, tr) {
+				trackers = append(trackers, tr)
+			}
+		}
+	}
+
+	files := t.Files()
+	result := app.TorrentInfo{
+		Name:        info.Name,
+		InfoHash:    strings.ToUpper(t.InfoHash().HexString()),
+		Size:        t.Length(),
+		PieceLength: info.PieceLength,
+		NumPieces:   t.NumPieces(),
+		CreatedBy:   mi.CreatedBy,
+		Comment:     mi.Comment,
+		Trackers:    trackers,
+		Private:     info.Private != nil && *info.Private,
+		Files:       make([]app.TorrentFileInfo, 0, len(files)),
+	}
+	if mi.CreationDate > 0 {
+		result.CreationDate = time.Unix(mi.CreationDate, 0)
+	}
+	for _, f := range files {
+		result.Files = append(result.Files, app.TorrentFileInfo{
+			Path: f.Path(),
+			Size: f.Length(),
+		})
+	}
+
+	return result
+}
+
+func (c *TorrentClient) GetName() string {
 	if c.Torrent == nil || c.Torrent.Info() == nil {
 		return ""
 	}
@@ -354,16 +557,18 @@ func (c TorrentClient) GetName() string {
 	return c.Torrent.Info().Name
 }
 
-// ReadyForPlayback checks if the torrent is ready for playback or not.
-// We wait until 0.5% of the torrent to start playing.
-func (c TorrentClient) ReadyForPlayback() bool {
-	percentage := float64(c.Progress) / float64(c.Size) * 100
-
-	return percentage > float64(c.Config.FirstDownloadPercent)
+// ReadyForPlayback checks if the file can be played through without stalling,
+// comparing the media bitrate with the download rate.
+func (c *TorrentClient) ReadyForPlayback() bool {
+	if c.File == nil {
+		return false
+	}
+	eta, known := c.readyIn(c.File.State())
+	return known && eta == 0
 }
 
 // GetFile is an http handler to serve the biggest file managed by the client.
-func (c TorrentClient) GetFile(filename string) func(w http.ResponseWriter, r *http.Request) {
+func (c *TorrentClient) GetFile(filename string) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		target := c.File
 		entry, err := NewFileReader(target)
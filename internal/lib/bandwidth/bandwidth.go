@@ -0,0 +1,120 @@
+// Package bandwidth computes the transfer limits in effect at a given moment, from a weekly schedule.
+package bandwidth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/quintans/faults"
+)
+
+// Limits are the transfer rates in bytes per second. Zero means unlimited.
+type Limits struct {
+	Download int `json:"download"`
+	Upload   int `json:"upload"`
+	// Pause stops all transfers
+	Pause bool `json:"pause,omitempty"`
+}
+
+func (l Limits) String() string {
+	if l.Pause {
+		return "paused"
+	}
+	return fmt.Sprintf("down %s, up %s", rateString(l.Download), rateString(l.Upload))
+}
+
+func rateString(rate int) string {
+	if rate <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d KiB/s", rate/1024)
+}
+
+// Window applies its limits on the given days between start and end.
+// If end is not after start, the window extends into the next day.
+type Window struct {
+	// Days are the week days where the window starts, eg: "mon", "tue". Empty means every day.
+	Days []string `json:"days,omitempty"`
+	// Start is the time of the day, in the format HH:MM
+	Start string `json:"start"`
+	// End is the time of the day, in the format HH:MM
+	End string `json:"end"`
+	Limits
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Current returns the limits of the first window of the schedule that includes now, falling back to base.
+func Current(base Limits, schedule []Window, now time.Time) (Limits, error) {
+	for _, w := range schedule {
+		in, err := w.includes(now)
+		if err != nil {
+			return base, err
+		}
+		if in {
+			return w.Limits, nil
+		}
+	}
+	return base, nil
+}
+
+// Validate checks that every window is well formed
+func Validate(schedule []Window) error {
+	for _, w := range schedule {
+		_, err := w.includes(time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w Window) includes(now time.Time) (bool, error) {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return false, faults.Errorf("parsing window start: %w", err)
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return false, faults.Errorf("parsing window end: %w", err)
+	}
+
+	days := map[time.Weekday]bool{}
+	for _, d := range w.Days {
+		wd, ok := weekdays[strings.ToLower(d)[:min(3, len(d))]]
+		if !ok {
+			return false, faults.Errorf("unknown week day '%s'", d)
+		}
+		days[wd] = true
+	}
+	startsOn := func(d time.Weekday) bool {
+		return len(days) == 0 || days[d]
+	}
+
+	clock := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	today := now.Weekday()
+	if start < end {
+		return startsOn(today) && clock >= start && clock < end, nil
+	}
+
+	// crosses midnight: either it started today or it started yesterday
+	yesterday := (today + 6) % 7
+	return (startsOn(today) && clock >= start) || (startsOn(yesterday) && clock < end), nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, faults.Errorf("invalid time of day '%s': %w", s, err)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
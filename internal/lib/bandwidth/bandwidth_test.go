@@ -0,0 +1,47 @@
+package bandwidth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quintans/torflix/internal/lib/bandwidth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCurrent(t *testing.T) {
+	base := bandwidth.Limits{Download: 1000, Upload: 100}
+	work := bandwidth.Limits{Download: 10, Upload: 1}
+	schedule := []bandwidth.Window{
+		{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "18:00", Limits: work},
+		{Days: []string{"sat"}, Start: "23:00", End: "02:00", Limits: bandwidth.Limits{Pause: true}},
+	}
+
+	// 2024-01-01 is a monday
+	tests := []struct {
+		name string
+		now  time.Time
+		want bandwidth.Limits
+	}{
+		{name: "working hours", now: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC), want: work},
+		{name: "after work", now: time.Date(2024, 1, 1, 18, 0, 0, 0, time.UTC), want: base},
+		{name: "sunday", now: time.Date(2024, 1, 7, 10, 0, 0, 0, time.UTC), want: base},
+		{name: "saturday night", now: time.Date(2024, 1, 6, 23, 30, 0, 0, time.UTC), want: bandwidth.Limits{Pause: true}},
+		{name: "after midnight", now: time.Date(2024, 1, 7, 1, 59, 0, 0, time.UTC), want: bandwidth.Limits{Pause: true}},
+		{name: "friday night", now: time.Date(2024, 1, 5, 23, 30, 0, 0, time.UTC), want: base},
+		{name: "saturday after midnight", now: time.Date(2024, 1, 6, 1, 0, 0, 0, time.UTC), want: base},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bandwidth.Current(base, schedule, tt.now)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, bandwidth.Validate([]bandwidth.Window{{Start: "00:00", End: "23:59"}}))
+	require.Error(t, bandwidth.Validate([]bandwidth.Window{{Start: "25:00", End: "23:59"}}))
+	require.Error(t, bandwidth.Validate([]bandwidth.Window{{Days: []string{"xyz"}, Start: "01:00", End: "02:00"}}))
+}
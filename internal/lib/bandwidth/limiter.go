@@ -0,0 +1,27 @@
+package bandwidth
+
+import "golang.org/x/time/rate"
+
+// limiterBurst is the most bytes a limiter lets through at once.
+// It must fit the largest chunk asked by peers, 64 KiB, and be small enough for a lower limit to hold right away.
+const limiterBurst = 256 << 10
+
+// NewLimiter returns a rate limiter of bytes per second, where zero is unlimited.
+// Its burst is finite so that a limit set while running throttles at once.
+func NewLimiter(bytesPerSec int) *rate.Limiter {
+	return rate.NewLimiter(rateLimit(bytesPerSec), limiterBurst)
+}
+
+// SetRate changes the rate of the limiter, in bytes per second, where zero is unlimited
+func SetRate(l *rate.Limiter, bytesPerSec int) {
+	l.SetLimit(rateLimit(bytesPerSec))
+	// an unlimited limiter may have been given an unbounded burst
+	l.SetBurst(limiterBurst)
+}
+
+func rateLimit(bytesPerSec int) rate.Limit {
+	if bytesPerSec <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(bytesPerSec)
+}
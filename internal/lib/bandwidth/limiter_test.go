@@ -0,0 +1,36 @@
+package bandwidth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quintans/torflix/internal/lib/bandwidth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetRateThrottles(t *testing.T) {
+	l := bandwidth.NewLimiter(0)
+	now := time.Now()
+	r := l.ReserveN(now, 64<<10)
+	require.True(t, r.OK())
+	assert.Zero(t, r.DelayFrom(now))
+
+	// limited while running, only the burst goes through at once
+	bandwidth.SetRate(l, 10<<10)
+	now = now.Add(time.Second)
+	for range 4 {
+		r = l.ReserveN(now, 64<<10)
+		require.True(t, r.OK())
+		assert.Zero(t, r.DelayFrom(now))
+	}
+	r = l.ReserveN(now, 10<<10)
+	require.True(t, r.OK())
+	assert.InDelta(t, time.Second, r.DelayFrom(now), float64(10*time.Millisecond))
+
+	// unlimited again
+	bandwidth.SetRate(l, 0)
+	r = l.ReserveN(now, 1<<20)
+	require.True(t, r.OK())
+	assert.Zero(t, r.DelayFrom(now))
+}
@@ -0,0 +1,266 @@
+// Package blocklist loads IP blocklists in the P2P (PeerGuardian) and DAT (eMule ipfilter) formats.
+package blocklist
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/iplist"
+	"github.com/quintans/faults"
+)
+
+// DAT entries with an access level above this value are allowed
+const datMaxBlockedLevel = 127
+
+var isHTTP = regexp.MustCompile(`^https?://`)
+
+// Parse reads a blocklist, detecting the format of each line.
+// Gzipped lists are also accepted.
+func Parse(r io.Reader) ([]iplist.Range, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	var rd io.Reader = br
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, faults.Errorf("opening gzip: %w", err)
+		}
+		defer gz.Close()
+		rd = gz
+	}
+
+	var ranges []iplist.Range
+	scanner := bufio.NewScanner(rd)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		r, ok, err := parseLine(scanner.Text())
+		if err != nil {
+			return nil, faults.Errorf("parsing line %d: %w", lineNum, err)
+		}
+		if ok {
+			ranges = append(ranges, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, faults.Errorf("reading blocklist: %w", err)
+	}
+
+	return ranges, nil
+}
+
+func parseLine(line string) (iplist.Range, bool, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+		return iplist.Range{}, false, nil
+	}
+
+	// DAT: first - last , level , description
+	if fields := strings.SplitN(line, ",", 3); len(fields) >= 2 && strings.Contains(fields[0], "-") {
+		level, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+		if err == nil {
+			if level > datMaxBlockedLevel {
+				return iplist.Range{}, false, nil
+			}
+			first, last, found := strings.Cut(fields[0], "-")
+			if !found {
+				return iplist.Range{}, false, faults.New("missing hyphen")
+			}
+			r := iplist.Range{
+				First: parseIP(first),
+				Last:  parseIP(last),
+			}
+			if len(fields) == 3 {
+				r.Description = strings.TrimSpace(fields[2])
+			}
+			if r.First == nil || r.Last == nil || len(r.First) != len(r.Last) {
+				return iplist.Range{}, false, faults.Errorf("bad IP range '%s'", fields[0])
+			}
+			return r, true, nil
+		}
+	}
+
+	// P2P: description:first-last
+	r, ok, err := iplist.ParseBlocklistP2PLine([]byte(line))
+	if err != nil {
+		return iplist.Range{}, false, faults.Errorf("invalid line '%s': %w", line, err)
+	}
+	return r, ok, nil
+}
+
+// parseIP parses an IP allowing the zero padded IPv4 of the DAT format, eg: 001.002.003.004
+func parseIP(s string) net.IP {
+	s = strings.TrimSpace(s)
+	parts := strings.Split(s, ".")
+	if len(parts) == 4 {
+		for i, p := range parts {
+			trimmed := strings.TrimLeft(p, "0")
+			if trimmed == "" {
+				trimmed = "0"
+			}
+			parts[i] = trimmed
+		}
+		s = strings.Join(parts, ".")
+	}
+	ip := net.ParseIP(s)
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip
+}
+
+// New builds a lookup list from unsorted ranges
+func New(ranges []iplist.Range) *iplist.IPList {
+	slices.SortFunc(ranges, func(a, b iplist.Range) int {
+		if len(a.First) != len(b.First) {
+			return len(a.First) - len(b.First)
+		}
+		return bytes.Compare(a.First, b.First)
+	})
+	return iplist.New(ranges)
+}
+
+// maxTracked bounds the addresses remembered by a Counter
+const maxTracked = 1 << 16
+
+// Counter counts the unique peer addresses that matched a blocked range.
+// The torrent client looks an address up more than once, when it is learned, dialed or accepted,
+// so each address is only counted once, up to maxTracked addresses.
+type Counter struct {
+	iplist.Ranger
+
+	mu      sync.Mutex
+	blocked map[string]struct{}
+}
+
+func (c *Counter) Lookup(ip net.IP) (iplist.Range, bool) {
+	r, ok := c.Ranger.Lookup(ip)
+	if ok {
+		c.mu.Lock()
+		if len(c.blocked) < maxTracked {
+			if c.blocked == nil {
+				c.blocked = map[string]struct{}{}
+			}
+			c.blocked[ip.String()] = struct{}{}
+		}
+		c.mu.Unlock()
+	}
+	return r, ok
+}
+
+// Blocked returns the number of unique blocked peer addresses
+func (c *Counter) Blocked() int64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return int64(len(c.blocked))
+}
+
+const (
+	// loadTimeout bounds the loading of the blocklists, so a hung URL does not hold the torrent
+	loadTimeout = 30 * time.Second
+	// retryAfter is how long a failed load is reported again, instead of loading the blocklists on every torrent
+	retryAfter = 10 * time.Minute
+)
+
+// Loader keeps the blocklist loaded from the sources, only loading it again if the sources change.
+// A failed load is only retried after a while.
+type Loader struct {
+	HTTPClient *http.Client
+
+	mu      sync.Mutex
+	sources []string
+	ranger  iplist.Ranger
+	err     error
+	failed  time.Time
+}
+
+// Get returns a blocklist of the sources, that can be files or URLs, with its own count of blocked peers.
+// It returns nil if there are no sources.
+func (l *Loader) Get(ctx context.Context, sources []string) (*Counter, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(sources) == 0 {
+		l.sources = nil
+		l.ranger = nil
+		l.err = nil
+		return nil, nil
+	}
+	if slices.Equal(l.sources, sources) {
+		if l.ranger != nil {
+			return &Counter{Ranger: l.ranger}, nil
+		}
+		if l.err != nil && time.Since(l.failed) < retryAfter {
+			return nil, l.err
+		}
+	}
+
+	ranger, err := l.loadAll(ctx, sources)
+	l.sources = slices.Clone(sources)
+	l.ranger = ranger
+	l.err = err
+	if err != nil {
+		l.failed = time.Now()
+		return nil, err
+	}
+	return &Counter{Ranger: ranger}, nil
+}
+
+func (l *Loader) loadAll(ctx context.Context, sources []string) (iplist.Ranger, error) {
+	ctx, cancel := context.WithTimeout(ctx, loadTimeout)
+	defer cancel()
+
+	var ranges []iplist.Range
+	for _, src := range sources {
+		r, err := l.load(ctx, src)
+		if err != nil {
+			return nil, faults.Errorf("loading blocklist '%s': %w", src, err)
+		}
+		ranges = append(ranges, r...)
+	}
+	return New(ranges), nil
+}
+
+func (l *Loader) load(ctx context.Context, src string) ([]iplist.Range, error) {
+	if !isHTTP.MatchString(src) {
+		f, err := os.Open(src)
+		if err != nil {
+			return nil, faults.Errorf("opening file: %w", err)
+		}
+		defer f.Close()
+		return Parse(f)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return nil, faults.Errorf("creating request: %w", err)
+	}
+	client := l.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, faults.Errorf("downloading: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, faults.Errorf("response status code %d", resp.StatusCode)
+	}
+	return Parse(resp.Body)
+}
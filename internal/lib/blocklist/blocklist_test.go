@@ -0,0 +1,108 @@
+package blocklist_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/quintans/torflix/internal/lib/blocklist"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const p2pList = `# comment
+Some Org:1.2.3.0-1.2.3.255
+Other:10.0.0.1-10.0.0.1
+`
+
+const datList = `// comment
+001.002.004.000 - 001.002.004.255 , 000 , Bad
+005.006.007.000 - 005.006.007.255 , 200 , Allowed
+`
+
+func TestParse(t *testing.T) {
+	ranges, err := blocklist.Parse(strings.NewReader(p2pList + datList))
+	require.NoError(t, err)
+	require.Len(t, ranges, 3)
+	assert.Equal(t, "Bad", ranges[2].Description)
+
+	list := blocklist.New(ranges)
+	_, ok := list.Lookup(net.ParseIP("1.2.3.4"))
+	assert.True(t, ok)
+	_, ok = list.Lookup(net.ParseIP("1.2.4.200"))
+	assert.True(t, ok)
+	_, ok = list.Lookup(net.ParseIP("10.0.0.2"))
+	assert.False(t, ok)
+	_, ok = list.Lookup(net.ParseIP("5.6.7.8"))
+	assert.False(t, ok)
+
+	_, err = blocklist.Parse(strings.NewReader("garbage"))
+	require.Error(t, err)
+}
+
+func TestParseGzip(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(p2pList))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	ranges, err := blocklist.Parse(&buf)
+	require.NoError(t, err)
+	assert.Len(t, ranges, 2)
+}
+
+func TestLoader(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(p2pList))
+	}))
+	defer server.Close()
+
+	loader := &blocklist.Loader{}
+	list, err := loader.Get(context.Background(), []string{server.URL})
+	require.NoError(t, err)
+
+	_, ok := list.Lookup(net.ParseIP("10.0.0.1"))
+	assert.True(t, ok)
+	_, ok = list.Lookup(net.ParseIP("10.0.0.2"))
+	assert.False(t, ok)
+	// the same address looked up again is not counted
+	_, ok = list.Lookup(net.ParseIP("10.0.0.1"))
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), list.Blocked())
+
+	// each torrent counts its own blocked peers, from the list already loaded
+	again, err := loader.Get(context.Background(), []string{server.URL})
+	require.NoError(t, err)
+	assert.Zero(t, again.Blocked())
+	assert.Equal(t, 1, calls)
+
+	none, err := loader.Get(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Nil(t, none)
+}
+
+func TestLoaderFailure(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	loader := &blocklist.Loader{}
+	_, err := loader.Get(context.Background(), []string{server.URL})
+	require.Error(t, err)
+
+	// the failure is reported again without loading
+	_, err = loader.Get(context.Background(), []string{server.URL})
+	require.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
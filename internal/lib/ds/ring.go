@@ -0,0 +1,40 @@
+package ds
+
+// Ring keeps the last values pushed, up to its capacity
+type Ring[T any] struct {
+	values []T
+	next   int
+	full   bool
+}
+
+func NewRing[T any](capacity int) *Ring[T] {
+	return &Ring[T]{values: make([]T, capacity)}
+}
+
+func (r *Ring[T]) Push(v T) {
+	if len(r.values) == 0 {
+		return
+	}
+	r.values[r.next] = v
+	r.next = (r.next + 1) % len(r.values)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+func (r *Ring[T]) Len() int {
+	if r.full {
+		return len(r.values)
+	}
+	return r.next
+}
+
+// Values returns a copy of the values, from the oldest to the newest
+func (r *Ring[T]) Values() []T {
+	if !r.full {
+		return append([]T(nil), r.values[:r.next]...)
+	}
+	out := make([]T, 0, len(r.values))
+	out = append(out, r.values[r.next:]...)
+	return append(out, r.values[:r.next]...)
+}
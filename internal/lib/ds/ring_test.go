@@ -0,0 +1,24 @@
+package ds_test
+
+import (
+	"testing"
+
+	"github.com/quintans/torflix/internal/lib/ds"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	r := ds.NewRing[int](3)
+	assert.Empty(t, r.Values())
+
+	r.Push(1)
+	r.Push(2)
+	assert.Equal(t, []int{1, 2}, r.Values())
+	assert.Equal(t, 2, r.Len())
+
+	r.Push(3)
+	r.Push(4)
+	r.Push(5)
+	assert.Equal(t, []int{3, 4, 5}, r.Values())
+	assert.Equal(t, 3, r.Len())
+}
@@ -0,0 +1,34 @@
+// Package ewma smooths a series of values with an exponentially weighted moving average.
+package ewma
+
+// EWMA is not safe for concurrent use
+type EWMA struct {
+	alpha float64
+	value float64
+	set   bool
+}
+
+// New creates an average where alpha, between 0 and 1, is the weight of each new value
+func New(alpha float64) *EWMA {
+	return &EWMA{alpha: alpha}
+}
+
+// Add includes the value in the average, returning the new average
+func (e *EWMA) Add(v float64) float64 {
+	if !e.set {
+		e.value = v
+		e.set = true
+		return v
+	}
+	e.value = e.alpha*v + (1-e.alpha)*e.value
+	return e.value
+}
+
+func (e *EWMA) Value() float64 {
+	return e.value
+}
+
+// Set tells if any value was added
+func (e *EWMA) Set() bool {
+	return e.set
+}
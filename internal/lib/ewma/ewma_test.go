@@ -0,0 +1,18 @@
+package ewma_test
+
+import (
+	"testing"
+
+	"github.com/quintans/torflix/internal/lib/ewma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEWMA(t *testing.T) {
+	e := ewma.New(0.5)
+	assert.False(t, e.Set())
+	assert.Equal(t, 10.0, e.Add(10))
+	assert.Equal(t, 15.0, e.Add(20))
+	assert.Equal(t, 7.5, e.Add(0))
+	assert.Equal(t, 7.5, e.Value())
+	assert.True(t, e.Set())
+}
@@ -3,6 +3,7 @@ package https
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"slices"
@@ -12,6 +13,17 @@ import (
 	"github.com/quintans/torflix/internal/lib/retry"
 )
 
+// StatusError is a response with an unexpected status code
+type StatusError struct {
+	URL  string
+	Code int
+	Body []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("response status code %d for %s; response: %s", e.Code, e.URL, string(e.Body))
+}
+
 type Client struct {
 	BaseURL string
 	Header  http.Header
@@ -74,7 +86,7 @@ func (c *Client) Request(method, uri string, request any, response any, header h
 		if err != nil {
 			return retry.NewPermanentError(faults.Errorf("reading response body: %w", err))
 		}
-		return retry.NewPermanentError(faults.Errorf("response status code %d for %s; response: %s", resp.StatusCode, url, string(body)))
+		return retry.NewPermanentError(faults.Errorf("unexpected response: %w", &StatusError{URL: url, Code: resp.StatusCode, Body: body}))
 	}
 
 	if response != nil {
@@ -0,0 +1,63 @@
+// Package lang normalizes the language codes used by the subtitle sources,
+// that mix ISO 639-1 (en), ISO 639-2 (eng, fre or fra) and IETF tags (pt-BR).
+package lang
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// alpha3 maps the ISO 639-2 codes, bibliographic and terminologic, to ISO 639-1
+var alpha3 = map[string]string{
+	"ara": "ar", "bul": "bg", "cat": "ca", "chi": "zh", "zho": "zh", "cze": "cs", "ces": "cs",
+	"dan": "da", "dut": "nl", "nld": "nl", "eng": "en", "est": "et", "fin": "fi", "fre": "fr",
+	"fra": "fr", "ger": "de", "deu": "de", "gre": "el", "ell": "el", "heb": "he", "hin": "hi",
+	"hrv": "hr", "hun": "hu", "ind": "id", "ice": "is", "isl": "is", "ita": "it", "jpn": "ja",
+	"kor": "ko", "lav": "lv", "lit": "lt", "may": "ms", "msa": "ms", "nor": "no", "nob": "no",
+	"per": "fa", "fas": "fa", "pol": "pl", "por": "pt", "rum": "ro", "ron": "ro", "rus": "ru",
+	"slo": "sk", "slk": "sk", "slv": "sl", "spa": "es", "srp": "sr", "swe": "sv", "tha": "th",
+	"tur": "tr", "ukr": "uk", "vie": "vi",
+}
+
+// Base returns the ISO 639-1 code of the language, without the region, or the code lower cased if unknown.
+// eg: pt-BR and por are pt
+func Base(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	base, _, _ := strings.Cut(strings.ReplaceAll(code, "_", "-"), "-")
+	if a, ok := alpha3[base]; ok {
+		return a
+	}
+	return base
+}
+
+// Rank returns the position of the language in the preferred ones, comparing the exact code first
+// and then the base language, or the number of preferred languages if not found.
+func Rank(code string, preferred []string) int {
+	for i, p := range preferred {
+		if strings.EqualFold(p, code) {
+			return i
+		}
+	}
+	base := Base(code)
+	for i, p := range preferred {
+		if Base(p) == base {
+			return i
+		}
+	}
+	return len(preferred)
+}
+
+// OfFilename returns the language before the extension of a subtitle file, eg: pt in movie.pt.srt, or empty if there is none
+func OfFilename(filename string) string {
+	name := strings.TrimSuffix(filename, filepath.Ext(filename))
+	code := strings.TrimPrefix(filepath.Ext(name), ".")
+	switch {
+	case len(code) == 2, len(code) == 5 && code[2] == '-':
+		return code
+	case len(code) == 3 && len(Base(code)) == 2:
+		// other three letter words, like HDR, are not languages
+		return code
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,32 @@
+package lang_test
+
+import (
+	"testing"
+
+	"github.com/quintans/torflix/internal/lib/lang"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBase(t *testing.T) {
+	assert.Equal(t, "pt", lang.Base("pt-BR"))
+	assert.Equal(t, "pt", lang.Base("por"))
+	assert.Equal(t, "fr", lang.Base("fre"))
+	assert.Equal(t, "en", lang.Base("EN"))
+	assert.Equal(t, "xx", lang.Base("xx"))
+}
+
+func TestRank(t *testing.T) {
+	preferred := []string{"pt-PT", "pt-BR", "en"}
+	assert.Equal(t, 1, lang.Rank("pt-BR", preferred))
+	assert.Equal(t, 0, lang.Rank("por", preferred))
+	assert.Equal(t, 2, lang.Rank("eng", preferred))
+	assert.Equal(t, 3, lang.Rank("spa", preferred))
+}
+
+func TestOfFilename(t *testing.T) {
+	assert.Equal(t, "pt", lang.OfFilename("Movie.2020.pt.srt"))
+	assert.Equal(t, "pt-BR", lang.OfFilename("Movie.2020.pt-BR.vtt"))
+	assert.Equal(t, "fre", lang.OfFilename("Movie.2020.fre.ass"))
+	assert.Empty(t, lang.OfFilename("Movie.2020.HDR.srt"))
+	assert.Empty(t, lang.OfFilename("movie.srt"))
+}
@@ -0,0 +1,36 @@
+// Package moviehash computes the hash used by OpenSubtitles to match subtitles with a video file.
+// It is the file size plus the sums of the 64 bit little endian words of the first and last 64 KiB.
+package moviehash
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/quintans/faults"
+)
+
+// ChunkSize is the size of the start and of the end of the file that are hashed
+const ChunkSize = 64 << 10
+
+// Compute returns the hash of the file, as 16 hexadecimal digits.
+// Only the first and last ChunkSize bytes are read.
+func Compute(r io.ReaderAt, size int64) (string, error) {
+	if size < ChunkSize {
+		return "", faults.Errorf("file of %d bytes is smaller than %d bytes", size, ChunkSize)
+	}
+
+	hash := uint64(size)
+	buf := make([]byte, ChunkSize)
+	for _, offset := range []int64{0, size - ChunkSize} {
+		_, err := r.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return "", faults.Errorf("reading %d bytes at %d: %w", ChunkSize, offset, err)
+		}
+		for i := 0; i < ChunkSize; i += 8 {
+			hash += binary.LittleEndian.Uint64(buf[i:])
+		}
+	}
+
+	return fmt.Sprintf("%016x", hash), nil
+}
@@ -0,0 +1,38 @@
+package moviehash_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/quintans/torflix/internal/lib/moviehash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompute(t *testing.T) {
+	size := 3 * moviehash.ChunkSize
+	data := make([]byte, size)
+	// one word at the start, one in the middle, that is not hashed, and one at the end
+	binary.LittleEndian.PutUint64(data[8:], 0x10)
+	binary.LittleEndian.PutUint64(data[moviehash.ChunkSize+8:], 0xffff)
+	binary.LittleEndian.PutUint64(data[size-8:], 0x200)
+
+	hash, err := moviehash.Compute(bytes.NewReader(data), int64(size))
+	require.NoError(t, err)
+	assert.Equal(t, "0000000000030210", hash)
+}
+
+func TestComputeOverflow(t *testing.T) {
+	data := bytes.Repeat([]byte{0xff}, moviehash.ChunkSize)
+
+	// every word is -1, so the sums wrap around 64 bits: 0x10000 - 2*8192
+	hash, err := moviehash.Compute(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	assert.Equal(t, "000000000000c000", hash)
+}
+
+func TestComputeSmallFile(t *testing.T) {
+	_, err := moviehash.Compute(bytes.NewReader(make([]byte, 10)), 10)
+	require.Error(t, err)
+}
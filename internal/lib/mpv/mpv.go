@@ -0,0 +1,171 @@
+// Package mpv controls a running mpv through its JSON IPC, enabled with --input-ipc-server.
+package mpv
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/quintans/faults"
+)
+
+var (
+	// ErrClosed is returned when the connection to mpv is gone, usually because it was closed
+	ErrClosed = errors.New("mpv connection closed")
+	// ErrUnavailable is returned when reading a property that has no value yet, eg: the duration before the file is loaded
+	ErrUnavailable = errors.New("property unavailable")
+)
+
+// dialInterval is how often the socket is tried while mpv is starting
+const dialInterval = 100 * time.Millisecond
+
+type message struct {
+	Data      json.RawMessage `json:"data"`
+	Error     string          `json:"error"`
+	RequestID int             `json:"request_id"`
+	Event     string          `json:"event"`
+}
+
+// Client sends commands to mpv and waits for their replies. Events are ignored.
+type Client struct {
+	conn net.Conn
+
+	mu      sync.Mutex
+	nextID  int
+	pending map[int]chan message
+	closed  bool
+}
+
+// Dial connects to the socket of mpv, waiting for mpv to create it until the context is done
+func Dial(ctx context.Context, socket string) (*Client, error) {
+	var d net.Dialer
+	for {
+		conn, err := d.DialContext(ctx, "unix", socket)
+		if err == nil {
+			return New(conn), nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, faults.Errorf("connecting to mpv at '%s': %w", socket, err)
+		case <-time.After(dialInterval):
+		}
+	}
+}
+
+// New returns a client talking to mpv through the connection
+func New(conn net.Conn) *Client {
+	c := &Client{
+		conn:    conn,
+		pending: map[int]chan message{},
+	}
+	go c.read()
+	return c
+}
+
+func (c *Client) read() {
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var msg message
+		if json.Unmarshal(scanner.Bytes(), &msg) != nil || msg.Event != "" {
+			continue
+		}
+
+		c.mu.Lock()
+		reply, ok := c.pending[msg.RequestID]
+		delete(c.pending, msg.RequestID)
+		c.mu.Unlock()
+		if ok {
+			reply <- msg
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for id, reply := range c.pending {
+		close(reply)
+		delete(c.pending, id)
+	}
+}
+
+// Command runs the mpv command, eg: "seek", 10, "relative", returning the data of the reply
+func (c *Client) Command(ctx context.Context, args ...any) (json.RawMessage, error) {
+	if len(args) == 0 {
+		return nil, faults.New("missing mpv command")
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, faults.Wrap(ErrClosed)
+	}
+	c.nextID++
+	id := c.nextID
+	reply := make(chan message, 1)
+	c.pending[id] = reply
+	c.mu.Unlock()
+
+	data, err := json.Marshal(map[string]any{"command": args, "request_id": id})
+	if err != nil {
+		c.forget(id)
+		return nil, faults.Errorf("encoding mpv command %v: %w", args[0], err)
+	}
+	_, err = c.conn.Write(append(data, '\n'))
+	if err != nil {
+		c.forget(id)
+		return nil, faults.Errorf("sending mpv command %v: %w: %w", args[0], ErrClosed, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		c.forget(id)
+		return nil, faults.Wrap(ctx.Err())
+	case msg, ok := <-reply:
+		if !ok {
+			return nil, faults.Wrap(ErrClosed)
+		}
+		switch msg.Error {
+		case "success":
+			return msg.Data, nil
+		case ErrUnavailable.Error():
+			return nil, faults.Errorf("mpv command %v: %w", args[0], ErrUnavailable)
+		default:
+			return nil, faults.Errorf("mpv command %v: %s", args[0], msg.Error)
+		}
+	}
+}
+
+func (c *Client) forget(id int) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// Get reads the property into v
+func (c *Client) Get(ctx context.Context, name string, v any) error {
+	data, err := c.Command(ctx, "get_property", name)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return faults.Errorf("decoding mpv property %s: %w", name, err)
+	}
+	return nil
+}
+
+// Set changes the property
+func (c *Client) Set(ctx context.Context, name string, value any) error {
+	_, err := c.Command(ctx, "set_property", name, value)
+	return err
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
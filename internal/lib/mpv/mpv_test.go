@@ -0,0 +1,119 @@
+package mpv_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/quintans/torflix/internal/lib/mpv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMPV answers the commands like mpv, sending an event before each reply
+func fakeMPV(t *testing.T, conn net.Conn, props map[string]any) {
+	t.Helper()
+	go func() {
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			var req struct {
+				Command   []any `json:"command"`
+				RequestID int   `json:"request_id"`
+			}
+			if json.Unmarshal(scanner.Bytes(), &req) != nil {
+				return
+			}
+
+			reply := map[string]any{"request_id": req.RequestID, "error": "success"}
+			switch req.Command[0] {
+			case "get_property":
+				v, ok := props[req.Command[1].(string)]
+				if ok {
+					reply["data"] = v
+				} else {
+					reply["error"] = "property unavailable"
+				}
+			case "set_property":
+				props[req.Command[1].(string)] = req.Command[2]
+			default:
+				reply["error"] = "invalid parameter"
+			}
+
+			fmt.Fprintln(conn, `{"event":"property-change","name":"pause"}`)
+			data, _ := json.Marshal(reply)
+			fmt.Fprintln(conn, string(data))
+		}
+	}()
+}
+
+func TestClient(t *testing.T) {
+	server, conn := net.Pipe()
+	fakeMPV(t, server, map[string]any{"time-pos": 12.5, "pause": false})
+	c := mpv.New(conn)
+	defer c.Close()
+	ctx := context.Background()
+
+	var pos float64
+	require.NoError(t, c.Get(ctx, "time-pos", &pos))
+	assert.Equal(t, 12.5, pos)
+
+	require.NoError(t, c.Set(ctx, "pause", true))
+	var paused bool
+	require.NoError(t, c.Get(ctx, "pause", &paused))
+	assert.True(t, paused)
+
+	var duration float64
+	err := c.Get(ctx, "duration", &duration)
+	require.ErrorIs(t, err, mpv.ErrUnavailable)
+
+	_, err = c.Command(ctx, "unknown")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid parameter")
+}
+
+func TestClientClosed(t *testing.T) {
+	server, conn := net.Pipe()
+	c := mpv.New(conn)
+	// mpv quits without replying
+	go func() {
+		_, _ = bufio.NewReader(server).ReadString('\n')
+		server.Close()
+	}()
+
+	_, err := c.Command(context.Background(), "get_property", "pause")
+	require.ErrorIs(t, err, mpv.ErrClosed)
+}
+
+func TestDial(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "mpv.sock")
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// mpv creates the socket after a while
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		l, err := net.Listen("unix", socket)
+		if err != nil {
+			return
+		}
+		t.Cleanup(func() { l.Close() })
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		fakeMPV(t, conn, map[string]any{"duration": 60.0})
+	}()
+
+	c, err := mpv.Dial(ctx, socket)
+	require.NoError(t, err)
+	defer c.Close()
+
+	var duration float64
+	require.NoError(t, c.Get(ctx, "duration", &duration))
+	assert.Equal(t, 60.0, duration)
+}
@@ -74,6 +74,42 @@ func (n *Navigator) To(to any) {
 	n.show(screen)
 }
 
+// Replace navigates to a new view, discarding the current one from the stack.
+// Going back from the new view will show the view that was below the replaced one.
+func (n *Navigator) Replace(to any) {
+	n.Unwind(1, to)
+}
+
+// Unwind navigates to a new view, discarding the last count views from the stack.
+func (n *Navigator) Unwind(count int, to any) {
+	if n.factory == nil {
+		slog.Error("Navigator Factory is nil")
+		return
+	}
+
+	view := n.factory(to)
+	if view == nil {
+		slog.Error("Navigator Factory returned nil view", "to", fmt.Sprintf("%T", to))
+		return
+	}
+
+	screen, close := view.Create()
+
+	for range count {
+		last, _ := n.stack.Pop()
+		if last != nil && last.close != nil {
+			last.close(true) // the replaced screen will not come back
+		}
+	}
+
+	n.stack.Push(&navigation{
+		view:  view,
+		close: close,
+	})
+
+	n.show(screen)
+}
+
 func (n *Navigator) Reset(to any) {
 	n.stack = nil
 	n.To(to)
@@ -0,0 +1,94 @@
+// Package netbind resolves the local address that the torrent traffic must be bound to,
+// given the name of a network interface or one of its IPs.
+package netbind
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/quintans/faults"
+)
+
+// ErrUnavailable is returned when the interface is missing, down or without an address
+var ErrUnavailable = errors.New("network interface unavailable")
+
+// Resolve returns the address to bind to, or nil if bind is empty.
+// bind can be an interface name, eg: wg0, or an IP assigned to a local interface.
+func Resolve(bind string) (net.IP, error) {
+	if bind == "" {
+		return nil, nil
+	}
+
+	if ip := net.ParseIP(bind); ip != nil {
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return nil, faults.Errorf("listing interface addresses: %w", err)
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.Equal(ip) {
+				return normalize(ip), nil
+			}
+		}
+		return nil, faults.Errorf("address %s is not assigned: %w", bind, ErrUnavailable)
+	}
+
+	iface, err := net.InterfaceByName(bind)
+	if err != nil {
+		return nil, faults.Errorf("interface %s: %w", bind, errors.Join(ErrUnavailable, err))
+	}
+	if iface.Flags&net.FlagUp == 0 {
+		return nil, faults.Errorf("interface %s is down: %w", bind, ErrUnavailable)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, faults.Errorf("listing addresses of %s: %w", bind, err)
+	}
+
+	// IPv4 is preferred, since most peers and trackers are only reachable through it
+	var v6 net.IP
+	for _, a := range addrs {
+		n, ok := a.(*net.IPNet)
+		if !ok || n.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if v4 := n.IP.To4(); v4 != nil {
+			return v4, nil
+		}
+		if v6 == nil {
+			v6 = n.IP
+		}
+	}
+	if v6 != nil {
+		return v6, nil
+	}
+	return nil, faults.Errorf("interface %s has no address: %w", bind, ErrUnavailable)
+}
+
+func normalize(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip
+}
+
+// Network returns the network, tcp4 or tcp6, of the family of the IP
+func Network(ip net.IP) string {
+	if ip.To4() != nil {
+		return "tcp4"
+	}
+	return "tcp6"
+}
+
+// Dialer returns a dialer whose connections leave from the IP
+func Dialer(ip net.IP) *net.Dialer {
+	return &net.Dialer{LocalAddr: &net.TCPAddr{IP: ip}}
+}
+
+// ListenPacket listens for UDP on the IP, ignoring the requested address
+func ListenPacket(ip net.IP) func(network, addr string) (net.PacketConn, error) {
+	return func(network, _ string) (net.PacketConn, error) {
+		var lc net.ListenConfig
+		return lc.ListenPacket(context.Background(), network, net.JoinHostPort(ip.String(), "0"))
+	}
+}
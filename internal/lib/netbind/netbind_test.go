@@ -0,0 +1,56 @@
+package netbind_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/quintans/torflix/internal/lib/netbind"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loopback(t *testing.T) net.Interface {
+	ifaces, err := net.Interfaces()
+	require.NoError(t, err)
+	for _, i := range ifaces {
+		if i.Flags&net.FlagLoopback != 0 && i.Flags&net.FlagUp != 0 {
+			return i
+		}
+	}
+	t.Skip("no loopback interface")
+	return net.Interface{}
+}
+
+func TestResolve(t *testing.T) {
+	ip, err := netbind.Resolve("")
+	require.NoError(t, err)
+	assert.Nil(t, ip)
+
+	lo := loopback(t)
+	ip, err = netbind.Resolve(lo.Name)
+	require.NoError(t, err)
+	assert.True(t, ip.IsLoopback())
+
+	ip, err = netbind.Resolve("127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", ip.String())
+
+	_, err = netbind.Resolve("no-such-interface0")
+	require.ErrorIs(t, err, netbind.ErrUnavailable)
+
+	// TEST-NET-3, never assigned
+	_, err = netbind.Resolve("203.0.113.7")
+	require.ErrorIs(t, err, netbind.ErrUnavailable)
+}
+
+func TestDialer(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	ip := net.ParseIP("127.0.0.1")
+	conn, err := netbind.Dialer(ip).Dial(netbind.Network(ip), l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.True(t, conn.LocalAddr().(*net.TCPAddr).IP.Equal(ip))
+}
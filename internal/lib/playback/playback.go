@@ -0,0 +1,55 @@
+// Package playback estimates when a file being downloaded can be played through without stalling.
+package playback
+
+import (
+	"math"
+	"regexp"
+	"time"
+)
+
+// BufferDuration is the media that must be downloaded ahead before playing, even on fast downloads
+const BufferDuration = 15 * time.Second
+
+var (
+	isEpisode       = regexp.MustCompile(`(?i)(S\d{1,2}E\d{1,3}|\b\d{1,2}x\d{2}\b)`)
+	episodeDuration = 45 * time.Minute
+	movieDuration   = 110 * time.Minute
+)
+
+// Bitrate returns the media bitrate in bytes per second.
+// Without a known duration it is guessed from the name: an episode or a movie.
+func Bitrate(size int64, duration time.Duration, name string) float64 {
+	if duration <= 0 {
+		duration = movieDuration
+		if isEpisode.MatchString(name) {
+			duration = episodeDuration
+		}
+	}
+	return float64(size) / duration.Seconds()
+}
+
+// ETA returns how long until the media can be played through without stalls,
+// given the bytes already available from the start of the file and the download rate, in bytes per second.
+// When nothing is being downloaded, the media is ready once the buffer is filled,
+// otherwise it returns false because it cannot be estimated.
+func ETA(size, buffered int64, bitrate, rate float64) (time.Duration, bool) {
+	if buffered >= size {
+		return 0, true
+	}
+	minBuffer := math.Min(bitrate*BufferDuration.Seconds(), float64(size))
+	missingBuffer := minBuffer - float64(buffered)
+	if rate <= 0 {
+		return 0, missingBuffer <= 0
+	}
+
+	// the buffer must be filled and the download must never be overtaken by the playback,
+	// which for a download slower than the media happens at the end of the file
+	wait := missingBuffer / rate
+	if bitrate > 0 {
+		wait = math.Max(wait, (float64(size-buffered))/rate-float64(size)/bitrate)
+	}
+	if wait <= 0 {
+		return 0, true
+	}
+	return time.Duration(wait * float64(time.Second)), true
+}
@@ -0,0 +1,71 @@
+package playback_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quintans/torflix/internal/lib/playback"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitrate(t *testing.T) {
+	assert.InDelta(t, 1000.0, playback.Bitrate(3_600_000, time.Hour, "whatever"), 0.01)
+	assert.InDelta(t, 1000.0, playback.Bitrate(2_700_000, 0, "Show.S01E02.1080p"), 0.01)
+	assert.InDelta(t, 1000.0, playback.Bitrate(6_600_000, 0, "Movie.2020.1080p"), 0.01)
+}
+
+func TestETA(t *testing.T) {
+	// 1000 s of media at 1000 B/s
+	const size = 1_000_000
+	const bitrate = 1000.0
+
+	// downloading as fast as the media plays only needs the buffer
+	eta, ok := playback.ETA(size, 0, bitrate, bitrate)
+	assert.True(t, ok)
+	assert.Equal(t, playback.BufferDuration, eta)
+
+	eta, ok = playback.ETA(size, 20_000, bitrate, bitrate)
+	assert.True(t, ok)
+	assert.Zero(t, eta)
+
+	// at half the bitrate the download takes 2000 s, so playing can only start after 1000 s
+	eta, ok = playback.ETA(size, 0, bitrate, bitrate/2)
+	assert.True(t, ok)
+	assert.Equal(t, 1000*time.Second, eta)
+
+	_, ok = playback.ETA(size, 0, bitrate, 0)
+	assert.False(t, ok)
+
+	// without download, the buffer is enough
+	eta, ok = playback.ETA(size, 20_000, bitrate, 0)
+	assert.True(t, ok)
+	assert.Zero(t, eta)
+
+	eta, ok = playback.ETA(size, size, bitrate, 0)
+	assert.True(t, ok)
+	assert.Zero(t, eta)
+}
+
+func TestStarvation(t *testing.T) {
+	var s playback.Starvation
+
+	assert.Equal(t, playback.None, s.Observe(10*time.Second, false, false))
+	assert.Equal(t, playback.Pause, s.Observe(time.Second, false, false))
+	assert.True(t, s.Starved())
+	// waits for the whole buffer before resuming
+	assert.Equal(t, playback.None, s.Observe(5*time.Second, false, true))
+	assert.Equal(t, playback.Resume, s.Observe(playback.BufferDuration, false, true))
+	assert.False(t, s.Starved())
+
+	// the end of the file is always played
+	assert.Equal(t, playback.None, s.Observe(0, true, false))
+
+	// resumed by the user while starved
+	assert.Equal(t, playback.Pause, s.Observe(0, false, false))
+	assert.Equal(t, playback.None, s.Observe(0, false, false))
+	assert.False(t, s.Starved())
+
+	// paused by the user
+	assert.Equal(t, playback.None, s.Observe(0, false, true))
+	assert.Equal(t, playback.None, s.Observe(playback.BufferDuration, false, true))
+}
@@ -0,0 +1,48 @@
+package playback
+
+import "time"
+
+type Action int
+
+const (
+	None Action = iota
+	Pause
+	Resume
+)
+
+// StarvedBuffer is the media buffered ahead of the position under which the playback is paused
+const StarvedBuffer = 2 * time.Second
+
+// Starvation pauses the playback when the download falls behind it, and resumes it once BufferDuration is buffered.
+// A playback paused by the user is left alone.
+type Starvation struct {
+	// paused is set while the playback is paused by the starvation
+	paused bool
+}
+
+// Observe returns what to do with the player, given the media buffered ahead of its position,
+// whether the buffer reaches the end of the file and if the player is paused
+func (s *Starvation) Observe(ahead time.Duration, toEnd bool, paused bool) Action {
+	if s.paused {
+		switch {
+		case !paused:
+			// resumed by the user
+			s.paused = false
+		case ahead >= BufferDuration || toEnd:
+			s.paused = false
+			return Resume
+		}
+		return None
+	}
+
+	if !paused && !toEnd && ahead < StarvedBuffer {
+		s.paused = true
+		return Pause
+	}
+	return None
+}
+
+// Starved tells if the playback is paused by the starvation
+func (s *Starvation) Starved() bool {
+	return s.paused
+}
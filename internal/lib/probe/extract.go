@@ -0,0 +1,365 @@
+package probe
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/quintans/faults"
+)
+
+const (
+	idTimestamp     = 0xE7
+	idSimpleBlock   = 0xA3
+	idBlockGroup    = 0xA0
+	idBlock         = 0xA1
+	idBlockDuration = 0x9B
+	idCues          = 0x1C53BB6B
+	idTags          = 0x1254C367
+	idChapters      = 0x1043A770
+	idAttachments   = 0x1941A469
+)
+
+const (
+	// maxCueSize bounds the size of a subtitle block
+	maxCueSize = 64 << 10
+	// defaultCueDuration is used when the block has no duration and no cue follows
+	defaultCueDuration = 5 * time.Second
+)
+
+// Cue is a subtitle event
+type Cue struct {
+	Start time.Duration
+	// End is zero if unknown
+	End  time.Duration
+	Text string
+}
+
+// TextTrack is a text subtitle track, with the cues extracted so far
+type TextTrack struct {
+	Track
+	// header is the codec private data, that holds the header of ASS and SSA
+	header []byte
+	Cues   []Cue
+}
+
+// Ext returns the file extension of the track format
+func (t *TextTrack) Ext() string {
+	switch t.Codec {
+	case "ass":
+		return ".ass"
+	case "ssa":
+		return ".ssa"
+	default:
+		return ".srt"
+	}
+}
+
+// Extractor extracts the text subtitle tracks of an MKV file.
+// The clusters are read in order, as far as the bytes are available, so it can follow a download.
+type Extractor struct {
+	s      *source
+	h      *mkvHeader
+	tracks map[int]*TextTrack
+	// next is the offset of the next element to read, of the segment or of the cluster being read
+	next    int64
+	cluster *cluster
+}
+
+// cluster is the cluster being read
+type cluster struct {
+	// end is -1 if the size of the cluster is unknown
+	end       int64
+	timestamp int64
+}
+
+// NewExtractor reads the headers of an MKV file, that must be available
+func NewExtractor(r io.ReadSeeker, size int64) (*Extractor, error) {
+	s := newSource(r, size)
+	// the whole file will be read
+	s.limit = 0
+	h, err := s.mkvHeaders()
+	if err != nil {
+		return nil, faults.Errorf("reading mkv headers: %w", err)
+	}
+
+	tracks := map[int]*TextTrack{}
+	for _, t := range h.info.Subtitles {
+		switch t.Codec {
+		case "subrip", "ass", "ssa":
+			tracks[t.Number] = &TextTrack{Track: t, header: h.private[t.Number]}
+		}
+	}
+
+	return &Extractor{
+		s:      s,
+		h:      h,
+		tracks: tracks,
+		next:   h.next,
+	}, nil
+}
+
+// Tracks returns the text subtitle tracks, by track number
+func (e *Extractor) Tracks() []*TextTrack {
+	tracks := make([]*TextTrack, 0, len(e.tracks))
+	for _, t := range e.tracks {
+		tracks = append(tracks, t)
+	}
+	slices.SortFunc(tracks, func(a, b *TextTrack) int {
+		return cmp.Compare(a.Number, b.Number)
+	})
+	return tracks
+}
+
+// Done tells if the whole file was read
+func (e *Extractor) Done() bool {
+	return e.next >= e.h.segment.end(e.s.size)
+}
+
+// Extract reads the clusters up to the given offset, where the available bytes end,
+// returning if any cue was found
+func (e *Extractor) Extract(available int64) (bool, error) {
+	if len(e.tracks) == 0 {
+		e.next = e.h.segment.end(e.s.size)
+		return false, nil
+	}
+
+	e.s.available = min(available, e.s.size)
+	found := false
+	end := e.h.segment.end(e.s.size)
+	for e.next < end {
+		// the element header must be available
+		if e.next+12 > e.s.available && e.s.available < e.s.size {
+			return found, nil
+		}
+		el, err := e.s.element(e.next)
+		if err != nil {
+			return found, faults.Errorf("reading element at %d: %w", e.next, err)
+		}
+
+		if e.cluster == nil {
+			switch {
+			case el.id == idCluster:
+				e.cluster = &cluster{end: -1}
+				if el.size >= 0 {
+					e.cluster.end = el.offset + el.size
+				}
+				e.next = el.offset
+			case el.size < 0:
+				return found, faults.Errorf("unknown size of element %X at %d", el.id, e.next)
+			default:
+				e.next = el.offset + el.size
+			}
+			continue
+		}
+
+		// a cluster of unknown size ends where the next top level element starts
+		if (e.cluster.end >= 0 && e.next >= e.cluster.end) || (e.cluster.end < 0 && topLevel(el.id)) {
+			e.cluster = nil
+			continue
+		}
+		if el.size < 0 {
+			return found, faults.Errorf("unknown size of element %X at %d", el.id, e.next)
+		}
+
+		ok, cue, err := e.clusterChild(el)
+		if err != nil {
+			return found, err
+		}
+		if !ok {
+			return found, nil
+		}
+		found = found || cue
+		e.next = el.offset + el.size
+	}
+
+	return found, nil
+}
+
+func topLevel(id uint32) bool {
+	switch id {
+	case idCluster, idCues, idTags, idChapters, idAttachments, idSeekHead, idInfo, idTracks:
+		return true
+	default:
+		return false
+	}
+}
+
+// clusterChild reads an element of the cluster, returning false if it is not available yet
+func (e *Extractor) clusterChild(el element) (bool, bool, error) {
+	switch el.id {
+	case idTimestamp:
+		if el.offset+el.size > e.s.available {
+			return false, false, nil
+		}
+		ts, err := e.s.uint(el)
+		if err != nil {
+			return false, false, faults.Errorf("reading cluster timestamp: %w", err)
+		}
+		e.cluster.timestamp = int64(ts)
+		return true, false, nil
+	case idSimpleBlock:
+		return e.block(el, 0)
+	case idBlockGroup:
+		if el.offset+el.size > e.s.available {
+			// the block group is only read whole if it is of a text track
+			track, ok, err := e.blockGroupTrack(el)
+			if err != nil || !ok || e.tracks[track] != nil {
+				return false, false, err
+			}
+			return true, false, nil
+		}
+		var block *element
+		var duration uint64
+		err := e.s.children(el, func(el element) error {
+			var err error
+			switch el.id {
+			case idBlock:
+				block = &el
+			case idBlockDuration:
+				duration, err = e.s.uint(el)
+			}
+			return err
+		})
+		if err != nil {
+			return false, false, faults.Errorf("reading block group: %w", err)
+		}
+		if block == nil {
+			return true, false, nil
+		}
+		return e.block(*block, duration)
+	default:
+		return true, false, nil
+	}
+}
+
+// blockGroupTrack reads the track of the first block of the group, if available
+func (e *Extractor) blockGroupTrack(group element) (int, bool, error) {
+	if group.offset+20 > e.s.available {
+		return 0, false, nil
+	}
+	el, err := e.s.element(group.offset)
+	if err != nil {
+		return 0, false, faults.Errorf("reading block group: %w", err)
+	}
+	if el.id != idBlock {
+		// the block is not the first child, so the group has to be read whole
+		return 0, false, nil
+	}
+	b, err := e.s.readAt(el.offset, 8)
+	if err != nil {
+		return 0, false, faults.Errorf("reading block header: %w", err)
+	}
+	track, n := vint(b, false)
+	return int(track), n > 0, nil
+}
+
+// block reads a block, keeping the cue if it is of a text track
+func (e *Extractor) block(el element, duration uint64) (bool, bool, error) {
+	if el.offset+min(el.size, 8) > e.s.available {
+		return false, false, nil
+	}
+	b, err := e.s.readAt(el.offset, int(min(el.size, 8)))
+	if err != nil {
+		return false, false, faults.Errorf("reading block header: %w", err)
+	}
+	number, n := vint(b, false)
+	track, ok := e.tracks[int(number)]
+	if !ok {
+		return true, false, nil
+	}
+	if el.offset+el.size > e.s.available {
+		return false, false, nil
+	}
+	if el.size < int64(n+3) || el.size > maxCueSize {
+		return true, false, nil
+	}
+
+	data, err := e.s.readAt(el.offset, int(el.size))
+	if err != nil {
+		return false, false, faults.Errorf("reading block: %w", err)
+	}
+	relative := int16(binary.BigEndian.Uint16(data[n:]))
+	flags := data[n+2]
+	if flags&0x06 != 0 {
+		// laced blocks are not used for subtitles
+		return true, false, nil
+	}
+
+	start := time.Duration(e.cluster.timestamp+int64(relative)) * e.h.scale
+	cue := Cue{
+		Start: start,
+		Text:  string(data[n+3:]),
+	}
+	if duration > 0 {
+		cue.End = start + time.Duration(duration)*e.h.scale
+	}
+	track.Cues = append(track.Cues, cue)
+	return true, true, nil
+}
+
+// Format writes the cues in the format of the track: SRT, or ASS and SSA with the header of the track
+func (t *TextTrack) Format() []byte {
+	cues := slices.Clone(t.Cues)
+	slices.SortStableFunc(cues, func(a, b Cue) int {
+		return cmp.Compare(a.Start, b.Start)
+	})
+	for i := range cues {
+		if cues[i].End > cues[i].Start {
+			continue
+		}
+		cues[i].End = cues[i].Start + defaultCueDuration
+		if i+1 < len(cues) && cues[i+1].Start > cues[i].Start {
+			cues[i].End = min(cues[i].End, cues[i+1].Start)
+		}
+	}
+
+	var sb strings.Builder
+	if t.Codec == "subrip" {
+		for i, c := range cues {
+			fmt.Fprintf(&sb, "%d\n%s --> %s\n%s\n\n", i+1, srtTime(c.Start), srtTime(c.End), strings.TrimSpace(c.Text))
+		}
+		return []byte(sb.String())
+	}
+
+	header := strings.TrimSpace(string(t.header))
+	sb.WriteString(header)
+	sb.WriteString("\n")
+	if !strings.Contains(header, "[Events]") {
+		sb.WriteString("\n[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n")
+	}
+
+	// the blocks hold: ReadOrder, Layer, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+	slices.SortStableFunc(cues, func(a, b Cue) int {
+		return cmp.Compare(readOrder(a.Text), readOrder(b.Text))
+	})
+	for _, c := range cues {
+		fields := strings.SplitN(c.Text, ",", 3)
+		if len(fields) < 3 {
+			continue
+		}
+		fmt.Fprintf(&sb, "Dialogue: %s,%s,%s,%s\n", fields[1], assTime(c.Start), assTime(c.End), fields[2])
+	}
+	return []byte(sb.String())
+}
+
+func readOrder(text string) int {
+	before, _, _ := strings.Cut(text, ",")
+	n, _ := strconv.Atoi(before)
+	return n
+}
+
+func srtTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3_600_000, ms/60_000%60, ms/1000%60, ms%1000)
+}
+
+func assTime(d time.Duration) string {
+	cs := d.Milliseconds() / 10
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360_000, cs/6000%60, cs/100%60, cs%100)
+}
@@ -0,0 +1,77 @@
+package probe_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/quintans/torflix/internal/lib/probe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func block(track byte, relative int16, payload string) []byte {
+	b := []byte{0x80 | track}
+	b = binary.BigEndian.AppendUint16(b, uint16(relative))
+	b = append(b, 0)
+	return append(b, payload...)
+}
+
+func TestExtractor(t *testing.T) {
+	tracks := ebml(0x1654AE6B,
+		ebml(0xAE,
+			ebmlUint(0xD7, 1),
+			ebmlUint(0x83, 1),
+			ebmlString(0x86, "V_MPEG4/ISO/AVC"),
+		),
+		ebml(0xAE,
+			ebmlUint(0xD7, 2),
+			ebmlUint(0x83, 17),
+			ebmlString(0x86, "S_TEXT/UTF8"),
+			ebmlString(0x22B59C, "por"),
+		),
+		ebml(0xAE,
+			ebmlUint(0xD7, 3),
+			ebmlUint(0x83, 17),
+			ebmlString(0x86, "S_TEXT/ASS"),
+			ebmlString(0x63A2, "[Script Info]\nTitle: test\n\n[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n"),
+		),
+	)
+	first := ebml(0x1F43B675,
+		ebmlUint(0xE7, 1000),
+		ebml(0xA3, block(1, 0, "video data")),
+		ebml(0xA0, ebml(0xA1, block(2, 500, "Hello")), ebmlUint(0x9B, 1500)),
+		ebml(0xA0, ebml(0xA1, block(3, 500, "0,0,Default,,0,0,0,,Hi")), ebmlUint(0x9B, 1500)),
+	)
+	second := ebml(0x1F43B675,
+		ebmlUint(0xE7, 61000),
+		ebml(0xA3, block(2, 0, "World")),
+	)
+	segmentHeader := 12
+	head := append(mkvHeader(), ebml(0x18538067, mkvInfo(), tracks, first, second)...)
+	secondAt := len(head) - len(second)
+	require.Equal(t, len(mkvHeader())+segmentHeader+len(mkvInfo())+len(tracks)+len(first), secondAt)
+
+	ex, err := probe.NewExtractor(bytes.NewReader(head), int64(len(head)))
+	require.NoError(t, err)
+	require.Len(t, ex.Tracks(), 2)
+	srt, ass := ex.Tracks()[0], ex.Tracks()[1]
+	assert.Equal(t, ".srt", srt.Ext())
+	assert.Equal(t, ".ass", ass.Ext())
+
+	// only the first cluster is available
+	found, err := ex.Extract(int64(secondAt + 5))
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.False(t, ex.Done())
+	assert.Len(t, srt.Cues, 1)
+
+	found, err = ex.Extract(int64(len(head)))
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.True(t, ex.Done())
+
+	assert.Equal(t, "1\n00:00:01,500 --> 00:00:03,000\nHello\n\n2\n00:01:01,000 --> 00:01:06,000\nWorld\n\n", string(srt.Format()))
+	assert.Equal(t, "[Script Info]\nTitle: test\n\n[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n"+
+		"Dialogue: 0,0:00:01.50,0:00:03.00,Default,,0,0,0,,Hi\n", string(ass.Format()))
+}
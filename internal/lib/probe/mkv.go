@@ -0,0 +1,536 @@
+package probe
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/quintans/faults"
+)
+
+// EBML and Matroska element IDs, see https://www.matroska.org/technical/elements.html
+const (
+	idEBML                    = 0x1A45DFA3
+	idDocType                 = 0x4282
+	idSegment                 = 0x18538067
+	idSeekHead                = 0x114D9B74
+	idSeek                    = 0x4DBB
+	idSeekID                  = 0x53AB
+	idSeekPosition            = 0x53AC
+	idInfo                    = 0x1549A966
+	idTimestampScale          = 0x2AD7B1
+	idDuration                = 0x4489
+	idTracks                  = 0x1654AE6B
+	idTrackEntry              = 0xAE
+	idTrackNumber             = 0xD7
+	idTrackType               = 0x83
+	idCodecID                 = 0x86
+	idCodecPrivate            = 0x63A2
+	idName                    = 0x536E
+	idLanguage                = 0x22B59C
+	idLanguageBCP47           = 0x22B59D
+	idFlagDefault             = 0x88
+	idFlagForced              = 0x55AA
+	idVideo                   = 0xE0
+	idPixelWidth              = 0xB0
+	idPixelHeight             = 0xBA
+	idColour                  = 0x55B0
+	idTransferCharacteristics = 0x55BA
+	idAudio                   = 0xE1
+	idChannels                = 0x9F
+	idBlockAdditionMapping    = 0x41E4
+	idBlockAddIDType          = 0x41E7
+	idCluster                 = 0x1F43B675
+)
+
+// maxPrivateSize bounds the codec private data of the subtitle tracks, that holds the ASS and SSA headers
+const maxPrivateSize = 1 << 20
+
+const (
+	mkvTrackVideo    = 1
+	mkvTrackAudio    = 2
+	mkvTrackSubtitle = 17
+)
+
+// transfer characteristics of the HDR formats, from ITU-T H.273
+const (
+	transferPQ  = 16
+	transferHLG = 18
+)
+
+// Dolby Vision configuration block addition types
+const (
+	blockAddDvcC = 0x64766343
+	blockAddDvvC = 0x64767643
+)
+
+var mkvCodecs = map[string]string{
+	"V_MPEG4/ISO/AVC":  "h264",
+	"V_MPEGH/ISO/HEVC": "hevc",
+	"V_AV1":            "av1",
+	"V_VP9":            "vp9",
+	"V_VP8":            "vp8",
+	"V_MPEG4/ISO/ASP":  "mpeg4",
+	"A_AAC":            "aac",
+	"A_AC3":            "ac3",
+	"A_EAC3":           "eac3",
+	"A_DTS":            "dts",
+	"A_TRUEHD":         "truehd",
+	"A_OPUS":           "opus",
+	"A_FLAC":           "flac",
+	"A_VORBIS":         "vorbis",
+	"A_MPEG/L3":        "mp3",
+	"S_TEXT/UTF8":      "subrip",
+	"S_TEXT/ASS":       "ass",
+	"S_TEXT/SSA":       "ssa",
+	"S_TEXT/WEBVTT":    "webvtt",
+	"S_HDMV/PGS":       "pgs",
+	"S_VOBSUB":         "vobsub",
+}
+
+func mkvCodec(id string) string {
+	if c, ok := mkvCodecs[id]; ok {
+		return c
+	}
+	// eg: A_AAC/MPEG4/LC
+	if before, _, ok := strings.Cut(id, "/"); ok {
+		if c, ok := mkvCodecs[before]; ok {
+			return c
+		}
+	}
+	return strings.ToLower(id)
+}
+
+// element is an EBML element. The size is -1 if unknown, which is allowed for the segment and clusters.
+type element struct {
+	id     uint32
+	offset int64 // of the data
+	size   int64
+}
+
+func (e element) end(limit int64) int64 {
+	if e.size < 0 || e.offset+e.size > limit {
+		return limit
+	}
+	return e.offset + e.size
+}
+
+// element reads the header of the element at the offset
+func (s *source) element(off int64) (element, error) {
+	b, err := s.peek(off, 12)
+	if err != nil {
+		return element{}, err
+	}
+
+	id, n := vint(b, true)
+	if n == 0 || n > 4 {
+		return element{}, faults.Errorf("invalid element ID at %d", off)
+	}
+	size, m := vint(b[n:], false)
+	if m == 0 {
+		return element{}, faults.Errorf("invalid element size at %d", off)
+	}
+	if size == 1<<(7*m)-1 {
+		size = math.MaxUint64
+	}
+
+	el := element{
+		id:     uint32(id),
+		offset: off + int64(n+m),
+		size:   int64(size),
+	}
+	if size == math.MaxUint64 {
+		el.size = -1
+	}
+	return el, nil
+}
+
+// vint decodes a variable length integer, returning its length or 0 if invalid.
+// IDs keep the length marker.
+func vint(b []byte, marker bool) (uint64, int) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0
+	}
+	length := 1
+	for mask := byte(0x80); b[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > len(b) {
+		return 0, 0
+	}
+
+	v := uint64(b[0])
+	if !marker {
+		v &= 0xFF >> length
+	}
+	for _, c := range b[1:length] {
+		v = v<<8 | uint64(c)
+	}
+	return v, length
+}
+
+// children calls fn for every child of the element
+func (s *source) children(parent element, fn func(element) error) error {
+	end := parent.end(s.size)
+	for off := parent.offset; off < end; {
+		el, err := s.element(off)
+		if err != nil {
+			return err
+		}
+		if el.size < 0 {
+			return faults.Errorf("unknown size of element %X at %d", el.id, off)
+		}
+		err = fn(el)
+		if err != nil {
+			return err
+		}
+		off = el.offset + el.size
+	}
+	return nil
+}
+
+func (s *source) uint(el element) (uint64, error) {
+	if el.size > 8 {
+		return 0, faults.Errorf("invalid size %d of unsigned integer %X", el.size, el.id)
+	}
+	b, err := s.readAt(el.offset, int(el.size))
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+func (s *source) float(el element) (float64, error) {
+	b, err := s.readAt(el.offset, int(el.size))
+	if err != nil {
+		return 0, err
+	}
+	switch el.size {
+	case 0:
+		return 0, nil
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	default:
+		return 0, faults.Errorf("invalid size %d of float %X", el.size, el.id)
+	}
+}
+
+func (s *source) string(el element) (string, error) {
+	if el.size > 4096 {
+		return "", faults.Errorf("string %X too long: %d", el.id, el.size)
+	}
+	b, err := s.readAt(el.offset, int(el.size))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\x00"), nil
+}
+
+func probeMKV(s *source) (Info, error) {
+	h, err := s.mkvHeaders()
+	if err != nil {
+		return Info{}, err
+	}
+	return h.info, nil
+}
+
+// mkvHeader is what is read from the headers of an MKV file
+type mkvHeader struct {
+	info Info
+	// scale is the duration of a timestamp unit
+	scale time.Duration
+	// private holds the codec private data of the subtitle tracks, by track number
+	private map[int][]byte
+	segment element
+	// next is the offset of the first element of the segment that was not read, usually the first cluster
+	next int64
+}
+
+func (s *source) mkvHeaders() (*mkvHeader, error) {
+	h := &mkvHeader{
+		info:    Info{Container: "mkv"},
+		scale:   time.Millisecond,
+		private: map[int][]byte{},
+	}
+
+	head, err := s.element(0)
+	if err != nil {
+		return nil, faults.Errorf("reading EBML header: %w", err)
+	}
+	err = s.children(head, func(el element) error {
+		if el.id != idDocType {
+			return nil
+		}
+		docType, err := s.string(el)
+		if err == nil && docType == "webm" {
+			h.info.Container = docType
+		}
+		return err
+	})
+	if err != nil {
+		return nil, faults.Errorf("reading EBML header: %w", err)
+	}
+
+	segment, err := s.element(head.end(s.size))
+	if err != nil {
+		return nil, faults.Errorf("reading segment: %w", err)
+	}
+	if segment.id != idSegment {
+		return nil, faults.Errorf("expected segment, found element %X", segment.id)
+	}
+	h.segment = segment
+
+	var foundInfo, foundTracks bool
+	read := func(el element) error {
+		switch el.id {
+		case idInfo:
+			foundInfo = true
+			return s.mkvInfo(el, h)
+		case idTracks:
+			foundTracks = true
+			return s.mkvTracks(el, h)
+		}
+		return nil
+	}
+
+	// the headers are usually before the first cluster, otherwise the seek head tells where they are
+	var seeks []int64
+	end := segment.end(s.size)
+	h.next = segment.offset
+	for h.next < end && !(foundInfo && foundTracks) {
+		el, err := s.element(h.next)
+		if err != nil {
+			return nil, faults.Errorf("reading segment child: %w", err)
+		}
+		if el.id == idCluster || el.size < 0 {
+			break
+		}
+		if el.id == idSeekHead {
+			seeks, err = s.mkvSeekHead(el, segment.offset)
+			if err != nil {
+				return nil, faults.Errorf("reading seek head: %w", err)
+			}
+		}
+		err = read(el)
+		if err != nil {
+			return nil, err
+		}
+		h.next = el.offset + el.size
+	}
+
+	for _, pos := range seeks {
+		if foundInfo && foundTracks {
+			break
+		}
+		el, err := s.element(pos)
+		if err != nil {
+			return nil, faults.Errorf("reading element at seek position %d: %w", pos, err)
+		}
+		if (el.id == idInfo && foundInfo) || (el.id == idTracks && foundTracks) {
+			continue
+		}
+		err = read(el)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !foundTracks {
+		return nil, faults.New("tracks not found")
+	}
+	return h, nil
+}
+
+// mkvSeekHead returns the absolute positions of the info and tracks elements
+func (s *source) mkvSeekHead(seekHead element, segmentOffset int64) ([]int64, error) {
+	var positions []int64
+	err := s.children(seekHead, func(seek element) error {
+		if seek.id != idSeek {
+			return nil
+		}
+		var id, pos uint64
+		err := s.children(seek, func(el element) error {
+			var err error
+			switch el.id {
+			case idSeekID:
+				id, err = s.uint(el)
+			case idSeekPosition:
+				pos, err = s.uint(el)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if id == idInfo || id == idTracks {
+			positions = append(positions, segmentOffset+int64(pos))
+		}
+		return nil
+	})
+	return positions, err
+}
+
+func (s *source) mkvInfo(el element, h *mkvHeader) error {
+	scale := uint64(1_000_000)
+	var duration float64
+	err := s.children(el, func(el element) error {
+		var err error
+		switch el.id {
+		case idTimestampScale:
+			scale, err = s.uint(el)
+		case idDuration:
+			duration, err = s.float(el)
+		}
+		return err
+	})
+	if err != nil {
+		return faults.Errorf("reading segment info: %w", err)
+	}
+	h.scale = time.Duration(scale)
+	h.info.Duration = time.Duration(duration * float64(scale))
+	return nil
+}
+
+func (s *source) mkvTracks(el element, h *mkvHeader) error {
+	err := s.children(el, func(entry element) error {
+		if entry.id != idTrackEntry {
+			return nil
+		}
+		return s.mkvTrack(entry, h)
+	})
+	if err != nil {
+		return faults.Errorf("reading tracks: %w", err)
+	}
+	return nil
+}
+
+func (s *source) mkvTrack(entry element, h *mkvHeader) error {
+	info := &h.info
+	// the language is english when missing, as defined by the specification
+	track := Track{Language: "eng", Default: true}
+	var trackType uint64
+	var video Video
+	var transfer uint64
+	var dolbyVision bool
+	var bcp47 string
+	var private *element
+
+	err := s.children(entry, func(el element) error {
+		var err error
+		var v uint64
+		switch el.id {
+		case idTrackNumber:
+			v, err = s.uint(el)
+			track.Number = int(v)
+		case idTrackType:
+			trackType, err = s.uint(el)
+		case idCodecID:
+			var id string
+			id, err = s.string(el)
+			track.Codec = mkvCodec(id)
+		case idName:
+			track.Name, err = s.string(el)
+		case idCodecPrivate:
+			private = &el
+		case idLanguage:
+			track.Language, err = s.string(el)
+		case idLanguageBCP47:
+			bcp47, err = s.string(el)
+		case idFlagDefault:
+			v, err = s.uint(el)
+			track.Default = v == 1
+		case idFlagForced:
+			v, err = s.uint(el)
+			track.Forced = v == 1
+		case idVideo:
+			err = s.children(el, func(el element) error {
+				var err error
+				var v uint64
+				switch el.id {
+				case idPixelWidth:
+					v, err = s.uint(el)
+					video.Width = int(v)
+				case idPixelHeight:
+					v, err = s.uint(el)
+					video.Height = int(v)
+				case idColour:
+					err = s.children(el, func(el element) error {
+						var err error
+						if el.id == idTransferCharacteristics {
+							transfer, err = s.uint(el)
+						}
+						return err
+					})
+				}
+				return err
+			})
+		case idAudio:
+			err = s.children(el, func(el element) error {
+				var err error
+				if el.id == idChannels {
+					v, err = s.uint(el)
+					track.Channels = int(v)
+				}
+				return err
+			})
+		case idBlockAdditionMapping:
+			err = s.children(el, func(el element) error {
+				var err error
+				if el.id == idBlockAddIDType {
+					v, err = s.uint(el)
+					dolbyVision = dolbyVision || v == blockAddDvcC || v == blockAddDvvC
+				}
+				return err
+			})
+		}
+		return err
+	})
+	if err != nil {
+		return faults.Errorf("reading track entry: %w", err)
+	}
+	if bcp47 != "" {
+		track.Language = bcp47
+	}
+
+	switch trackType {
+	case mkvTrackVideo:
+		// the first video track is the main one
+		if info.Video == nil {
+			video.Codec = track.Codec
+			video.HDR = hdrFormat(transfer, dolbyVision)
+			info.Video = &video
+		}
+	case mkvTrackAudio:
+		info.Audio = append(info.Audio, track)
+	case mkvTrackSubtitle:
+		info.Subtitles = append(info.Subtitles, track)
+		if private != nil && private.size <= maxPrivateSize {
+			data, err := s.readAt(private.offset, int(private.size))
+			if err != nil {
+				return faults.Errorf("reading codec private data: %w", err)
+			}
+			h.private[track.Number] = data
+		}
+	}
+	return nil
+}
+
+func hdrFormat(transfer uint64, dolbyVision bool) string {
+	switch {
+	case dolbyVision:
+		return "Dolby Vision"
+	case transfer == transferPQ:
+		return "HDR10"
+	case transfer == transferHLG:
+		return "HLG"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,310 @@
+package probe
+
+import (
+	"encoding/binary"
+	"strings"
+	"time"
+
+	"github.com/quintans/faults"
+)
+
+var mp4Codecs = map[string]string{
+	"avc1": "h264",
+	"avc3": "h264",
+	"hvc1": "hevc",
+	"hev1": "hevc",
+	"dvh1": "hevc",
+	"dvhe": "hevc",
+	"av01": "av1",
+	"vp09": "vp9",
+	"mp4v": "mpeg4",
+	"mp4a": "aac",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+	"Opus": "opus",
+	"fLaC": "flac",
+	"tx3g": "mov_text",
+	"wvtt": "webvtt",
+	"stpp": "ttml",
+	"c608": "eia_608",
+}
+
+func mp4Codec(format string) string {
+	if c, ok := mp4Codecs[format]; ok {
+		return c
+	}
+	return strings.TrimSpace(format)
+}
+
+// box is an ISO base media file box
+type box struct {
+	kind   string
+	offset int64 // of the data
+	size   int64
+}
+
+// box reads the header of the box at the offset, limited by the end of its parent
+func (s *source) box(off, limit int64) (box, error) {
+	b, err := s.peek(off, 16)
+	if err != nil {
+		return box{}, err
+	}
+	if len(b) < 8 {
+		return box{}, faults.Errorf("truncated box header at %d", off)
+	}
+
+	size := int64(binary.BigEndian.Uint32(b))
+	header := int64(8)
+	switch size {
+	case 0: // to the end
+		size = limit - off
+	case 1:
+		if len(b) < 16 {
+			return box{}, faults.Errorf("truncated box header at %d", off)
+		}
+		size = int64(binary.BigEndian.Uint64(b[8:]))
+		header = 16
+	}
+	if size < header {
+		return box{}, faults.Errorf("invalid size %d of box at %d", size, off)
+	}
+
+	return box{
+		kind:   string(b[4:8]),
+		offset: off + header,
+		size:   min(size, limit-off) - header,
+	}, nil
+}
+
+// boxes calls fn for every box from the offset until the limit
+func (s *source) boxes(off, limit int64, fn func(box) error) error {
+	for off+8 <= limit {
+		b, err := s.box(off, limit)
+		if err != nil {
+			return err
+		}
+		err = fn(b)
+		if err != nil {
+			return err
+		}
+		off = b.offset + b.size
+	}
+	return nil
+}
+
+func (s *source) boxData(b box, n int) ([]byte, error) {
+	if int64(n) > b.size {
+		return nil, faults.Errorf("box %s too short: %d < %d", b.kind, b.size, n)
+	}
+	return s.readAt(b.offset, n)
+}
+
+func probeMP4(s *source) (Info, error) {
+	info := Info{Container: "mp4"}
+	found := false
+	// the moov box is usually at the start, but can be after the media data
+	err := s.boxes(0, s.size, func(b box) error {
+		if b.kind != "moov" || found {
+			return nil
+		}
+		found = true
+		return s.mp4Movie(b, &info)
+	})
+	if err != nil {
+		return Info{}, err
+	}
+	if !found {
+		return Info{}, faults.New("movie box not found")
+	}
+	return info, nil
+}
+
+func (s *source) mp4Movie(moov box, info *Info) error {
+	return s.boxes(moov.offset, moov.offset+moov.size, func(b box) error {
+		switch b.kind {
+		case "mvhd":
+			d, err := s.mp4Duration(b, 12, 20)
+			if err != nil {
+				return faults.Errorf("reading movie header: %w", err)
+			}
+			info.Duration = d
+		case "trak":
+			err := s.mp4Track(b, info)
+			if err != nil {
+				return faults.Errorf("reading track: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// mp4Duration reads the timescale and the duration of a movie or media header,
+// whose timescale is at the given offset for the versions 0 and 1
+func (s *source) mp4Duration(b box, v0, v1 int) (time.Duration, error) {
+	data, err := s.boxData(b, 1)
+	if err != nil {
+		return 0, err
+	}
+	if data[0] == 1 {
+		data, err = s.boxData(b, v1+12)
+		if err != nil {
+			return 0, err
+		}
+		scale := binary.BigEndian.Uint32(data[v1:])
+		duration := binary.BigEndian.Uint64(data[v1+4:])
+		return scaled(duration, scale), nil
+	}
+
+	data, err = s.boxData(b, v0+8)
+	if err != nil {
+		return 0, err
+	}
+	scale := binary.BigEndian.Uint32(data[v0:])
+	duration := binary.BigEndian.Uint32(data[v0+4:])
+	return scaled(uint64(duration), scale), nil
+}
+
+func scaled(duration uint64, scale uint32) time.Duration {
+	if scale == 0 {
+		return 0
+	}
+	return time.Duration(float64(duration) / float64(scale) * float64(time.Second))
+}
+
+// mp4TrackInfo is what is collected while walking a track box
+type mp4TrackInfo struct {
+	track   Track
+	handler string
+	video   Video
+	hdr     string
+}
+
+func (s *source) mp4Track(trak box, info *Info) error {
+	t := mp4TrackInfo{track: Track{Language: "und"}}
+	err := s.mp4TrackBoxes(trak, &t)
+	if err != nil {
+		return err
+	}
+
+	switch t.handler {
+	case "vide":
+		if info.Video == nil {
+			t.video.Codec = t.track.Codec
+			t.video.HDR = t.hdr
+			info.Video = &t.video
+		}
+	case "soun":
+		info.Audio = append(info.Audio, t.track)
+	case "sbtl", "subt", "text", "clcp":
+		info.Subtitles = append(info.Subtitles, t.track)
+	}
+	return nil
+}
+
+// mp4TrackBoxes walks the boxes of the track, down to the sample description
+func (s *source) mp4TrackBoxes(parent box, t *mp4TrackInfo) error {
+	return s.boxes(parent.offset, parent.offset+parent.size, func(b box) error {
+		switch b.kind {
+		case "mdia", "minf", "stbl":
+			return s.mp4TrackBoxes(b, t)
+		case "tkhd":
+			data, err := s.boxData(b, 24)
+			if err != nil {
+				return err
+			}
+			t.track.Default = data[3]&1 == 1 // enabled
+			if data[0] == 1 {
+				t.track.Number = int(binary.BigEndian.Uint32(data[20:]))
+			} else {
+				t.track.Number = int(binary.BigEndian.Uint32(data[12:]))
+			}
+		case "mdhd":
+			data, err := s.boxData(b, 1)
+			if err != nil {
+				return err
+			}
+			at := 20
+			if data[0] == 1 {
+				at = 32
+			}
+			data, err = s.boxData(b, at+2)
+			if err != nil {
+				return err
+			}
+			// ISO-639-2/T code packed as three 5 bit letters
+			code := binary.BigEndian.Uint16(data[at:])
+			t.track.Language = string([]byte{
+				byte(code>>10&0x1F) + 0x60,
+				byte(code>>5&0x1F) + 0x60,
+				byte(code&0x1F) + 0x60,
+			})
+		case "elng":
+			// extended language tag, that takes precedence
+			data, err := s.boxData(b, int(min(b.size, 64)))
+			if err != nil {
+				return err
+			}
+			if len(data) > 4 {
+				t.track.Language = strings.TrimRight(string(data[4:]), "\x00")
+			}
+		case "hdlr":
+			data, err := s.boxData(b, 12)
+			if err != nil {
+				return err
+			}
+			t.handler = string(data[8:12])
+		case "stsd":
+			return s.mp4SampleDescription(b, t)
+		}
+		return nil
+	})
+}
+
+// mp4SampleDescription reads the first sample entry, that tells the codec and its parameters
+func (s *source) mp4SampleDescription(stsd box, t *mp4TrackInfo) error {
+	entry, err := s.box(stsd.offset+8, stsd.offset+stsd.size)
+	if err != nil {
+		return faults.Errorf("reading sample entry: %w", err)
+	}
+	t.track.Codec = mp4Codec(entry.kind)
+	end := entry.offset + entry.size
+
+	switch t.handler {
+	case "vide":
+		data, err := s.boxData(entry, 78)
+		if err != nil {
+			return err
+		}
+		t.video.Width = int(binary.BigEndian.Uint16(data[24:]))
+		t.video.Height = int(binary.BigEndian.Uint16(data[26:]))
+
+		var transfer uint64
+		dolbyVision := entry.kind == "dvh1" || entry.kind == "dvhe"
+		err = s.boxes(entry.offset+78, end, func(b box) error {
+			switch b.kind {
+			case "colr":
+				data, err := s.boxData(b, 10)
+				if err != nil {
+					return err
+				}
+				if string(data[:4]) == "nclx" {
+					transfer = uint64(binary.BigEndian.Uint16(data[6:]))
+				}
+			case "dvcC", "dvvC":
+				dolbyVision = true
+			}
+			return nil
+		})
+		if err != nil {
+			return faults.Errorf("reading video sample entry: %w", err)
+		}
+		t.hdr = hdrFormat(transfer, dolbyVision)
+	case "soun":
+		data, err := s.boxData(entry, 18)
+		if err != nil {
+			return err
+		}
+		t.track.Channels = int(binary.BigEndian.Uint16(data[16:]))
+	}
+	return nil
+}
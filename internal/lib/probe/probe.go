@@ -0,0 +1,134 @@
+// Package probe reads the headers of MKV and MP4 files to tell what is inside, without a player.
+// Only the headers are read, so it works over a file that is still downloading.
+package probe
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/quintans/faults"
+)
+
+// ErrUnsupported is returned when the file is neither MKV nor MP4
+var ErrUnsupported = errors.New("unsupported container")
+
+// Video describes the video track
+type Video struct {
+	Codec  string
+	Width  int
+	Height int
+	// HDR is the HDR format (HDR10, HLG or Dolby Vision) or empty if SDR
+	HDR string
+}
+
+// Resolution returns the usual name of the resolution, eg: 1080p.
+// The width decides, since movies are often cropped to a wider aspect ratio.
+func (v Video) Resolution() string {
+	switch {
+	case v.Width >= 3800:
+		return "2160p"
+	case v.Width >= 1900:
+		return "1080p"
+	case v.Width >= 1260:
+		return "720p"
+	default:
+		return fmt.Sprintf("%dp", v.Height)
+	}
+}
+
+// Track describes an audio or subtitle track
+type Track struct {
+	// Number identifies the track in the container: the track number in MKV or the track ID in MP4
+	Number   int
+	Codec    string
+	Language string
+	Name     string
+	Default  bool
+	Forced   bool
+	// Channels is the number of audio channels
+	Channels int
+}
+
+// Info is what was found in the headers of a media file
+type Info struct {
+	Container string
+	Duration  time.Duration
+	Video     *Video
+	Audio     []Track
+	Subtitles []Track
+}
+
+// String summarizes the info, eg: 1080p hevc HDR10, 1h52m, audio: eng, por, subs: eng
+func (i Info) String() string {
+	var parts []string
+	if i.Video != nil {
+		v := strings.TrimSpace(fmt.Sprintf("%s %s %s", i.Video.Resolution(), i.Video.Codec, i.Video.HDR))
+		parts = append(parts, v)
+	}
+	if i.Duration > 0 {
+		parts = append(parts, i.Duration.Truncate(time.Minute).String())
+	}
+	if len(i.Audio) > 0 {
+		parts = append(parts, "audio: "+languages(i.Audio))
+	}
+	if len(i.Subtitles) > 0 {
+		parts = append(parts, "subs: "+languages(i.Subtitles))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func languages(tracks []Track) string {
+	var langs []string
+	for _, t := range tracks {
+		lang := t.Language
+		if lang == "" {
+			lang = "und"
+		}
+		if !slices.Contains(langs, lang) {
+			langs = append(langs, lang)
+		}
+	}
+	return strings.Join(langs, " ")
+}
+
+// Supported tells if the container of the file, by its extension, can be probed
+func Supported(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".mkv", ".webm", ".mp4", ".m4v", ".mov":
+		return true
+	default:
+		return false
+	}
+}
+
+// Probe reads the headers of a media file of the given size
+func Probe(r io.ReadSeeker, size int64) (Info, error) {
+	s := newSource(r, size)
+	magic, err := s.readAt(0, 8)
+	if err != nil {
+		return Info{}, faults.Errorf("reading magic number: %w", err)
+	}
+
+	switch {
+	case bytes.Equal(magic[:4], []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		info, err := probeMKV(s)
+		if err != nil {
+			return Info{}, faults.Errorf("probing mkv: %w", err)
+		}
+		return info, nil
+	case string(magic[4:8]) == "ftyp":
+		info, err := probeMP4(s)
+		if err != nil {
+			return Info{}, faults.Errorf("probing mp4: %w", err)
+		}
+		return info, nil
+	default:
+		return Info{}, faults.Wrap(ErrUnsupported)
+	}
+}
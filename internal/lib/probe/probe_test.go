@@ -0,0 +1,182 @@
+package probe_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/quintans/torflix/internal/lib/probe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ebml encodes an element with an 8 byte size
+func ebml(id uint32, data ...[]byte) []byte {
+	var idBytes []byte
+	for v := id; v > 0; v >>= 8 {
+		idBytes = append([]byte{byte(v)}, idBytes...)
+	}
+	body := bytes.Join(data, nil)
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(body)))
+	size[0] = 0x01
+	return bytes.Join([][]byte{idBytes, size, body}, nil)
+}
+
+func ebmlUint(id uint32, v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return ebml(id, b)
+}
+
+func ebmlFloat(id uint32, v float64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, math.Float64bits(v))
+	return ebml(id, b)
+}
+
+func ebmlString(id uint32, s string) []byte {
+	return ebml(id, []byte(s))
+}
+
+func mkvTracks() []byte {
+	return ebml(0x1654AE6B,
+		ebml(0xAE,
+			ebmlUint(0xD7, 1),
+			ebmlUint(0x83, 1),
+			ebmlString(0x86, "V_MPEGH/ISO/HEVC"),
+			ebml(0xE0,
+				ebmlUint(0xB0, 3840),
+				ebmlUint(0xBA, 1606),
+				ebml(0x55B0, ebmlUint(0x55BA, 16)),
+			),
+		),
+		ebml(0xAE,
+			ebmlUint(0xD7, 2),
+			ebmlUint(0x83, 2),
+			ebmlString(0x86, "A_EAC3"),
+			ebml(0xE1, ebmlUint(0x9F, 6)),
+		),
+		ebml(0xAE,
+			ebmlUint(0xD7, 3),
+			ebmlUint(0x83, 2),
+			ebmlString(0x86, "A_AAC/MPEG4/LC"),
+			ebmlString(0x22B59C, "por"),
+			ebmlUint(0x88, 0),
+		),
+		ebml(0xAE,
+			ebmlUint(0xD7, 4),
+			ebmlUint(0x83, 17),
+			ebmlString(0x86, "S_TEXT/UTF8"),
+			ebmlString(0x22B59C, "spa"),
+			ebmlString(0x536E, "Forced"),
+			ebmlUint(0x55AA, 1),
+		),
+	)
+}
+
+func mkvHeader() []byte {
+	return ebml(0x1A45DFA3, ebmlString(0x4282, "matroska"))
+}
+
+func mkvInfo() []byte {
+	return ebml(0x1549A966,
+		ebmlUint(0x2AD7B1, 1_000_000),
+		ebmlFloat(0x4489, float64(90*time.Minute/time.Millisecond)),
+	)
+}
+
+func assertMKV(t *testing.T, info probe.Info) {
+	assert.Equal(t, "mkv", info.Container)
+	assert.Equal(t, 90*time.Minute, info.Duration)
+	require.NotNil(t, info.Video)
+	assert.Equal(t, probe.Video{Codec: "hevc", Width: 3840, Height: 1606, HDR: "HDR10"}, *info.Video)
+	assert.Equal(t, "2160p", info.Video.Resolution())
+	assert.Equal(t, []probe.Track{
+		{Number: 2, Codec: "eac3", Language: "eng", Default: true, Channels: 6},
+		{Number: 3, Codec: "aac", Language: "por"},
+	}, info.Audio)
+	assert.Equal(t, []probe.Track{
+		{Number: 4, Codec: "subrip", Language: "spa", Name: "Forced", Default: true, Forced: true},
+	}, info.Subtitles)
+	assert.Equal(t, "2160p hevc HDR10, 1h30m0s, audio: eng por, subs: spa", info.String())
+}
+
+func TestProbeMKV(t *testing.T) {
+	file := append(mkvHeader(), ebml(0x18538067, mkvInfo(), mkvTracks(), ebml(0x1F43B675, make([]byte, 100)))...)
+
+	info, err := probe.Probe(bytes.NewReader(file), int64(len(file)))
+	require.NoError(t, err)
+	assertMKV(t, info)
+}
+
+func TestProbeMKVSeekHead(t *testing.T) {
+	// the tracks are after the clusters, only found through the seek head
+	cluster := ebml(0x1F43B675, make([]byte, 100))
+	seekHeadSize := len(ebml(0x114D9B74, ebml(0x4DBB, ebmlUint(0x53AB, 0x1654AE6B), ebmlUint(0x53AC, 0))))
+	position := seekHeadSize + len(mkvInfo()) + len(cluster)
+	seekHead := ebml(0x114D9B74, ebml(0x4DBB, ebmlUint(0x53AB, 0x1654AE6B), ebmlUint(0x53AC, uint64(position))))
+
+	file := append(mkvHeader(), ebml(0x18538067, seekHead, mkvInfo(), cluster, mkvTracks())...)
+
+	info, err := probe.Probe(bytes.NewReader(file), int64(len(file)))
+	require.NoError(t, err)
+	assertMKV(t, info)
+}
+
+// mp4Box encodes a box
+func mp4Box(kind string, data ...[]byte) []byte {
+	body := bytes.Join(data, nil)
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(len(body)+8))
+	copy(header[4:], kind)
+	return append(header, body...)
+}
+
+func u16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+func mp4Track(id uint32, handler, lang string, entry []byte) []byte {
+	code := uint16(lang[0]-0x60)<<10 | uint16(lang[1]-0x60)<<5 | uint16(lang[2]-0x60)
+	return mp4Box("trak",
+		mp4Box("tkhd", u32(1), u32(0), u32(0), u32(id), make([]byte, 68)),
+		mp4Box("mdia",
+			mp4Box("mdhd", u32(0), u32(0), u32(0), u32(1000), u32(0), u16(code), u16(0)),
+			mp4Box("hdlr", u32(0), u32(0), []byte(handler), make([]byte, 13)),
+			mp4Box("minf", mp4Box("stbl", mp4Box("stsd", u32(0), u32(1), entry))),
+		),
+	)
+}
+
+func TestProbeMP4(t *testing.T) {
+	video := mp4Box("avc1", make([]byte, 24), u16(1920), u16(1080), make([]byte, 50),
+		mp4Box("colr", []byte("nclx"), u16(1), u16(1), u16(1), []byte{0}))
+	audio := mp4Box("mp4a", make([]byte, 16), u16(2), u16(16), u32(0), u32(48000<<16))
+	subs := mp4Box("tx3g", make([]byte, 8))
+
+	moov := mp4Box("moov",
+		mp4Box("mvhd", u32(0), u32(0), u32(0), u32(1000), u32(uint32(45*time.Minute/time.Millisecond)), make([]byte, 80)),
+		mp4Track(1, "vide", "und", video),
+		mp4Track(2, "soun", "eng", audio),
+		mp4Track(3, "sbtl", "fre", subs),
+	)
+	// the movie box after the media data
+	file := bytes.Join([][]byte{mp4Box("ftyp", []byte("isom"), u32(0)), mp4Box("mdat", make([]byte, 1000)), moov}, nil)
+
+	info, err := probe.Probe(bytes.NewReader(file), int64(len(file)))
+	require.NoError(t, err)
+	assert.Equal(t, "mp4", info.Container)
+	assert.Equal(t, 45*time.Minute, info.Duration)
+	require.NotNil(t, info.Video)
+	assert.Equal(t, probe.Video{Codec: "h264", Width: 1920, Height: 1080}, *info.Video)
+	assert.Equal(t, []probe.Track{{Number: 2, Codec: "aac", Language: "eng", Default: true, Channels: 2}}, info.Audio)
+	assert.Equal(t, []probe.Track{{Number: 3, Codec: "mov_text", Language: "fre", Default: true}}, info.Subtitles)
+}
+
+func TestProbeUnsupported(t *testing.T) {
+	file := []byte("RIFF\x00\x00\x00\x00AVI LIST")
+	_, err := probe.Probe(bytes.NewReader(file), int64(len(file)))
+	assert.ErrorIs(t, err, probe.ErrUnsupported)
+}
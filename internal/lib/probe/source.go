@@ -0,0 +1,72 @@
+package probe
+
+import (
+	"io"
+
+	"github.com/quintans/faults"
+)
+
+const (
+	blockSize = 64 << 10
+	// maxBlocks bounds how much is read, since every block may have to be downloaded
+	maxBlocks = 64
+)
+
+// source reads the file in blocks, keeping the last one, since the parsers do many small reads close to each other
+type source struct {
+	r    io.ReadSeeker
+	size int64
+	// available is where the bytes that can be read end, since the file may be partially downloaded
+	available int64
+	block     []byte
+	start     int64
+	reads     int
+	// limit is the maximum number of blocks read, or 0 if unlimited
+	limit int
+}
+
+func newSource(r io.ReadSeeker, size int64) *source {
+	return &source{
+		r:         r,
+		size:      size,
+		available: size,
+		start:     -1,
+		limit:     maxBlocks,
+	}
+}
+
+// readAt returns n bytes at the offset
+func (s *source) readAt(off int64, n int) ([]byte, error) {
+	if off < 0 || n < 0 || off+int64(n) > s.size {
+		return nil, faults.Errorf("reading %d bytes at %d beyond the size %d: %w", n, off, s.size, io.ErrUnexpectedEOF)
+	}
+	if s.start >= 0 && off >= s.start && off+int64(n) <= s.start+int64(len(s.block)) {
+		return s.block[off-s.start : off-s.start+int64(n)], nil
+	}
+
+	if s.limit > 0 && s.reads >= s.limit {
+		return nil, faults.New("too much data read without finding the headers")
+	}
+	s.reads++
+
+	length := int64(max(n, blockSize))
+	length = min(length, max(s.available, off+int64(n))-off)
+	_, err := s.r.Seek(off, io.SeekStart)
+	if err != nil {
+		return nil, faults.Errorf("seeking to %d: %w", off, err)
+	}
+	block := make([]byte, length)
+	_, err = io.ReadFull(s.r, block)
+	if err != nil {
+		return nil, faults.Errorf("reading %d bytes at %d: %w", length, off, err)
+	}
+	s.block = block
+	s.start = off
+
+	return s.block[:n], nil
+}
+
+// peek returns up to n bytes at the offset, fewer if the file ends before
+func (s *source) peek(off int64, n int) ([]byte, error) {
+	return s.readAt(off, int(min(int64(n), s.size-off)))
+}
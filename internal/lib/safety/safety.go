@@ -0,0 +1,210 @@
+package safety
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/quintans/faults"
+)
+
+type Level int
+
+const (
+	LevelNone Level = iota
+	LevelWarn
+	LevelBlock
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelWarn:
+		return "warn"
+	case LevelBlock:
+		return "block"
+	default:
+		return "off"
+	}
+}
+
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Level) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "", "off", "none":
+		*l = LevelNone
+	case "warn":
+		*l = LevelWarn
+	case "block":
+		*l = LevelBlock
+	default:
+		return faults.Errorf("unknown safety level '%s'", string(text))
+	}
+	return nil
+}
+
+// Rules configures the level raised by each check. A rule with LevelNone is disabled.
+type Rules struct {
+	Executable           Level            `json:"executable"`
+	ExecutableExtensions []string         `json:"executableExtensions"`
+	DoubleExtension      Level            `json:"doubleExtension"`
+	ArchiveOnly          Level            `json:"archiveOnly"`
+	ArchiveExtensions    []string         `json:"archiveExtensions"`
+	SmallMedia           Level            `json:"smallMedia"`
+	MinMediaSize         map[string]int64 `json:"minMediaSize"` // minimum size, in bytes, by quality
+	FakeSeeds            Level            `json:"fakeSeeds"`
+	MinClaimedSeeds      int              `json:"minClaimedSeeds"` // least seeders claimed by the provider to be checked
+	MinSeedsShare        float64          `json:"minSeedsShare"`   // least share of the claimed seeders known by the trackers
+	MediaExtensions      []string         `json:"-"`
+}
+
+func DefaultRules() Rules {
+	return Rules{
+		Executable:           LevelBlock,
+		ExecutableExtensions: []string{".exe", ".scr", ".lnk", ".bat", ".cmd", ".com", ".msi", ".pif", ".vbs", ".js", ".jar", ".ps1", ".apk"},
+		DoubleExtension:      LevelBlock,
+		ArchiveOnly:          LevelWarn,
+		ArchiveExtensions:    []string{".rar", ".zip", ".7z", ".tar", ".gz", ".iso"},
+		SmallMedia:           LevelWarn,
+		MinMediaSize: map[string]int64{
+			"720p":  100_000_000,
+			"1080p": 200_000_000,
+			"1440p": 400_000_000,
+			"2160p": 700_000_000,
+		},
+		FakeSeeds:       LevelWarn,
+		MinClaimedSeeds: 10,
+		MinSeedsShare:   0.2,
+	}
+}
+
+// FakeSeeded reports whether the trackers know of too few of the seeders claimed by the provider.
+// Any level other than LevelNone flags the result, since it is already listed when scraped.
+func (r Rules) FakeSeeded(claimed, actual int) bool {
+	if r.FakeSeeds == LevelNone || claimed < r.MinClaimedSeeds {
+		return false
+	}
+	return float64(actual) < float64(claimed)*r.MinSeedsShare
+}
+
+// benignExtensions are the extensions that can follow a media extension without raising suspicion
+var benignExtensions = []string{".srt", ".sub", ".idx", ".ass", ".ssa", ".vtt", ".nfo", ".txt", ".jpg", ".jpeg", ".png", ".part", ".!qb"}
+
+type File struct {
+	Path string
+	Size int64
+}
+
+type Finding struct {
+	Level   Level
+	Rule    string
+	Message string
+}
+
+type Report struct {
+	Level    Level
+	Findings []Finding
+}
+
+func (r *Report) add(level Level, rule, msg string, args ...any) {
+	if level == LevelNone {
+		return
+	}
+	r.Findings = append(r.Findings, Finding{
+		Level:   level,
+		Rule:    rule,
+		Message: fmt.Sprintf(msg, args...),
+	})
+	r.Level = max(r.Level, level)
+}
+
+// Messages returns the messages of every finding, most severe first
+func (r Report) Messages() []string {
+	findings := slices.Clone(r.Findings)
+	slices.SortStableFunc(findings, func(a, b Finding) int {
+		return cmp.Compare(b.Level, a.Level)
+	})
+	msgs := make([]string, 0, len(findings))
+	for _, f := range findings {
+		msgs = append(msgs, f.Message)
+	}
+	return msgs
+}
+
+// Scan checks the files of a torrent against the rules.
+// quality is the quality claimed by the release (eg: 1080p) and can be empty.
+func Scan(rules Rules, quality string, files []File) Report {
+	var report Report
+	var largestMedia *File
+	archives := 0
+	for k, f := range files {
+		ext := strings.ToLower(filepath.Ext(f.Path))
+		switch {
+		case slices.Contains(rules.ExecutableExtensions, ext):
+			report.add(rules.Executable, "executable", "Executable file: %s", f.Path)
+		case slices.Contains(rules.ArchiveExtensions, ext):
+			archives++
+		case slices.Contains(rules.MediaExtensions, ext):
+			if largestMedia == nil || largestMedia.Size < f.Size {
+				largestMedia = &files[k]
+			}
+		}
+
+		if hasDoubleExtension(rules, f.Path) {
+			report.add(rules.DoubleExtension, "double-extension", "Double extension: %s", f.Path)
+		}
+	}
+
+	if largestMedia == nil && archives > 0 {
+		report.add(rules.ArchiveOnly, "archive-only", "Only archives (%d) and no media files", archives)
+	}
+
+	if largestMedia != nil {
+		checkSize(&report, rules, quality, largestMedia.Size)
+	}
+
+	return report
+}
+
+// ScanName checks what can be checked knowing only the name and total size of a torrent, as found in search results.
+func ScanName(rules Rules, quality string, name string, size int64) Report {
+	var report Report
+	ext := strings.ToLower(filepath.Ext(name))
+	if slices.Contains(rules.ExecutableExtensions, ext) {
+		report.add(rules.Executable, "executable", "Executable file: %s", name)
+	}
+	if hasDoubleExtension(rules, name) {
+		report.add(rules.DoubleExtension, "double-extension", "Double extension: %s", name)
+	}
+	if size > 0 {
+		checkSize(&report, rules, quality, size)
+	}
+
+	return report
+}
+
+func checkSize(report *Report, rules Rules, quality string, size int64) {
+	minSize, ok := rules.MinMediaSize[strings.ToLower(quality)]
+	if ok && size < minSize {
+		report.add(rules.SmallMedia, "small-media", "Media too small for %s (%d MB)", quality, size/1_000_000)
+	}
+}
+
+// hasDoubleExtension detects names like "movie.mkv.exe" where a media extension is used to disguise the real one
+func hasDoubleExtension(rules Rules, name string) bool {
+	base := strings.ToLower(filepath.Base(name))
+	outer := filepath.Ext(base)
+	if outer == "" {
+		return false
+	}
+	inner := filepath.Ext(strings.TrimSuffix(base, outer))
+	if inner == "" || !slices.Contains(rules.MediaExtensions, inner) {
+		return false
+	}
+
+	return !slices.Contains(rules.MediaExtensions, outer) && !slices.Contains(benignExtensions, outer)
+}
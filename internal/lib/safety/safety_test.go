@@ -0,0 +1,123 @@
+package safety_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/quintans/torflix/internal/lib/safety"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rules() safety.Rules {
+	r := safety.DefaultRules()
+	r.MediaExtensions = []string{".mp4", ".mkv", ".avi"}
+	return r
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		quality string
+		files   []safety.File
+		level   safety.Level
+		rules   []string
+	}{
+		{
+			name:    "clean",
+			quality: "1080p",
+			files: []safety.File{
+				{Path: "Movie/Movie.1080p.mkv", Size: 2_000_000_000},
+				{Path: "Movie/Movie.1080p.en.srt", Size: 50_000},
+				{Path: "Movie/Sample/sample.mkv", Size: 20_000_000},
+			},
+			level: safety.LevelNone,
+		},
+		{
+			name: "executable",
+			files: []safety.File{
+				{Path: "Movie/Movie.mkv", Size: 2_000_000_000},
+				{Path: "Movie/Codec Installer.exe", Size: 200_000},
+			},
+			level: safety.LevelBlock,
+			rules: []string{"executable"},
+		},
+		{
+			name: "double extension",
+			files: []safety.File{
+				{Path: "Movie.1080p.mkv.lnk", Size: 2_000},
+			},
+			level: safety.LevelBlock,
+			rules: []string{"executable", "double-extension"},
+		},
+		{
+			name:    "small media",
+			quality: "2160p",
+			files: []safety.File{
+				{Path: "Movie.2160p.mp4", Size: 50_000_000},
+			},
+			level: safety.LevelWarn,
+			rules: []string{"small-media"},
+		},
+		{
+			name: "archive only",
+			files: []safety.File{
+				{Path: "Movie/Movie.part1.rar", Size: 1_000_000_000},
+				{Path: "Movie/Movie.part2.rar", Size: 1_000_000_000},
+				{Path: "Movie/password.txt", Size: 100},
+			},
+			level: safety.LevelWarn,
+			rules: []string{"archive-only"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := safety.Scan(rules(), tt.quality, tt.files)
+			assert.Equal(t, tt.level, report.Level)
+			var got []string
+			for _, f := range report.Findings {
+				got = append(got, f.Rule)
+			}
+			assert.Equal(t, tt.rules, got)
+		})
+	}
+}
+
+func TestScanName(t *testing.T) {
+	report := safety.ScanName(rules(), "1080p", "Movie 2024 1080p WEB", 50_000_000)
+	assert.Equal(t, safety.LevelWarn, report.Level)
+
+	report = safety.ScanName(rules(), "1080p", "Movie 2024 1080p WEB", 2_000_000_000)
+	assert.Equal(t, safety.LevelNone, report.Level)
+}
+
+func TestRulesJSON(t *testing.T) {
+	r := rules()
+	r.SmallMedia = safety.LevelNone
+
+	b, err := json.Marshal(r)
+	require.NoError(t, err)
+
+	var got safety.Rules
+	require.NoError(t, json.Unmarshal(b, &got))
+	assert.Equal(t, safety.LevelNone, got.SmallMedia)
+	assert.Equal(t, safety.LevelBlock, got.Executable)
+
+	err = json.Unmarshal([]byte(`{"executable":"maybe"}`), &got)
+	assert.Error(t, err)
+}
+
+func TestFakeSeeded(t *testing.T) {
+	r := rules()
+	assert.True(t, r.FakeSeeded(900, 10))
+	assert.False(t, r.FakeSeeded(900, 200))
+	// too few claimed seeders to tell
+	assert.False(t, r.FakeSeeded(9, 0))
+
+	r.MinSeedsShare = 0.5
+	assert.True(t, r.FakeSeeded(900, 200))
+
+	r.FakeSeeds = safety.LevelNone
+	assert.False(t, r.FakeSeeded(900, 10))
+}
@@ -0,0 +1,330 @@
+// Package scrape implements the tracker scrape convention for HTTP trackers (BEP 48)
+// and the scrape action of the UDP tracker protocol (BEP 15).
+package scrape
+
+import (
+	"context"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/quintans/faults"
+)
+
+const (
+	udpProtocolID = 0x41727101980
+
+	actionConnect = 0
+	actionScrape  = 2
+	actionError   = 3
+)
+
+type InfoHash [20]byte
+
+// ParseInfoHash parses an hex or base32 encoded info hash, as found in magnet links
+func ParseInfoHash(hash string) (InfoHash, error) {
+	var ih InfoHash
+	var b []byte
+	var err error
+	if len(hash) == 32 {
+		b, err = base32.StdEncoding.DecodeString(strings.ToUpper(hash))
+	} else {
+		b, err = hex.DecodeString(hash)
+	}
+	if err != nil {
+		return ih, faults.Errorf("decoding info hash '%s': %w", hash, err)
+	}
+	if len(b) != len(ih) {
+		return ih, faults.Errorf("invalid info hash length for '%s'", hash)
+	}
+	copy(ih[:], b)
+	return ih, nil
+}
+
+// ErrUnknownTorrent is returned when the trackers that answered do not know the torrent, reporting an empty swarm
+var ErrUnknownTorrent = errors.New("torrent unknown to the trackers")
+
+type Result struct {
+	Tracker   string
+	Seeders   int
+	Leechers  int
+	Completed int
+}
+
+type Scraper struct {
+	Timeout    time.Duration
+	HTTPClient *http.Client
+	// DialUDP is used to open the UDP connection to the tracker. If nil, net.Dialer is used.
+	DialUDP func(ctx context.Context, addr string) (net.Conn, error)
+}
+
+func New() *Scraper {
+	return &Scraper{
+		Timeout:    10 * time.Second,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// ScrapeAll scrapes all trackers concurrently and returns the result with most seeders.
+// It fails if every tracker failed, and with ErrUnknownTorrent if none of them knows the torrent.
+func (s *Scraper) ScrapeAll(ctx context.Context, trackers []string, hash InfoHash) (Result, error) {
+	if len(trackers) == 0 {
+		return Result{}, faults.New("no trackers to scrape")
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		best    *Result
+		errs    []string
+		unknown int
+	)
+	for _, tr := range trackers {
+		wg.Add(1)
+		go func(tr string) {
+			defer wg.Done()
+			res, err := s.Scrape(ctx, tr, hash)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err.Error())
+				return
+			}
+			if res.Seeders == 0 && res.Leechers == 0 && res.Completed == 0 {
+				unknown++
+				return
+			}
+			if best == nil || res.Seeders > best.Seeders {
+				best = &res
+			}
+		}(tr)
+	}
+	wg.Wait()
+
+	if best == nil && unknown > 0 {
+		return Result{}, faults.Errorf("scraping %d trackers: %w", len(trackers), ErrUnknownTorrent)
+	}
+	if best == nil {
+		return Result{}, faults.Errorf("scraping %d trackers: %s", len(trackers), strings.Join(errs, "; "))
+	}
+
+	return *best, nil
+}
+
+// Scrape asks the tracker for the swarm statistics of the info hash
+func (s *Scraper) Scrape(ctx context.Context, tracker string, hash InfoHash) (Result, error) {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	u, err := url.Parse(tracker)
+	if err != nil {
+		return Result{}, faults.Errorf("parsing tracker url '%s': %w", tracker, err)
+	}
+
+	var res Result
+	switch u.Scheme {
+	case "http", "https":
+		res, err = s.scrapeHTTP(ctx, u, hash)
+	case "udp":
+		res, err = s.scrapeUDP(ctx, u.Host, hash)
+	default:
+		return Result{}, faults.Errorf("unsupported tracker scheme '%s'", u.Scheme)
+	}
+	if err != nil {
+		return Result{}, faults.Errorf("scraping '%s': %w", tracker, err)
+	}
+	res.Tracker = tracker
+
+	return res, nil
+}
+
+// ScrapeURL converts an announce url to a scrape url, as described in BEP 48
+func ScrapeURL(announce *url.URL) (*url.URL, error) {
+	idx := strings.LastIndex(announce.Path, "/")
+	last := announce.Path[idx+1:]
+	if !strings.HasPrefix(last, "announce") {
+		return nil, faults.Errorf("tracker '%s' does not support scrape", announce)
+	}
+	u := *announce
+	u.Path = announce.Path[:idx+1] + "scrape" + strings.TrimPrefix(last, "announce")
+	return &u, nil
+}
+
+type httpScrapeResponse struct {
+	FailureReason string `bencode:"failure reason"`
+	Files         map[string]struct {
+		Complete   int `bencode:"complete"`
+		Downloaded int `bencode:"downloaded"`
+		Incomplete int `bencode:"incomplete"`
+	} `bencode:"files"`
+}
+
+func (s *Scraper) scrapeHTTP(ctx context.Context, announce *url.URL, hash InfoHash) (Result, error) {
+	u, err := ScrapeURL(announce)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// info_hash is binary, so it cannot go through url.Values that would encode spaces as '+'
+	q := "info_hash=" + escapeBinary(hash[:])
+	if u.RawQuery != "" {
+		q = u.RawQuery + "&" + q
+	}
+	u.RawQuery = q
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Result{}, faults.Errorf("creating request: %w", err)
+	}
+	resp, err := s.httpClient().Do(req)
+	if err != nil {
+		return Result{}, faults.Errorf("requesting: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, faults.Errorf("response status code %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return Result{}, faults.Errorf("reading response: %w", err)
+	}
+
+	var sr httpScrapeResponse
+	err = bencode.Unmarshal(body, &sr)
+	if err != nil {
+		return Result{}, faults.Errorf("decoding response: %w", err)
+	}
+	if sr.FailureReason != "" {
+		return Result{}, faults.Errorf("tracker failure: %s", sr.FailureReason)
+	}
+
+	f, ok := sr.Files[string(hash[:])]
+	if !ok {
+		// unknown torrents have no swarm
+		return Result{}, nil
+	}
+
+	return Result{
+		Seeders:   f.Complete,
+		Leechers:  f.Incomplete,
+		Completed: f.Downloaded,
+	}, nil
+}
+
+func (s *Scraper) httpClient() *http.Client {
+	if s.HTTPClient != nil {
+		return s.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func escapeBinary(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			sb.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", c)
+	}
+	return sb.String()
+}
+
+func (s *Scraper) scrapeUDP(ctx context.Context, addr string, hash InfoHash) (Result, error) {
+	dial := s.DialUDP
+	if dial == nil {
+		dial = func(ctx context.Context, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", addr)
+		}
+	}
+
+	conn, err := dial(ctx, addr)
+	if err != nil {
+		return Result{}, faults.Errorf("dialing: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// connect
+	tid := rand.Uint32()
+	req := make([]byte, 16)
+	binary.BigEndian.PutUint64(req[0:], udpProtocolID)
+	binary.BigEndian.PutUint32(req[8:], actionConnect)
+	binary.BigEndian.PutUint32(req[12:], tid)
+	resp, err := udpRoundTrip(conn, req, actionConnect, tid, 16)
+	if err != nil {
+		return Result{}, faults.Errorf("connecting: %w", err)
+	}
+	connID := binary.BigEndian.Uint64(resp[8:])
+
+	// scrape
+	tid = rand.Uint32()
+	req = make([]byte, 16+len(hash))
+	binary.BigEndian.PutUint64(req[0:], connID)
+	binary.BigEndian.PutUint32(req[8:], actionScrape)
+	binary.BigEndian.PutUint32(req[12:], tid)
+	copy(req[16:], hash[:])
+	resp, err = udpRoundTrip(conn, req, actionScrape, tid, 20)
+	if err != nil {
+		return Result{}, faults.Errorf("scraping: %w", err)
+	}
+
+	return Result{
+		Seeders:   int(binary.BigEndian.Uint32(resp[8:])),
+		Completed: int(binary.BigEndian.Uint32(resp[12:])),
+		Leechers:  int(binary.BigEndian.Uint32(resp[16:])),
+	}, nil
+}
+
+func udpRoundTrip(conn net.Conn, req []byte, action, tid uint32, minLen int) ([]byte, error) {
+	_, err := conn.Write(req)
+	if err != nil {
+		return nil, faults.Errorf("writing request: %w", err)
+	}
+
+	buf := make([]byte, 2048)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, faults.Errorf("reading response: %w", err)
+		}
+		resp := buf[:n]
+		if n < 8 || binary.BigEndian.Uint32(resp[4:]) != tid {
+			// not for us
+			continue
+		}
+
+		switch binary.BigEndian.Uint32(resp) {
+		case action:
+			if n < minLen {
+				return nil, faults.Errorf("short response with %d bytes", n)
+			}
+			return resp, nil
+		case actionError:
+			return nil, faults.Errorf("tracker error: %s", string(resp[8:]))
+		default:
+			return nil, faults.Errorf("unexpected action %d", binary.BigEndian.Uint32(resp))
+		}
+	}
+}
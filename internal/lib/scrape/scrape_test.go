@@ -0,0 +1,174 @@
+package scrape_test
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/quintans/torflix/internal/lib/scrape"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const hexHash = "991B63685C6BB91E2A199D8495ECE6AA605A1620"
+
+func TestScrapeURL(t *testing.T) {
+	tests := []struct {
+		announce string
+		scrape   string
+		fail     bool
+	}{
+		{announce: "http://example.com/announce", scrape: "http://example.com/scrape"},
+		{announce: "http://example.com/x/announce", scrape: "http://example.com/x/scrape"},
+		{announce: "http://example.com/announce.php", scrape: "http://example.com/scrape.php"},
+		{announce: "http://example.com/announce?x2%0644", scrape: "http://example.com/scrape?x2%0644"},
+		{announce: "http://example.com/a", fail: true},
+		{announce: "http://example.com/announce?x=2/4", scrape: "http://example.com/scrape?x=2/4"},
+		{announce: "http://example.com/x%064announce", fail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.announce, func(t *testing.T) {
+			u, err := url.Parse(tt.announce)
+			require.NoError(t, err)
+			s, err := scrape.ScrapeURL(u)
+			if tt.fail {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.scrape, s.String())
+		})
+	}
+}
+
+func TestScrapeHTTP(t *testing.T) {
+	hash, err := scrape.ParseInfoHash(hexHash)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/scrape" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		ih := r.URL.Query().Get("info_hash")
+		files := map[string]any{}
+		if ih == string(hash[:]) {
+			files[ih] = map[string]int{"complete": 12, "downloaded": 100, "incomplete": 3}
+		}
+		b, err := bencode.Marshal(map[string]any{"files": files})
+		require.NoError(t, err)
+		w.Write(b)
+	}))
+	defer server.Close()
+
+	res, err := scrape.New().Scrape(context.Background(), server.URL+"/announce", hash)
+	require.NoError(t, err)
+	assert.Equal(t, scrape.Result{Tracker: server.URL + "/announce", Seeders: 12, Leechers: 3, Completed: 100}, res)
+
+	var other scrape.InfoHash
+	res, err = scrape.New().Scrape(context.Background(), server.URL+"/announce", other)
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Seeders)
+}
+
+func TestScrapeUDP(t *testing.T) {
+	hash, err := scrape.ParseInfoHash(hexHash)
+	require.NoError(t, err)
+
+	tracker := newFakeUDPTracker(t, map[scrape.InfoHash][3]uint32{
+		hash: {7, 40, 2},
+	})
+	defer tracker.Close()
+
+	res, err := scrape.New().Scrape(context.Background(), "udp://"+tracker.LocalAddr().String()+"/announce", hash)
+	require.NoError(t, err)
+	assert.Equal(t, 7, res.Seeders)
+	assert.Equal(t, 40, res.Completed)
+	assert.Equal(t, 2, res.Leechers)
+}
+
+func TestScrapeAll(t *testing.T) {
+	hash, err := scrape.ParseInfoHash(hexHash)
+	require.NoError(t, err)
+
+	low := newFakeUDPTracker(t, map[scrape.InfoHash][3]uint32{hash: {1, 0, 0}})
+	defer low.Close()
+	high := newFakeUDPTracker(t, map[scrape.InfoHash][3]uint32{hash: {9, 0, 0}})
+	defer high.Close()
+
+	res, err := scrape.New().ScrapeAll(context.Background(), []string{
+		"udp://" + low.LocalAddr().String(),
+		"udp://" + high.LocalAddr().String(),
+		"wss://unsupported.example.com",
+	}, hash)
+	require.NoError(t, err)
+	assert.Equal(t, 9, res.Seeders)
+
+	_, err = scrape.New().ScrapeAll(context.Background(), []string{"wss://unsupported.example.com"}, hash)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, scrape.ErrUnknownTorrent)
+
+	// an empty swarm is not the same as no seeders
+	empty := newFakeUDPTracker(t, map[scrape.InfoHash][3]uint32{})
+	defer empty.Close()
+	_, err = scrape.New().ScrapeAll(context.Background(), []string{
+		"udp://" + empty.LocalAddr().String(),
+		"wss://unsupported.example.com",
+	}, hash)
+	require.ErrorIs(t, err, scrape.ErrUnknownTorrent)
+}
+
+// newFakeUDPTracker serves the connect and scrape actions of BEP 15.
+// swarms maps an info hash to seeders, completed and leechers.
+func newFakeUDPTracker(t *testing.T, swarms map[scrape.InfoHash][3]uint32) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	const connID = 0xCAFE
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := buf[:n]
+			if n < 16 {
+				continue
+			}
+			action := binary.BigEndian.Uint32(req[8:])
+			tid := binary.BigEndian.Uint32(req[12:])
+
+			var resp []byte
+			switch action {
+			case 0:
+				resp = binary.BigEndian.AppendUint32(resp, 0)
+				resp = binary.BigEndian.AppendUint32(resp, tid)
+				resp = binary.BigEndian.AppendUint64(resp, connID)
+			case 2:
+				if binary.BigEndian.Uint64(req) != connID {
+					resp = binary.BigEndian.AppendUint32(resp, 3)
+					resp = binary.BigEndian.AppendUint32(resp, tid)
+					resp = append(resp, "bad connection id"...)
+					break
+				}
+				resp = binary.BigEndian.AppendUint32(resp, 2)
+				resp = binary.BigEndian.AppendUint32(resp, tid)
+				for h := req[16:]; len(h) >= 20; h = h[20:] {
+					s := swarms[scrape.InfoHash(h[:20])]
+					for _, v := range s {
+						resp = binary.BigEndian.AppendUint32(resp, v)
+					}
+				}
+			}
+			conn.WriteTo(resp, addr)
+		}
+	}()
+
+	return conn
+}
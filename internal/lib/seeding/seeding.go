@@ -0,0 +1,60 @@
+// Package seeding decides when a torrent has seeded enough, given its lifetime transfer totals.
+package seeding
+
+import (
+	"fmt"
+	"time"
+)
+
+// Policy holds the seeding goals. Reaching any of them stops the seeding.
+// Zero values mean that there is no such goal.
+type Policy struct {
+	// Ratio is the uploaded bytes over the downloaded bytes
+	Ratio float64 `json:"ratio"`
+	// SeedingMinutes is the maximum time seeding
+	SeedingMinutes int `json:"seedingMinutes"`
+	// IdleMinutes is the maximum time seeding without uploading anything
+	IdleMinutes int `json:"idleMinutes"`
+}
+
+// Totals are the lifetime transfer totals of a torrent
+type Totals struct {
+	Uploaded   int64 `json:"uploaded"`
+	Downloaded int64 `json:"downloaded"`
+	// Seeding is the time spent seeding, after the download completed
+	Seeding time.Duration `json:"seeding"`
+	// Idle is the time seeding since the last upload
+	Idle time.Duration `json:"idle"`
+}
+
+func (t Totals) Ratio() float64 {
+	if t.Downloaded == 0 {
+		return 0
+	}
+	return float64(t.Uploaded) / float64(t.Downloaded)
+}
+
+// Done tells if any goal of the policy was reached, and which one
+func (p Policy) Done(t Totals) (bool, string) {
+	if p.Ratio > 0 && t.Ratio() >= p.Ratio {
+		return true, fmt.Sprintf("ratio %.2f reached", p.Ratio)
+	}
+	if p.SeedingMinutes > 0 && t.Seeding >= time.Duration(p.SeedingMinutes)*time.Minute {
+		return true, fmt.Sprintf("seeding time of %d minutes reached", p.SeedingMinutes)
+	}
+	if p.IdleMinutes > 0 && t.Idle >= time.Duration(p.IdleMinutes)*time.Minute {
+		return true, fmt.Sprintf("idle for %d minutes", p.IdleMinutes)
+	}
+	return false, ""
+}
+
+// Seed accumulates the time seeding during elapsed. The idle time restarts if something was uploaded.
+func (t Totals) Seed(elapsed time.Duration, uploaded bool) Totals {
+	t.Seeding += elapsed
+	if uploaded {
+		t.Idle = 0
+	} else {
+		t.Idle += elapsed
+	}
+	return t
+}
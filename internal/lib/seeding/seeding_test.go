@@ -0,0 +1,42 @@
+package seeding_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quintans/torflix/internal/lib/seeding"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDone(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy seeding.Policy
+		totals seeding.Totals
+		done   bool
+	}{
+		{name: "no goals", totals: seeding.Totals{Uploaded: 100, Downloaded: 1, Seeding: time.Hour}},
+		{name: "ratio reached", policy: seeding.Policy{Ratio: 2}, totals: seeding.Totals{Uploaded: 200, Downloaded: 100}, done: true},
+		{name: "ratio not reached", policy: seeding.Policy{Ratio: 2}, totals: seeding.Totals{Uploaded: 199, Downloaded: 100}},
+		{name: "nothing downloaded", policy: seeding.Policy{Ratio: 2}, totals: seeding.Totals{Uploaded: 199}},
+		{name: "time reached", policy: seeding.Policy{SeedingMinutes: 60}, totals: seeding.Totals{Seeding: time.Hour}, done: true},
+		{name: "idle reached", policy: seeding.Policy{IdleMinutes: 10, Ratio: 5}, totals: seeding.Totals{Idle: 10 * time.Minute}, done: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done, reason := tt.policy.Done(tt.totals)
+			assert.Equal(t, tt.done, done)
+			assert.Equal(t, tt.done, reason != "")
+		})
+	}
+}
+
+func TestSeed(t *testing.T) {
+	totals := seeding.Totals{Uploaded: 10, Downloaded: 100}
+	totals = totals.Seed(time.Minute, false)
+	totals = totals.Seed(time.Minute, false)
+	assert.Equal(t, 2*time.Minute, totals.Idle)
+
+	totals = totals.Seed(time.Minute, true)
+	assert.Equal(t, seeding.Totals{Uploaded: 10, Downloaded: 100, Seeding: 3 * time.Minute}, totals)
+}
@@ -0,0 +1,89 @@
+// Package stall detects downloads that stopped making progress and escalates the recovery actions.
+package stall
+
+import "time"
+
+type Action int
+
+const (
+	None Action = iota
+	// Recovered is reported when the download progresses again after a recovery action
+	Recovered
+	AnnounceToDHT
+	AddTrackers
+	WidenConnections
+	// SwitchSource is the last resort: another torrent with the same content
+	SwitchSource
+)
+
+func (a Action) String() string {
+	switch a {
+	case Recovered:
+		return "recovered"
+	case AnnounceToDHT:
+		return "announcing to the DHT"
+	case AddTrackers:
+		return "adding fallback trackers"
+	case WidenConnections:
+		return "widening the connection limit"
+	case SwitchSource:
+		return "looking for another source"
+	default:
+		return ""
+	}
+}
+
+type Config struct {
+	// Seconds without progress before each recovery action. Zero disables the detection.
+	Seconds int `json:"seconds"`
+	// AutoSwitch switches to another source with the same content instead of only suggesting it
+	AutoSwitch bool `json:"autoSwitch"`
+}
+
+func DefaultConfig() Config {
+	return Config{Seconds: 60}
+}
+
+// Detector follows the progress of a download, escalating one action for every period without progress
+type Detector struct {
+	after    time.Duration
+	progress int64
+	since    time.Time
+	last     Action
+}
+
+func NewDetector(cfg Config) *Detector {
+	return &Detector{after: time.Duration(cfg.Seconds) * time.Second}
+}
+
+// Observe records the bytes completed and returns the action to take now, if any.
+// A download that is not active, like paused, verifying or complete, is never stalled.
+func (d *Detector) Observe(now time.Time, progress int64, active bool) Action {
+	if d.after <= 0 {
+		return None
+	}
+
+	if !active || d.since.IsZero() || progress > d.progress {
+		d.progress = progress
+		d.since = now
+		recovering := d.last != None && d.last != Recovered
+		d.last = None
+		if active && recovering {
+			d.last = Recovered
+			return Recovered
+		}
+		return None
+	}
+
+	if d.last == SwitchSource || now.Sub(d.since) < d.after {
+		return None
+	}
+
+	d.since = now
+	if d.last < AnnounceToDHT {
+		d.last = AnnounceToDHT
+	} else {
+		d.last++
+	}
+	return d.last
+}
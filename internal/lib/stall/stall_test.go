@@ -0,0 +1,42 @@
+package stall_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quintans/torflix/internal/lib/stall"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetector(t *testing.T) {
+	d := stall.NewDetector(stall.Config{Seconds: 60})
+	now := time.Now()
+
+	assert.Equal(t, stall.None, d.Observe(now, 100, true))
+	assert.Equal(t, stall.None, d.Observe(now.Add(30*time.Second), 100, true))
+
+	actions := []stall.Action{stall.AnnounceToDHT, stall.AddTrackers, stall.WidenConnections, stall.SwitchSource, stall.None}
+	for i, want := range actions {
+		now = now.Add(time.Minute)
+		assert.Equal(t, want, d.Observe(now, 100, true), "step %d", i)
+	}
+
+	now = now.Add(time.Second)
+	assert.Equal(t, stall.Recovered, d.Observe(now, 200, true))
+	assert.Equal(t, stall.None, d.Observe(now.Add(time.Second), 300, true))
+}
+
+func TestDetectorInactive(t *testing.T) {
+	d := stall.NewDetector(stall.Config{Seconds: 60})
+	now := time.Now()
+
+	d.Observe(now, 100, true)
+	assert.Equal(t, stall.None, d.Observe(now.Add(2*time.Minute), 100, false))
+	// the time paused does not count
+	assert.Equal(t, stall.None, d.Observe(now.Add(150*time.Second), 100, true))
+	assert.Equal(t, stall.AnnounceToDHT, d.Observe(now.Add(4*time.Minute), 100, true))
+
+	disabled := stall.NewDetector(stall.Config{})
+	assert.Equal(t, stall.None, disabled.Observe(now, 0, true))
+	assert.Equal(t, stall.None, disabled.Observe(now.Add(time.Hour), 0, true))
+}
@@ -0,0 +1,90 @@
+package subrank
+
+import (
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Release holds the release details found in a file or release name
+type Release struct {
+	// Group is the release group, eg: NTb in Movie.2021.1080p.WEB-DL.x264-NTb
+	Group string
+	// Source is the normalized source: bluray, web-dl, webrip, hdtv, dvd or cam
+	Source     string
+	Resolution string
+}
+
+var (
+	separators = regexp.MustCompile(`[\s._\-\[\]()]+`)
+	// group is at the end, after a dash, or at the start within brackets, as in anime releases
+	trailingGroup = regexp.MustCompile(`-([a-zA-Z0-9]+)(?:\[[^\]]*\])?$`)
+	leadingGroup  = regexp.MustCompile(`^\[([^\]]+)\]`)
+
+	sources = map[string]string{
+		"bluray": "bluray", "bdrip": "bluray", "brrip": "bluray", "bdremux": "bluray", "remux": "bluray",
+		"webdl": "web-dl", "web": "web-dl",
+		"webrip": "webrip",
+		"hdtv":   "hdtv", "pdtv": "hdtv",
+		"dvdrip": "dvd", "dvd": "dvd",
+		"cam": "cam", "hdcam": "cam", "telesync": "cam", "hdts": "cam",
+	}
+	extensions  = []string{".mkv", ".mp4", ".avi", ".mov", ".m4v", ".webm", ".srt", ".ass", ".ssa", ".vtt", ".sub"}
+	resolutions = []string{"480p", "576p", "720p", "1080p", "1440p", "2160p"}
+)
+
+// ParseRelease finds the release details in a file or release name
+func ParseRelease(name string) Release {
+	name = strings.TrimSpace(name)
+	if ext := filepath.Ext(name); slices.Contains(extensions, strings.ToLower(ext)) {
+		name = strings.TrimSuffix(name, ext)
+	}
+
+	var r Release
+	for _, token := range tokens(name) {
+		if s, ok := sources[token]; ok && r.Source == "" {
+			r.Source = s
+		}
+		if token == "4k" {
+			token = "2160p"
+		}
+		if slices.Contains(resolutions, token) && r.Resolution == "" {
+			r.Resolution = token
+		}
+	}
+
+	if m := leadingGroup.FindStringSubmatch(name); m != nil {
+		r.Group = m[1]
+	} else if m := trailingGroup.FindStringSubmatch(name); m != nil && !known(strings.ToLower(m[1])) {
+		r.Group = m[1]
+	}
+	return r
+}
+
+// Merge fills the details that are missing with the ones of other
+func (r Release) Merge(other Release) Release {
+	if r.Group == "" {
+		r.Group = other.Group
+	}
+	if r.Source == "" {
+		r.Source = other.Source
+	}
+	if r.Resolution == "" {
+		r.Resolution = other.Resolution
+	}
+	return r
+}
+
+func tokens(name string) []string {
+	name = strings.ToLower(name)
+	// keep the sources that have a dash together
+	name = strings.NewReplacer("web-dl", "webdl", "blu-ray", "bluray", "web-rip", "webrip").Replace(name)
+	return separators.Split(name, -1)
+}
+
+// known tells if the token is a release detail, like in WEB-DL, and not a group
+func known(token string) bool {
+	_, ok := sources[token]
+	return ok || token == "dl" || token == "rip" || slices.Contains(resolutions, token)
+}
@@ -0,0 +1,79 @@
+// Package subrank scores subtitles by how well they fit a media file and the user preferences.
+package subrank
+
+import (
+	"math"
+	"strings"
+)
+
+// Preferences are the subtitles the user does not want
+type Preferences struct {
+	NoHearingImpaired   bool `json:"noHearingImpaired"`
+	NoMachineTranslated bool `json:"noMachineTranslated"`
+}
+
+// Candidate holds what is known about a subtitle
+type Candidate struct {
+	// Release is the release name the subtitle was made for, or its file name
+	Release string
+	// Exact is set when the subtitle is known to be made for the file
+	Exact             bool
+	Downloads         int
+	Rating            float64 // from 0 to 10, zero if not rated
+	HearingImpaired   bool
+	Trusted           bool
+	MachineTranslated bool // translated by a machine or an AI
+}
+
+const (
+	exactScore       = 1000
+	groupScore       = 40
+	sourceScore      = 20
+	resolutionScore  = 10
+	sourceMismatch   = -20
+	trustedScore     = 10
+	maxRatingScore   = 20
+	maxDownloadScore = 20
+	machineScore     = -30
+)
+
+// Accept tells if the subtitle is wanted by the user
+func Accept(c Candidate, prefs Preferences) bool {
+	return !(prefs.NoHearingImpaired && c.HearingImpaired) &&
+		!(prefs.NoMachineTranslated && c.MachineTranslated)
+}
+
+// Score rates how well the subtitle fits the release of the media file. Higher is better.
+// A subtitle made for the same release group and source is more likely in sync.
+func Score(c Candidate, target Release) int {
+	score := 0
+	if c.Exact {
+		score += exactScore
+	}
+
+	r := ParseRelease(c.Release)
+	if r.Group != "" && strings.EqualFold(r.Group, target.Group) {
+		score += groupScore
+	}
+	if r.Source != "" && target.Source != "" {
+		if r.Source == target.Source {
+			score += sourceScore
+		} else {
+			score += sourceMismatch
+		}
+	}
+	if r.Resolution != "" && r.Resolution == target.Resolution {
+		score += resolutionScore
+	}
+
+	score += int(math.Round(c.Rating / 10 * maxRatingScore))
+	// every tenfold of downloads counts the same
+	score += min(int(math.Round(math.Log10(float64(c.Downloads)+1)*4)), maxDownloadScore)
+	if c.Trusted {
+		score += trustedScore
+	}
+	if c.MachineTranslated {
+		score += machineScore
+	}
+	return score
+}
@@ -0,0 +1,59 @@
+package subrank_test
+
+import (
+	"testing"
+
+	"github.com/quintans/torflix/internal/lib/subrank"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRelease(t *testing.T) {
+	tests := []struct {
+		name string
+		want subrank.Release
+	}{
+		{"The.Lioness.S02E01.1080p.WEB.h264-ETHEL.mkv", subrank.Release{Group: "ETHEL", Source: "web-dl", Resolution: "1080p"}},
+		{"Movie.2021.1080p.BluRay.x264-SPARKS[rarbg]", subrank.Release{Group: "SPARKS", Source: "bluray", Resolution: "1080p"}},
+		{"Movie 2021 2160p WEB-DL DDP5.1", subrank.Release{Source: "web-dl", Resolution: "2160p"}},
+		{"Movie.2021.4K.WEBRip", subrank.Release{Source: "webrip", Resolution: "2160p"}},
+		{"[SubsPlease] Show - 01 (1080p).mkv", subrank.Release{Group: "SubsPlease", Resolution: "1080p"}},
+		{"Movie.2021.720p.WEB-DL", subrank.Release{Source: "web-dl", Resolution: "720p"}},
+		{"Movie.2021.720p.WEB", subrank.Release{Source: "web-dl", Resolution: "720p"}},
+		{"", subrank.Release{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, subrank.ParseRelease(tt.name))
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	target := subrank.ParseRelease("The.Lioness.S02E01.1080p.WEB.h264-ETHEL.mkv")
+
+	same := subrank.Score(subrank.Candidate{Release: "The.Lioness.S02E01.1080p.WEB.h264-ETHEL"}, target)
+	otherGroup := subrank.Score(subrank.Candidate{Release: "The.Lioness.S02E01.1080p.WEB.h264-NTb"}, target)
+	otherSource := subrank.Score(subrank.Candidate{Release: "The.Lioness.S02E01.1080p.BluRay.x264-NTb"}, target)
+	assert.Greater(t, same, otherGroup)
+	assert.Greater(t, otherGroup, otherSource)
+
+	popular := subrank.Score(subrank.Candidate{Release: "The.Lioness.S02E01", Downloads: 10000, Rating: 8, Trusted: true}, target)
+	unknown := subrank.Score(subrank.Candidate{Release: "The.Lioness.S02E01"}, target)
+	assert.Greater(t, popular, unknown)
+
+	machine := subrank.Score(subrank.Candidate{Release: "The.Lioness.S02E01", MachineTranslated: true}, target)
+	assert.Less(t, machine, unknown)
+
+	exact := subrank.Score(subrank.Candidate{Release: "whatever", Exact: true}, target)
+	assert.Greater(t, exact, same)
+}
+
+func TestAccept(t *testing.T) {
+	hi := subrank.Candidate{HearingImpaired: true}
+	mt := subrank.Candidate{MachineTranslated: true}
+
+	assert.True(t, subrank.Accept(hi, subrank.Preferences{}))
+	assert.False(t, subrank.Accept(hi, subrank.Preferences{NoHearingImpaired: true}))
+	assert.True(t, subrank.Accept(mt, subrank.Preferences{NoHearingImpaired: true}))
+	assert.False(t, subrank.Accept(mt, subrank.Preferences{NoMachineTranslated: true}))
+}
@@ -0,0 +1,193 @@
+package subtitles
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/quintans/faults"
+)
+
+// defaultHeader is used when converting other formats to ASS
+const defaultHeader = `[Script Info]
+ScriptType: v4.00+
+PlayResX: 384
+PlayResY: 288
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+Style: Default,Arial,20,&H00FFFFFF,&H000000FF,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,2,1,2,10,10,10,1
+
+`
+
+var (
+	defaultFormat = []string{"Layer", "Start", "End", "Style", "Name", "MarginL", "MarginR", "MarginV", "Effect", "Text"}
+	overrides     = regexp.MustCompile(`\{[^}]*\}`)
+	htmlTags      = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+)
+
+func parseASS(text string) (*Subtitles, error) {
+	s := &Subtitles{}
+	header, events, ok := strings.Cut(text, "[Events]")
+	if !ok {
+		return nil, faults.New("no [Events] section")
+	}
+	s.header = header
+
+	lines := strings.Split(events, "\n")
+	for i, line := range lines {
+		// sections after the events, like the embedded fonts, are kept as they are
+		if strings.HasPrefix(line, "[") {
+			s.footer = strings.Join(lines[i:], "\n")
+			break
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch key = strings.TrimSpace(key); key {
+		case "Format":
+			s.format = nil
+			for _, f := range strings.Split(value, ",") {
+				s.format = append(s.format, strings.TrimSpace(f))
+			}
+			err := checkFormat(s.format)
+			if err != nil {
+				return nil, err
+			}
+		case "Dialogue", "Comment":
+			if s.format == nil {
+				s.format = defaultFormat
+			}
+			// the text is the last field and may have commas
+			fields := strings.SplitN(strings.TrimSpace(value), ",", len(s.format))
+			if len(fields) != len(s.format) {
+				continue
+			}
+			c, err := s.cue(fields)
+			if err != nil {
+				return nil, err
+			}
+			if key == "Comment" {
+				s.comments = append(s.comments, c)
+			} else {
+				s.Cues = append(s.Cues, c)
+			}
+		}
+	}
+	if s.format == nil {
+		s.format = defaultFormat
+	}
+	return s, nil
+}
+
+// checkFormat tells if the fields of the events have the timing and the text, the last one because it may have commas
+func checkFormat(format []string) error {
+	for _, name := range []string{"Start", "End", "Text"} {
+		if !slices.Contains(format, name) {
+			return faults.Errorf("no %s in the events format", name)
+		}
+	}
+	if format[len(format)-1] != "Text" {
+		return faults.New("the text is not the last field of the events format")
+	}
+	return nil
+}
+
+func (s *Subtitles) cue(fields []string) (Cue, error) {
+	start, err := parseASSTimestamp(fields[slices.Index(s.format, "Start")])
+	if err != nil {
+		return Cue{}, err
+	}
+	end, err := parseASSTimestamp(fields[slices.Index(s.format, "End")])
+	if err != nil {
+		return Cue{}, err
+	}
+	return Cue{
+		Start:  start,
+		End:    end,
+		Text:   assToText(fields[len(fields)-1]),
+		fields: fields,
+	}, nil
+}
+
+// parseASSTimestamp reads h:mm:ss.cc
+func parseASSTimestamp(ts string) (time.Duration, error) {
+	var h, m, sec, cs int
+	_, err := fmt.Sscanf(strings.TrimSpace(ts), "%d:%d:%d.%d", &h, &m, &sec, &cs)
+	if err != nil {
+		return 0, faults.Errorf("invalid timestamp '%s': %w", ts, err)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+		time.Duration(sec)*time.Second + time.Duration(cs)*10*time.Millisecond, nil
+}
+
+func formatASSTimestamp(d time.Duration) string {
+	cs := d.Milliseconds() / 10
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360_000, cs/6000%60, cs/100%60, cs%100)
+}
+
+// assToText converts the ASS text to plain text, keeping the italic and bold
+func assToText(text string) string {
+	text = strings.NewReplacer(`{\i1}`, "<i>", `{\i0}`, "</i>", `{\b1}`, "<b>", `{\b0}`, "</b>").Replace(text)
+	text = overrides.ReplaceAllString(text, "")
+	return strings.NewReplacer(`\N`, "\n", `\n`, "\n", `\h`, " ").Replace(text)
+}
+
+func textToASS(text string) string {
+	text = strings.NewReplacer("<i>", `{\i1}`, "</i>", `{\i0}`, "<b>", `{\b1}`, "</b>", `{\b0}`).Replace(text)
+	text = htmlTags.ReplaceAllString(text, "")
+	return strings.ReplaceAll(text, "\n", `\N`)
+}
+
+func (s *Subtitles) encodeASS() []byte {
+	var sb strings.Builder
+	format := s.format
+	if s.header == "" {
+		sb.WriteString(defaultHeader)
+		format = defaultFormat
+	} else {
+		sb.WriteString(s.header)
+	}
+	sb.WriteString("[Events]\nFormat: " + strings.Join(format, ", ") + "\n")
+
+	start, end := slices.Index(format, "Start"), slices.Index(format, "End")
+	write := func(kind string, c Cue) {
+		fields := slices.Clone(c.fields)
+		if len(fields) != len(format) {
+			fields = newFields(format, c.Text)
+		}
+		fields[start] = formatASSTimestamp(c.Start)
+		fields[end] = formatASSTimestamp(c.End)
+		sb.WriteString(kind + ": " + strings.Join(fields, ",") + "\n")
+	}
+	for _, c := range s.Cues {
+		write("Dialogue", c)
+	}
+	for _, c := range s.comments {
+		write("Comment", c)
+	}
+
+	if s.footer != "" {
+		sb.WriteString("\n" + s.footer)
+	}
+	return []byte(sb.String())
+}
+
+// newFields returns the fields of a dialogue with the text, in the default style and without margins
+func newFields(format []string, text string) []string {
+	fields := make([]string, len(format))
+	for i, name := range format {
+		switch name {
+		case "Layer", "MarginL", "MarginR", "MarginV":
+			fields[i] = "0"
+		case "Style":
+			fields[i] = "Default"
+		case "Text":
+			fields[i] = textToASS(text)
+		}
+	}
+	return fields
+}
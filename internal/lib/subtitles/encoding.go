@@ -0,0 +1,103 @@
+package subtitles
+
+import (
+	"bytes"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/quintans/torflix/internal/lib/lang"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	xunicode "golang.org/x/text/encoding/unicode"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// codePages are the legacy Windows code pages usually used for the subtitles of each language
+var codePages = map[string]*charmap.Charmap{
+	"cs": charmap.Windows1250, "sk": charmap.Windows1250, "pl": charmap.Windows1250, "hu": charmap.Windows1250,
+	"hr": charmap.Windows1250, "sl": charmap.Windows1250, "ro": charmap.Windows1250, "bs": charmap.Windows1250,
+	"sq": charmap.Windows1250,
+	"ru": charmap.Windows1251, "uk": charmap.Windows1251, "bg": charmap.Windows1251, "mk": charmap.Windows1251,
+	"sr": charmap.Windows1251, "be": charmap.Windows1251,
+	"el": charmap.Windows1253,
+	"tr": charmap.Windows1254,
+	"he": charmap.Windows1255,
+	"ar": charmap.Windows1256, "fa": charmap.Windows1256,
+	"et": charmap.Windows1257, "lt": charmap.Windows1257, "lv": charmap.Windows1257,
+	"vi": charmap.Windows1258,
+}
+
+// guesses are tried, in order, when the language does not tell the code page
+var guesses = []*charmap.Charmap{charmap.Windows1252, charmap.Windows1250, charmap.Windows1251}
+
+// ToUTF8 re-encodes the subtitle to UTF-8, without a byte order mark.
+// Text that is not valid UTF-8 is decoded with the code page of the language, or the most plausible one if unknown.
+func ToUTF8(data []byte, language string) []byte {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return data[len(bomUTF8):]
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return decode(xunicode.UTF16(xunicode.LittleEndian, xunicode.UseBOM), data)
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return decode(xunicode.UTF16(xunicode.BigEndian, xunicode.UseBOM), data)
+	case utf8.Valid(data):
+		return data
+	}
+
+	if cp, ok := codePages[lang.Base(language)]; ok {
+		return decode(cp, data)
+	}
+
+	var best []byte
+	bestScore := -1
+	for _, cp := range guesses {
+		decoded := decode(cp, data)
+		if score := plausibility(decoded); score > bestScore {
+			best, bestScore = decoded, score
+		}
+	}
+	return best
+}
+
+func decode(enc encoding.Encoding, data []byte) []byte {
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return data
+	}
+	return decoded
+}
+
+// plausibility counts the letters of the plausible words of the text.
+// A wrong code page mixes latin, cyrillic and symbols in the same word,
+// or makes words of accented letters only, like Ïðèâåò.
+func plausibility(text []byte) int {
+	score := 0
+	for _, word := range bytes.Fields(text) {
+		latin, accented, cyrillic, other := 0, 0, 0, 0
+		for _, r := range string(word) {
+			switch {
+			case unicode.Is(unicode.Latin, r):
+				latin++
+				if r > 0x7F {
+					accented++
+				}
+			case unicode.Is(unicode.Cyrillic, r):
+				cyrillic++
+			case unicode.IsLetter(r), unicode.IsControl(r), r == utf8.RuneError:
+				other++
+			case r > 0x7F && !unicode.IsPunct(r):
+				// symbols like ¤ or ¦ are rare in dialogues
+				other++
+			}
+		}
+		if other == 0 && (latin == 0 || cyrillic == 0) && accented*2 <= latin {
+			score += latin + cyrillic
+		}
+	}
+	return score
+}
@@ -0,0 +1,101 @@
+package subtitles
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/quintans/faults"
+)
+
+// timing matches the timing line of SRT and WebVTT cues. WebVTT may omit the hours.
+var (
+	timing = regexp.MustCompile(`^\s*((?:\d+:)?\d{1,2}:\d{2}[,.]\d{1,3})\s*-->\s*((?:\d+:)?\d{1,2}:\d{2}[,.]\d{1,3})`)
+	// tags other than italic, bold and underline are removed
+	unknownTags = regexp.MustCompile(`</?(?:font|c|v|lang|ruby|rt|span)[^>]*>`)
+)
+
+// parseBlocks reads SRT and WebVTT, whose cues are blocks separated by blank lines with a timing line
+func parseBlocks(text string) (*Subtitles, error) {
+	s := &Subtitles{}
+	for _, block := range strings.Split(text, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		// the timing line is the first, or the second after a numeric or WebVTT identifier
+		idx := -1
+		for i := 0; i < len(lines) && i < 2; i++ {
+			if timing.MatchString(lines[i]) {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			// WEBVTT header, NOTE, STYLE and REGION blocks
+			continue
+		}
+
+		m := timing.FindStringSubmatch(lines[idx])
+		start, err := parseTimestamp(m[1])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseTimestamp(m[2])
+		if err != nil {
+			return nil, err
+		}
+		s.Cues = append(s.Cues, Cue{
+			Start: start,
+			End:   end,
+			Text:  unknownTags.ReplaceAllString(strings.Join(lines[idx+1:], "\n"), ""),
+		})
+	}
+	return s, nil
+}
+
+// parseTimestamp reads [hh:]mm:ss,mmm or [hh:]mm:ss.mmm
+func parseTimestamp(ts string) (time.Duration, error) {
+	ts = strings.ReplaceAll(ts, ",", ".")
+	secs, frac, _ := strings.Cut(ts, ".")
+	parts := strings.Split(secs, ":")
+
+	var d time.Duration
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, faults.Errorf("invalid timestamp '%s': %w", ts, err)
+		}
+		d = d*60 + time.Duration(n)
+	}
+	d *= time.Second
+
+	// the fraction may have less than 3 digits, eg: .5 is 500ms
+	frac = (frac + "000")[:3]
+	ms, err := strconv.Atoi(frac)
+	if err != nil {
+		return 0, faults.Errorf("invalid timestamp '%s': %w", ts, err)
+	}
+	return d + time.Duration(ms)*time.Millisecond, nil
+}
+
+func formatTimestamp(d time.Duration, sep string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3_600_000, ms/60_000%60, ms/1000%60, sep, ms%1000)
+}
+
+func (s *Subtitles) encodeSRT() []byte {
+	var sb strings.Builder
+	for i, c := range s.Cues {
+		fmt.Fprintf(&sb, "%d\n%s --> %s\n%s\n\n", i+1, formatTimestamp(c.Start, ","), formatTimestamp(c.End, ","), c.Text)
+	}
+	return []byte(sb.String())
+}
+
+func (s *Subtitles) encodeVTT() []byte {
+	var sb strings.Builder
+	sb.WriteString("WEBVTT\n\n")
+	for _, c := range s.Cues {
+		fmt.Fprintf(&sb, "%s --> %s\n%s\n\n", formatTimestamp(c.Start, "."), formatTimestamp(c.End, "."), c.Text)
+	}
+	return []byte(sb.String())
+}
@@ -0,0 +1,152 @@
+// Package subtitles normalizes subtitle files: re-encodes them to UTF-8, converts between SRT, WebVTT and ASS,
+// removes the ads and corrects their timing.
+package subtitles
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/quintans/faults"
+)
+
+type Format string
+
+const (
+	SRT Format = "srt"
+	VTT Format = "vtt"
+	ASS Format = "ass"
+)
+
+// FormatOf returns the format of a subtitle file by its extension. SSA is read as ASS.
+func FormatOf(filename string) (Format, bool) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".srt":
+		return SRT, true
+	case ".vtt":
+		return VTT, true
+	case ".ass", ".ssa":
+		return ASS, true
+	default:
+		return "", false
+	}
+}
+
+// Cue is a subtitle shown from Start to End
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	// Text is the plain text, with lines separated by \n and the italic and bold as <i> and <b> tags
+	Text string
+	// fields are the fields of the ASS dialogue line, kept to write it back with its style
+	fields []string
+}
+
+// Subtitles is a parsed subtitle file
+type Subtitles struct {
+	// header is the ASS script, up to the events, kept to write it back
+	header string
+	// format is the format line of the ASS events, naming the fields
+	format []string
+	// comments are the ASS comment events, kept to write them back
+	comments []Cue
+	// footer are the ASS sections after the events, like the fonts, kept to write them back
+	footer string
+	Cues   []Cue
+}
+
+// Parse reads a subtitle file in UTF-8
+func Parse(data []byte, format Format) (*Subtitles, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	var s *Subtitles
+	var err error
+	switch format {
+	case SRT, VTT:
+		s, err = parseBlocks(text)
+	case ASS:
+		s, err = parseASS(text)
+	default:
+		return nil, faults.Errorf("unsupported subtitle format '%s'", format)
+	}
+	if err != nil {
+		return nil, faults.Errorf("parsing %s: %w", format, err)
+	}
+	return s, nil
+}
+
+// Encode writes the subtitles in the format
+func (s *Subtitles) Encode(format Format) []byte {
+	switch format {
+	case VTT:
+		return s.encodeVTT()
+	case ASS:
+		return s.encodeASS()
+	default:
+		return s.encodeSRT()
+	}
+}
+
+// Shift moves every cue by the offset. Cues moved before the start are clamped to it.
+func (s *Subtitles) Shift(offset time.Duration) {
+	s.retime(func(d time.Duration) time.Duration {
+		return max(d+offset, 0)
+	})
+}
+
+// ChangeFrameRate corrects subtitles timed for a video with another frame rate, eg: 25 to 23.976
+func (s *Subtitles) ChangeFrameRate(from, to float64) {
+	if from <= 0 || to <= 0 {
+		return
+	}
+	ratio := from / to
+	s.retime(func(d time.Duration) time.Duration {
+		return time.Duration(float64(d) * ratio)
+	})
+}
+
+func (s *Subtitles) retime(fn func(time.Duration) time.Duration) {
+	for _, cues := range [][]Cue{s.Cues, s.comments} {
+		for i := range cues {
+			cues[i].Start = fn(cues[i].Start)
+			cues[i].End = fn(cues[i].End)
+		}
+	}
+}
+
+var ads = regexp.MustCompile(`(?i)(opensubtitles|podnapisi|addic7ed|subscene|yts\.|yify|` +
+	`www\.|https?://|\.(com|org|net)\b|` +
+	`subtitles? (by|from)|(re)?sync(ed|hronized)? (by|and corrected)|corrected by|ripped by|downloaded from|` +
+	`advertise your product|become (a )?vip member)`)
+
+// StripAds removes the cues that advertise sites or credit the subtitle authors, returning how many were removed
+func (s *Subtitles) StripAds() int {
+	kept := s.Cues[:0]
+	for _, c := range s.Cues {
+		if !ads.MatchString(c.Text) {
+			kept = append(kept, c)
+		}
+	}
+	removed := len(s.Cues) - len(kept)
+	s.Cues = kept
+	return removed
+}
+
+// Normalize re-encodes the subtitle to UTF-8 and removes its ads, keeping its format.
+// Unknown or malformed formats are only re-encoded.
+func Normalize(data []byte, filename, language string) []byte {
+	data = ToUTF8(data, language)
+
+	format, ok := FormatOf(filename)
+	if !ok {
+		return data
+	}
+	s, err := Parse(data, format)
+	if err != nil || len(s.Cues) == 0 {
+		return data
+	}
+	s.StripAds()
+	return s.Encode(format)
+}
@@ -0,0 +1,157 @@
+package subtitles_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quintans/torflix/internal/lib/subtitles"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/charmap"
+)
+
+const srt = "1\r\n00:00:01,000 --> 00:00:02,500\r\n<i>Hello</i>\r\nthere\r\n\r\n" +
+	"2\r\n00:00:03,000 --> 00:00:04,000\r\nSubtitles by www.example.com\r\n\r\n" +
+	"3\r\n00:01:05,250 --> 00:01:07,000\r\n<font color=\"red\">Bye</font>\r\n"
+
+func TestParseSRT(t *testing.T) {
+	s, err := subtitles.Parse([]byte(srt), subtitles.SRT)
+	require.NoError(t, err)
+	require.Len(t, s.Cues, 3)
+	assert.Equal(t, subtitles.Cue{Start: time.Second, End: 2500 * time.Millisecond, Text: "<i>Hello</i>\nthere"}, s.Cues[0])
+	assert.Equal(t, "Bye", s.Cues[2].Text)
+	assert.Equal(t, time.Minute+5250*time.Millisecond, s.Cues[2].Start)
+}
+
+func TestStripAds(t *testing.T) {
+	s, err := subtitles.Parse([]byte(srt), subtitles.SRT)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, s.StripAds())
+	assert.Equal(t, "1\n00:00:01,000 --> 00:00:02,500\n<i>Hello</i>\nthere\n\n2\n00:01:05,250 --> 00:01:07,000\nBye\n\n", string(s.Encode(subtitles.SRT)))
+}
+
+func TestConvertToVTT(t *testing.T) {
+	s, err := subtitles.Parse([]byte(srt), subtitles.SRT)
+	require.NoError(t, err)
+
+	vtt := s.Encode(subtitles.VTT)
+	assert.Contains(t, string(vtt), "WEBVTT\n\n00:00:01.000 --> 00:00:02.500\n<i>Hello</i>\nthere\n\n")
+
+	back, err := subtitles.Parse(vtt, subtitles.VTT)
+	require.NoError(t, err)
+	assert.Equal(t, s.Cues, back.Cues)
+}
+
+func TestParseVTT(t *testing.T) {
+	vtt := "WEBVTT\n\nNOTE a comment\n\nintro\n01:02.500 --> 01:03.000 align:start\n<v Bob>Hi</v>\n"
+	s, err := subtitles.Parse([]byte(vtt), subtitles.VTT)
+	require.NoError(t, err)
+	require.Len(t, s.Cues, 1)
+	assert.Equal(t, subtitles.Cue{Start: time.Minute + 2500*time.Millisecond, End: time.Minute + 3*time.Second, Text: "Hi"}, s.Cues[0])
+}
+
+func TestConvertToASS(t *testing.T) {
+	s, err := subtitles.Parse([]byte(srt), subtitles.SRT)
+	require.NoError(t, err)
+
+	ass := string(s.Encode(subtitles.ASS))
+	assert.Contains(t, ass, "[Script Info]")
+	assert.Contains(t, ass, `Dialogue: 0,0:00:01.00,0:00:02.50,Default,,0,0,0,,{\i1}Hello{\i0}\Nthere`)
+
+	back, err := subtitles.Parse([]byte(ass), subtitles.ASS)
+	require.NoError(t, err)
+	assert.Equal(t, "<i>Hello</i>\nthere", back.Cues[0].Text)
+}
+
+func TestASSKeepsStyles(t *testing.T) {
+	ass := "[Script Info]\nTitle: test\n\n[V4+ Styles]\nStyle: Top,Arial,20\n\n[Events]\n" +
+		"Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n" +
+		"Dialogue: 0,0:00:01.00,0:00:02.00,Top,,0,0,0,,{\\pos(10,10)}Hello, world\\NBye\n"
+	s, err := subtitles.Parse([]byte(ass), subtitles.ASS)
+	require.NoError(t, err)
+	require.Len(t, s.Cues, 1)
+	assert.Equal(t, "Hello, world\nBye", s.Cues[0].Text)
+
+	s.Shift(time.Second)
+	out := string(s.Encode(subtitles.ASS))
+	assert.Contains(t, out, "Title: test")
+	assert.Contains(t, out, "Dialogue: 0,0:00:02.00,0:00:03.00,Top,,0,0,0,,{\\pos(10,10)}Hello, world\\NBye\n")
+}
+
+func TestASSKeepsCommentsAndSections(t *testing.T) {
+	ass := "[Script Info]\nTitle: test\n\n[Events]\n" +
+		"Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n" +
+		"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,Hello\n" +
+		"Comment: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,translator note\n" +
+		"\n[Fonts]\nfontname: a.ttf\n"
+	s, err := subtitles.Parse([]byte(ass), subtitles.ASS)
+	require.NoError(t, err)
+	require.Len(t, s.Cues, 1)
+
+	s.Shift(time.Second)
+	out := string(s.Encode(subtitles.ASS))
+	assert.Contains(t, out, "Dialogue: 0,0:00:02.00,0:00:03.00,Default,,0,0,0,,Hello\n")
+	assert.Contains(t, out, "Comment: 0,0:00:02.00,0:00:03.00,Default,,0,0,0,,translator note\n")
+	assert.Contains(t, out, "\n[Fonts]\nfontname: a.ttf\n")
+}
+
+func TestNormalizeInvalidASSFormat(t *testing.T) {
+	for _, format := range []string{
+		"Layer, Begin, End, Style, Text",
+		"Layer, Start, Finish, Style, Text",
+		"Layer, Start, End, Style, Name",
+		"Layer, Start, End, Text, Style",
+	} {
+		ass := "[Script Info]\n\n[Events]\nFormat: " + format + "\n" +
+			"Dialogue: 0,0:00:01.00,0:00:02.00,Default,Hello\n"
+		_, err := subtitles.Parse([]byte(ass), subtitles.ASS)
+		assert.Error(t, err, format)
+
+		// the file is kept as it is
+		assert.Equal(t, ass, string(subtitles.Normalize([]byte(ass), "movie.ass", "en")), format)
+	}
+}
+
+func TestTiming(t *testing.T) {
+	s, err := subtitles.Parse([]byte(srt), subtitles.SRT)
+	require.NoError(t, err)
+
+	s.Shift(-1500 * time.Millisecond)
+	assert.Equal(t, time.Duration(0), s.Cues[0].Start)
+	assert.Equal(t, time.Second, s.Cues[0].End)
+
+	s.ChangeFrameRate(25, 23.976)
+	assert.Equal(t, 1043*time.Millisecond, s.Cues[0].End.Round(time.Millisecond))
+}
+
+func TestToUTF8(t *testing.T) {
+	latin, err := charmap.Windows1252.NewEncoder().String("Olá, está tudo bem?")
+	require.NoError(t, err)
+	assert.Equal(t, "Olá, está tudo bem?", string(subtitles.ToUTF8([]byte(latin), "pt-PT")))
+	assert.Equal(t, "Olá, está tudo bem?", string(subtitles.ToUTF8([]byte(latin), "")))
+
+	czech, err := charmap.Windows1250.NewEncoder().String("Příliš žluťoučký kůň")
+	require.NoError(t, err)
+	assert.Equal(t, "Příliš žluťoučký kůň", string(subtitles.ToUTF8([]byte(czech), "cze")))
+
+	russian, err := charmap.Windows1251.NewEncoder().String("Привет, как дела?")
+	require.NoError(t, err)
+	assert.Equal(t, "Привет, как дела?", string(subtitles.ToUTF8([]byte(russian), "")))
+
+	assert.Equal(t, "já", string(subtitles.ToUTF8([]byte("\xEF\xBB\xBFjá"), "")))
+	assert.Equal(t, "hi", string(subtitles.ToUTF8([]byte{0xFF, 0xFE, 'h', 0, 'i', 0}, "")))
+}
+
+func TestNormalize(t *testing.T) {
+	data, err := charmap.Windows1252.NewEncoder().String("1\n00:00:01,000 --> 00:00:02,000\nOlá\n\n2\n00:00:03,000 --> 00:00:04,000\nDownloaded from YTS.MX\n")
+	require.NoError(t, err)
+
+	out := subtitles.Normalize([]byte(data), "movie.pt.srt", "pt")
+	assert.Equal(t, "1\n00:00:01,000 --> 00:00:02,000\nOlá\n\n", string(out))
+
+	// unknown formats are only re-encoded
+	out = subtitles.Normalize([]byte(data), "movie.sub", "pt")
+	assert.Contains(t, string(out), "Olá")
+	assert.Contains(t, string(out), "YTS")
+}
@@ -0,0 +1,80 @@
+// Package transfer measures the transfer rates of a torrent from its byte counters.
+package transfer
+
+import (
+	"time"
+
+	"github.com/quintans/torflix/internal/lib/ds"
+	"github.com/quintans/torflix/internal/lib/ewma"
+)
+
+const (
+	// smoothing is the weight of the last sample in the rates
+	smoothing = 0.3
+	// HistorySize is the usual number of samples kept, two minutes when sampling every second
+	HistorySize = 120
+)
+
+// Sample holds the smoothed rates, in bytes per second, at a point in time
+type Sample struct {
+	Time     time.Time
+	Download float64
+	Upload   float64
+}
+
+// Meter turns the byte counters of a session into smoothed rates, keeping their recent history
+type Meter struct {
+	download   *ewma.EWMA
+	upload     *ewma.EWMA
+	history    *ds.Ring[Sample]
+	last       time.Time
+	downloaded int64
+	uploaded   int64
+}
+
+// NewMeter creates a meter that keeps the last size samples
+func NewMeter(size int) *Meter {
+	return &Meter{
+		download: ewma.New(smoothing),
+		upload:   ewma.New(smoothing),
+		history:  ds.NewRing[Sample](size),
+	}
+}
+
+// Add records the counters of the session, returning the bytes transferred since the last call
+func (m *Meter) Add(now time.Time, downloaded, uploaded int64) (int64, int64) {
+	if m.last.IsZero() {
+		m.last = now
+		m.downloaded = downloaded
+		m.uploaded = uploaded
+		return downloaded, uploaded
+	}
+
+	down := downloaded - m.downloaded
+	up := uploaded - m.uploaded
+	elapsed := now.Sub(m.last).Seconds()
+	if elapsed <= 0 {
+		return 0, 0
+	}
+	m.last = now
+	m.downloaded = downloaded
+	m.uploaded = uploaded
+
+	m.history.Push(Sample{
+		Time:     now,
+		Download: m.download.Add(float64(down) / elapsed),
+		Upload:   m.upload.Add(float64(up) / elapsed),
+	})
+
+	return down, up
+}
+
+// Rates returns the smoothed download and upload rates, in bytes per second
+func (m *Meter) Rates() (float64, float64) {
+	return m.download.Value(), m.upload.Value()
+}
+
+// History returns the samples from the oldest to the newest
+func (m *Meter) History() []Sample {
+	return m.history.Values()
+}
@@ -0,0 +1,33 @@
+package transfer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quintans/torflix/internal/lib/transfer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeter(t *testing.T) {
+	m := transfer.NewMeter(2)
+	now := time.Now()
+
+	down, up := m.Add(now, 100, 10)
+	assert.Equal(t, int64(100), down)
+	assert.Equal(t, int64(10), up)
+	assert.Empty(t, m.History())
+
+	down, up = m.Add(now.Add(2*time.Second), 300, 10)
+	assert.Equal(t, int64(200), down)
+	assert.Equal(t, int64(0), up)
+	d, u := m.Rates()
+	assert.Equal(t, 100.0, d)
+	assert.Equal(t, 0.0, u)
+
+	m.Add(now.Add(3*time.Second), 300, 110)
+	m.Add(now.Add(4*time.Second), 300, 110)
+	history := m.History()
+	assert.Len(t, history, 2)
+	assert.Equal(t, now.Add(4*time.Second), history[1].Time)
+	assert.Less(t, history[1].Download, history[0].Download)
+}
@@ -0,0 +1,62 @@
+package model
+
+import "time"
+
+const (
+	// FinishedWatched is the percentage after which a file is finished, since the credits are seldom watched
+	FinishedWatched = 92.0
+	// minResume is the position under which the playback starts from the beginning
+	minResume = 10 * time.Second
+)
+
+// WatchEntry is how much of a file of a torrent was watched
+type WatchEntry struct {
+	// Position is where the playback was left, zero if unknown
+	Position time.Duration `json:"position"`
+	// Duration is zero if unknown
+	Duration time.Duration `json:"duration"`
+	// Watched is the percentage of the file played
+	Watched  float64   `json:"watched"`
+	Finished bool      `json:"finished"`
+	Updated  time.Time `json:"updated"`
+}
+
+// Resume returns where to start playing the file again: where it was left, unless that was near its end
+func (e WatchEntry) Resume() time.Duration {
+	if e.Watched >= FinishedWatched || e.Position < minResume {
+		return 0
+	}
+	return e.Position
+}
+
+// WatchHistory holds what was watched of every torrent, by info hash and then by file path
+type WatchHistory struct {
+	Torrents map[string]map[string]WatchEntry `json:"torrents"`
+}
+
+func (h *WatchHistory) Entry(infoHash, path string) (WatchEntry, bool) {
+	e, ok := h.Torrents[infoHash][path]
+	return e, ok
+}
+
+// Observe records the percentage watched of the file and, if known, the position and the duration
+func (h *WatchHistory) Observe(infoHash, path string, watched float64, position, duration time.Duration, now time.Time) {
+	if h.Torrents == nil {
+		h.Torrents = map[string]map[string]WatchEntry{}
+	}
+	files := h.Torrents[infoHash]
+	if files == nil {
+		files = map[string]WatchEntry{}
+		h.Torrents[infoHash] = files
+	}
+
+	e := files[path]
+	e.Watched = min(max(watched, 0), 100)
+	e.Position = position
+	if duration > 0 {
+		e.Duration = duration
+	}
+	e.Finished = e.Finished || e.Watched >= FinishedWatched
+	e.Updated = now
+	files[path] = e
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+
+	"github.com/quintans/torflix/internal/lib/seeding"
+)
+
+// TorrentSeeding holds the time a torrent spent seeding and its own seeding policy, if any.
+// The bytes it transferred are in its transfer totals.
+type TorrentSeeding struct {
+	// Seeding is the time spent seeding, after the download completed
+	Seeding time.Duration `json:"seeding"`
+	// Idle is the time seeding since the last upload
+	Idle   time.Duration   `json:"idle"`
+	Policy *seeding.Policy `json:"policy,omitempty"`
+}
+
+// Totals joins the seeding times with the bytes transferred by the torrent
+func (s TorrentSeeding) Totals(transfer TransferTotals) seeding.Totals {
+	return seeding.Totals{
+		Uploaded:   transfer.Uploaded,
+		Downloaded: transfer.Downloaded,
+		Seeding:    s.Seeding,
+		Idle:       s.Idle,
+	}
+}
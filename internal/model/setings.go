@@ -1,8 +1,58 @@
 package model
 
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/quintans/torflix/internal/lib/bandwidth"
+	"github.com/quintans/torflix/internal/lib/proxy"
+	"github.com/quintans/torflix/internal/lib/safety"
+	"github.com/quintans/torflix/internal/lib/seeding"
+	"github.com/quintans/torflix/internal/lib/stall"
+	"github.com/quintans/torflix/internal/lib/subrank"
+)
+
 type Player struct {
 	Args []string `json:"args"`
-	Subs string   `json:"subs"`
+	// SubFile is the option that loads a subtitle URL, repeated for each subtitle
+	SubFile string `json:"subFile"`
+	// Start is the option that sets the position to start playing at, in seconds
+	Start string `json:"start"`
+}
+
+// IsMPV tells if the player is mpv, also when run through flatpak (io.mpv.Mpv)
+func (p Player) IsMPV() bool {
+	for _, arg := range p.Args {
+		if strings.HasPrefix(arg, "-") {
+			break
+		}
+		name := strings.TrimSuffix(strings.ToLower(filepath.Base(arg)), ".exe")
+		if name == "mpv" || name == "io.mpv.mpv" {
+			return true
+		}
+	}
+	return false
+}
+
+// Bandwidth holds the scheduled limits and the alternative limits used in turbo mode.
+// Rates are in bytes per second and zero means unlimited.
+type Bandwidth struct {
+	Schedule        []bandwidth.Window `json:"schedule"`
+	AltDownloadRate int                `json:"altDownloadRate"`
+	AltUploadRate   int                `json:"altUploadRate"`
+}
+
+// SubtitleSources selects the subtitle providers. Every provider is enabled unless disabled.
+type SubtitleSources struct {
+	Disabled []string `json:"disabled"`
+	// Folders are searched by the local provider
+	Folders []string `json:"folders"`
+}
+
+// Enabled reports whether the provider is enabled
+func (s SubtitleSources) Enabled(provider string) bool {
+	return !slices.Contains(s.Disabled, provider)
 }
 
 type Settings struct {
@@ -16,6 +66,18 @@ type Settings struct {
 	languages         []string
 	qualities         []string
 	uploadRate        int
+	downloadRate      int
+	bandwidth         Bandwidth
+	seedingPolicy     seeding.Policy
+	blocklists        []string
+	proxy             proxy.Config
+	bindInterface     string
+	stall             stall.Config
+	autoPlay          bool
+	subtitleSources   SubtitleSources
+	subtitlePrefs     subrank.Preferences
+	safety            safety.Rules
+	fallbackTrackers  []string
 	OpenSubtitles     OpenSubtitles
 }
 
@@ -30,13 +92,13 @@ func NewSettings() *Settings {
 		player: Player{
 			Args: []string{
 				"mpv",
-				"--save-position-on-quit",
 				"--sub-auto=all",
 				"--profile=fast",
 				"--hwdec=auto-safe",
 				"--fs",
 			},
-			Subs: "--sub-file-paths=",
+			SubFile: "--sub-file=",
+			Start:   "--start=",
 		},
 		torrentPort:       50007,
 		seed:              true,
@@ -45,6 +107,10 @@ func NewSettings() *Settings {
 		maxConnections:    200,
 		languages:         []string{"po-PT", "pt-BR", "en"},
 		qualities:         qualities,
+		safety:            safety.DefaultRules(),
+		fallbackTrackers:  fallbackTrackers,
+		stall:             stall.DefaultConfig(),
+		autoPlay:          true,
 		OpenSubtitles: OpenSubtitles{
 			Username: "",
 			Password: "",
@@ -134,6 +200,110 @@ func (m *Settings) SetUploadRate(uploadRate int) {
 	m.uploadRate = uploadRate
 }
 
+func (m *Settings) DownloadRate() int {
+	return m.downloadRate
+}
+
+func (m *Settings) SetDownloadRate(downloadRate int) {
+	m.downloadRate = downloadRate
+}
+
+func (m *Settings) Bandwidth() Bandwidth {
+	return m.bandwidth
+}
+
+func (m *Settings) SetBandwidth(bandwidth Bandwidth) {
+	m.bandwidth = bandwidth
+}
+
+// SeedingPolicy is the policy of the torrents that do not have their own
+func (m *Settings) SeedingPolicy() seeding.Policy {
+	return m.seedingPolicy
+}
+
+func (m *Settings) SetSeedingPolicy(policy seeding.Policy) {
+	m.seedingPolicy = policy
+}
+
+// Blocklists are the files or URLs of the IP blocklists, in the P2P or DAT formats
+func (m *Settings) Blocklists() []string {
+	return m.blocklists
+}
+
+func (m *Settings) SetBlocklists(blocklists []string) {
+	m.blocklists = blocklists
+}
+
+// Proxy is used by every outbound connection
+func (m *Settings) Proxy() proxy.Config {
+	return m.proxy
+}
+
+func (m *Settings) SetProxy(cfg proxy.Config) {
+	m.proxy = cfg
+}
+
+// BindInterface is the interface name, or IP, that the torrent traffic is bound to. Empty binds to all.
+func (m *Settings) BindInterface() string {
+	return m.bindInterface
+}
+
+func (m *Settings) SetBindInterface(bindInterface string) {
+	m.bindInterface = bindInterface
+}
+
+// Stall configures the detection and recovery of downloads that stopped making progress
+func (m *Settings) Stall() stall.Config {
+	return m.stall
+}
+
+func (m *Settings) SetStall(cfg stall.Config) {
+	m.stall = cfg
+}
+
+// AutoPlay launches the player as soon as the file can be played through without stalling
+func (m *Settings) AutoPlay() bool {
+	return m.autoPlay
+}
+
+func (m *Settings) SetAutoPlay(autoPlay bool) {
+	m.autoPlay = autoPlay
+}
+
+func (m *Settings) SubtitleSources() SubtitleSources {
+	return m.subtitleSources
+}
+
+func (m *Settings) SetSubtitleSources(sources SubtitleSources) {
+	m.subtitleSources = sources
+}
+
+// SubtitlePreferences are the subtitles that are not downloaded
+func (m *Settings) SubtitlePreferences() subrank.Preferences {
+	return m.subtitlePrefs
+}
+
+func (m *Settings) SetSubtitlePreferences(prefs subrank.Preferences) {
+	m.subtitlePrefs = prefs
+}
+
+func (m *Settings) Safety() safety.Rules {
+	return m.safety
+}
+
+func (m *Settings) SetSafety(rules safety.Rules) {
+	m.safety = rules
+}
+
+// FallbackTrackers are public trackers used when a torrent does not bring its own
+func (m *Settings) FallbackTrackers() []string {
+	return m.fallbackTrackers
+}
+
+func (m *Settings) SetFallbackTrackers(trackers []string) {
+	m.fallbackTrackers = trackers
+}
+
 func (m *Settings) Hydrate(
 	torrentPort int,
 	port int,
@@ -148,6 +318,18 @@ func (m *Settings) Hydrate(
 	apiSearchConfig []byte,
 	qualities []string,
 	uploadRate int,
+	safety safety.Rules,
+	fallbackTrackers []string,
+	downloadRate int,
+	bandwidth Bandwidth,
+	seedingPolicy seeding.Policy,
+	blocklists []string,
+	proxyConfig proxy.Config,
+	bindInterface string,
+	stallConfig stall.Config,
+	autoPlay bool,
+	subtitleSources SubtitleSources,
+	subtitlePrefs subrank.Preferences,
 	OpenSubtitles OpenSubtitles,
 ) {
 	m.torrentPort = torrentPort
@@ -160,7 +342,27 @@ func (m *Settings) Hydrate(
 	m.languages = languages
 	m.qualities = qualities
 	m.uploadRate = uploadRate
+	m.safety = safety
+	m.fallbackTrackers = fallbackTrackers
+	m.downloadRate = downloadRate
+	m.bandwidth = bandwidth
+	m.seedingPolicy = seedingPolicy
+	m.blocklists = blocklists
+	m.proxy = proxyConfig
+	m.bindInterface = bindInterface
+	m.stall = stallConfig
+	m.autoPlay = autoPlay
+	m.subtitleSources = subtitleSources
+	m.subtitlePrefs = subtitlePrefs
 	m.OpenSubtitles = OpenSubtitles
 }
 
 var qualities = []string{"720p", "1080p", "1440p", "2160p"}
+
+var fallbackTrackers = []string{
+	"udp://tracker.opentrackr.org:1337/announce",
+	"udp://open.stealth.si:80/announce",
+	"udp://tracker.torrent.eu.org:451/announce",
+	"udp://exodus.desync.com:6969/announce",
+	"udp://open.demonii.com:1337/announce",
+}
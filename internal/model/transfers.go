@@ -0,0 +1,29 @@
+package model
+
+import "maps"
+
+// TransferTotals are the bytes transferred over the lifetime of a torrent, or of all of them
+type TransferTotals struct {
+	Downloaded int64 `json:"downloaded"`
+	Uploaded   int64 `json:"uploaded"`
+}
+
+func (t TransferTotals) Add(downloaded, uploaded int64) TransferTotals {
+	t.Downloaded += downloaded
+	t.Uploaded += uploaded
+	return t
+}
+
+// Transfers holds the lifetime totals of every torrent, by info hash, and of all of them together.
+// The total of all torrents is kept even if the torrents are removed.
+type Transfers struct {
+	All      TransferTotals            `json:"all"`
+	Torrents map[string]TransferTotals `json:"torrents"`
+}
+
+func (t *Transfers) Clone() *Transfers {
+	return &Transfers{
+		All:      t.All,
+		Torrents: maps.Clone(t.Torrents),
+	}
+}
@@ -43,16 +43,27 @@ func buildCache(vm *viewmodel.App) fyne.CanvasObject {
 		},
 		func() fyne.CanvasObject {
 			item := components.NewMagnetListItem()
+			watched := widget.NewLabel("")
+			watched.SizeName = theme.SizeNameCaptionText
+			watched.Truncation = fyne.TextTruncateEllipsis
 			delete := widget.NewButtonWithIcon("", theme.DeleteIcon(), nil)
 			delete.Importance = widget.DangerImportance
-			hb := container.NewBorder(nil, nil, nil, delete, item)
+			hb := container.NewBorder(nil, nil, nil, delete, container.NewVBox(item, watched))
 			return hb
 		},
 		func(i widget.ListItemID, o fyne.CanvasObject) {
 			r := data[i]
 			hb := o.(*fyne.Container)
 			delete := hb.Objects[1].(*widget.Button)
-			item := hb.Objects[0].(*components.MagnetListItem)
+			details := hb.Objects[0].(*fyne.Container)
+			item := details.Objects[0].(*components.MagnetListItem)
+			watched := details.Objects[1].(*widget.Label)
+			if w := vm.Cache.Watched(r); w != "" {
+				watched.SetText("Watched: " + w)
+				watched.Show()
+			} else {
+				watched.Hide()
+			}
 			delete.OnTapped = func() {
 				vm.Cache.Delete(i)
 			}
@@ -3,6 +3,7 @@ package view
 import (
 	"fmt"
 	"image/color"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
@@ -12,6 +13,7 @@ import (
 	"github.com/quintans/torflix/internal/app"
 	"github.com/quintans/torflix/internal/components"
 	"github.com/quintans/torflix/internal/lib/humanize"
+	"github.com/quintans/torflix/internal/lib/transfer"
 	"github.com/quintans/torflix/internal/viewmodel"
 )
 
@@ -21,6 +23,11 @@ func Download(vm *viewmodel.Download) (fyne.CanvasObject, func(bool)) {
 	downloadSpeed := widget.NewLabel("")
 	uploadSpeed := widget.NewLabel("")
 	seeders := widget.NewLabel("")
+	limits := widget.NewLabel(vm.Limits())
+	seedingStatus := widget.NewLabel(vm.SeedingStatus())
+	totals := widget.NewLabel(vm.TransferTotals())
+	blocked := widget.NewLabel("0")
+	recovery := widget.NewLabel(vm.Recovery())
 
 	back := widget.NewButton("BACK", func() {
 		vm.Back()
@@ -36,6 +43,14 @@ func Download(vm *viewmodel.Download) (fyne.CanvasObject, func(bool)) {
 	}
 	play.Importance = widget.HighImportance
 
+	var recheck *widget.Button
+	recheck = widget.NewButton("RECHECK", func() {
+		recheck.Disable()
+		vm.Recheck(func() {
+			fyne.Do(recheck.Enable)
+		})
+	})
+
 	widgets := []fyne.CanvasObject{}
 	name := canvas.NewText("Name", color.White)
 	name.Alignment = fyne.TextAlignTrailing
@@ -64,11 +79,67 @@ func Download(vm *viewmodel.Download) (fyne.CanvasObject, func(bool)) {
 	seedersTxt.Alignment = fyne.TextAlignTrailing
 	widgets = append(widgets, seedersTxt, seeders)
 
+	blockedTxt := canvas.NewText("Unique blocked peers", color.White)
+	blockedTxt.Alignment = fyne.TextAlignTrailing
+	widgets = append(widgets, blockedTxt, blocked)
+
+	turbo := widget.NewCheck("Turbo", func(b bool) {
+		vm.SetTurbo(b)
+		limits.SetText(vm.Limits())
+	})
+	turbo.Checked = vm.Turbo()
+	limitsTxt := canvas.NewText("Limits", color.White)
+	limitsTxt.Alignment = fyne.TextAlignTrailing
+	widgets = append(widgets, limitsTxt, container.NewHBox(limits, turbo))
+
+	seedingTxt := canvas.NewText("Seeding", color.White)
+	seedingTxt.Alignment = fyne.TextAlignTrailing
+	widgets = append(widgets, seedingTxt, seedingStatus)
+
+	totalsTxt := canvas.NewText("Transferred", color.White)
+	totalsTxt.Alignment = fyne.TextAlignTrailing
+	widgets = append(widgets, totalsTxt, totals)
+
+	switchSource := widget.NewButton("SWITCH", nil)
+	switchSource.OnTapped = func() {
+		switchSource.Disable()
+		go vm.SwitchSource()
+	}
+	switchSource.Hide()
+	recoveryTxt := canvas.NewText("Recovery", color.White)
+	recoveryTxt.Alignment = fyne.TextAlignTrailing
+	widgets = append(widgets, recoveryTxt, container.NewHBox(recovery, switchSource))
+
 	streamTxt := canvas.NewText("Stream", color.White)
 	streamTxt.Alignment = fyne.TextAlignTrailing
 	widgets = append(widgets, streamTxt, stream)
 
+	// the player can only be controlled if it is mpv
+	playback := widget.NewLabel("")
+	playbackControls := container.NewHBox(
+		widget.NewButton("-10s", func() { go vm.Seek(-10 * time.Second) }),
+		widget.NewButton("PAUSE / RESUME", func() { go vm.TogglePause() }),
+		widget.NewButton("+30s", func() { go vm.Seek(30 * time.Second) }),
+	)
+	playbackRow := container.NewHBox(playback, playbackControls)
+	playbackTxt := canvas.NewText("Player", color.White)
+	playbackTxt.Alignment = fyne.TextAlignTrailing
+	widgets = append(widgets, playbackTxt, playbackRow)
+	refreshPlayback := func() {
+		desc, ok := vm.Playback()
+		if ok {
+			playback.SetText(desc)
+			playbackControls.Show()
+		} else {
+			playback.SetText("Not controlled")
+			playbackControls.Hide()
+		}
+	}
+	refreshPlayback()
+
 	tracker := components.NewPieceTracker(nil)
+	speedGraph := components.NewSpeedGraph(transfer.HistorySize)
+	peersTable, setPeers := downloadPeersTable()
 
 	onStats := func(stats app.Stats) {
 		fyne.DoAndWait(func() {
@@ -92,25 +163,79 @@ func Download(vm *viewmodel.Download) (fyne.CanvasObject, func(bool)) {
 			}
 			uploadSpeed.SetText(humanize.Bytes(uint64(stats.UploadSpeed), 1) + "/s")
 			seeders.SetText(fmt.Sprintf("%d", stats.Seeders))
+			// the schedule may have changed the limits
+			limits.SetText(vm.Limits())
+			seedingStatus.SetText(vm.SeedingStatus())
+			totals.SetText(vm.TransferTotals())
+			recovery.SetText(vm.Recovery())
+			if vm.Suggestion() != "" {
+				switchSource.Show()
+			} else {
+				switchSource.Hide()
+			}
 
+			peers, blockedPeers := vm.Peers()
+			setPeers(peers)
+			blocked.SetText(fmt.Sprintf("%d", blockedPeers))
+
+			refreshPlayback()
 			tracker.SetPieces(stats.Pieces)
+			speedGraph.SetSamples(vm.SpeedHistory())
 		})
 	}
 
+	autoPlay := widget.NewCheck("Play when ready", vm.SetAutoPlay)
+	autoPlay.Checked = vm.AutoPlay()
+
 	go func() {
-		if vm.Serve(onStats) {
+		if !vm.Serve(onStats) {
+			return
+		}
+		if autoPlay.Checked {
 			vm.Play(func() {
 				fyne.DoAndWait(play.Enable)
 			})
+			return
 		}
+		fyne.Do(play.Enable)
 	}()
 
+	policy, own := vm.SeedingPolicy()
+	policyForm, readPolicy := seedingPolicyForm(policy)
+	ownPolicy := widget.NewCheck("Use its own policy instead of the global one", nil)
+	ownPolicy.Checked = own
+	savePolicy := widget.NewButton("SAVE", func() {
+		if ownPolicy.Checked {
+			vm.SetSeedingPolicy(readPolicy())
+		} else {
+			vm.ResetSeedingPolicy()
+		}
+		seedingStatus.SetText(vm.SeedingStatus())
+	})
+	accordion := widget.NewAccordion(
+		widget.NewAccordionItem("Peers", components.NewMinSizeWrapper(peersTable, fyne.NewSize(0, 200))),
+		widget.NewAccordionItem("Subtitles", downloadSubtitlesPanel(vm)),
+		widget.NewAccordionItem(
+			"Seeding policy of this torrent",
+			container.NewVBox(
+				ownPolicy,
+				container.NewHBox(policyForm, layout.NewSpacer()),
+				container.NewHBox(savePolicy, layout.NewSpacer()),
+			),
+		),
+	)
+
 	content := container.NewVBox(
 		container.New(layout.NewFormLayout(), widgets...),
 		tracker,
+		speedGraph,
+		accordion,
 		container.NewHBox(
 			layout.NewSpacer(),
 			play,
+			autoPlay,
+			layout.NewSpacer(),
+			recheck,
 			layout.NewSpacer(),
 			back,
 			layout.NewSpacer(),
@@ -121,3 +246,66 @@ func Download(vm *viewmodel.Download) (fyne.CanvasObject, func(bool)) {
 	// going back the viewmodel will be GC
 	return content, nil
 }
+
+var peerColumns = []struct {
+	title string
+	width float32
+}{
+	{"Address", 200},
+	{"Client", 150},
+	{"Flags", 60},
+	{"Progress", 80},
+	{"Down", 90},
+	{"Up", 90},
+	{"Connection", 100},
+}
+
+// downloadPeersTable builds the table of the connected peers and the function to update it
+func downloadPeersTable() (*widget.Table, func([]app.PeerInfo)) {
+	var peers []app.PeerInfo
+	table := widget.NewTableWithHeaders(
+		func() (int, int) {
+			return len(peers), len(peerColumns)
+		},
+		func() fyne.CanvasObject {
+			l := widget.NewLabel("")
+			l.Truncation = fyne.TextTruncateEllipsis
+			return l
+		},
+		func(id widget.TableCellID, o fyne.CanvasObject) {
+			p := peers[id.Row]
+			var text string
+			switch id.Col {
+			case 0:
+				text = p.Address
+			case 1:
+				text = p.Client
+			case 2:
+				text = p.Flags
+			case 3:
+				text = fmt.Sprintf("%.0f%%", p.Progress)
+			case 4:
+				text = humanize.Bytes(uint64(p.DownloadRate), 1) + "/s"
+			case 5:
+				text = humanize.Bytes(uint64(p.UploadRate), 1) + "/s"
+			case 6:
+				text = p.Connection
+			}
+			o.(*widget.Label).SetText(text)
+		},
+	)
+	table.ShowHeaderColumn = false
+	table.UpdateHeader = func(id widget.TableCellID, o fyne.CanvasObject) {
+		if id.Col >= 0 {
+			o.(*widget.Label).SetText(peerColumns[id.Col].title)
+		}
+	}
+	for i, c := range peerColumns {
+		table.SetColumnWidth(i, c.width)
+	}
+
+	return table, func(p []app.PeerInfo) {
+		peers = p
+		table.Refresh()
+	}
+}
@@ -1,15 +1,25 @@
 package view
 
 import (
+	"fmt"
+	"time"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"github.com/quintans/torflix/internal/app"
 	"github.com/quintans/torflix/internal/lib/humanize"
+	"github.com/quintans/torflix/internal/lib/slices"
 	"github.com/quintans/torflix/internal/viewmodel"
 )
 
 func DownloadList(vm *viewmodel.DownloadList) (fyne.CanvasObject, func(bool)) {
+	priorities := slices.Map(app.FilePriorities, func(p app.FilePriority) string {
+		return string(p)
+	})
+
 	var fileItems []*viewmodel.FileItem
 	result := widget.NewList(
 		func() int {
@@ -18,23 +28,54 @@ func DownloadList(vm *viewmodel.DownloadList) (fyne.CanvasObject, func(bool)) {
 		func() fyne.CanvasObject {
 			nameLbl := widget.NewLabel("")
 			nameLbl.Alignment = fyne.TextAlignLeading
+			nameLbl.Truncation = fyne.TextTruncateEllipsis
+			mediaLbl := widget.NewLabel("")
+			mediaLbl.Truncation = fyne.TextTruncateEllipsis
+			mediaLbl.SizeName = theme.SizeNameCaptionText
 			sizeLbl := widget.NewLabel("")
 			sizeLbl.Alignment = fyne.TextAlignTrailing
-			return container.NewBorder(nil, nil, nil, sizeLbl, nameLbl)
+			wanted := widget.NewCheck("", nil)
+			priority := widget.NewSelect(priorities, nil)
+			return container.NewBorder(nil, nil, container.NewHBox(wanted, priority), sizeLbl, container.NewVBox(nameLbl, mediaLbl))
 		},
 		func(i widget.ListItemID, o fyne.CanvasObject) {
+			item := fileItems[i]
 			it := o.(*fyne.Container)
-			name := it.Objects[0].(*widget.Label)
-			name.SetText(fileItems[i].File.DisplayPath())
-			size := it.Objects[1].(*widget.Label)
-			size.SetText(humanize.Bytes(uint64(fileItems[i].File.Length()), 1))
-			if fileItems[i].Selected {
+			labels := it.Objects[0].(*fyne.Container)
+			name := labels.Objects[0].(*widget.Label)
+			name.SetText(item.File.DisplayPath())
+			details := vm.Media(item)
+			if subs := vm.Subtitles(item); subs != "" {
+				if details != "" {
+					details += " · "
+				}
+				details += subs
+			}
+			labels.Objects[1].(*widget.Label).SetText(details)
+			size := it.Objects[2].(*widget.Label)
+			size.SetText(fmt.Sprintf("%.0f%% of %s", vm.Progress(item), humanize.Bytes(uint64(item.File.Length()), 1)))
+			if item.Selected {
 				name.Importance = widget.HighImportance
 				size.Importance = widget.HighImportance
 			} else {
 				name.Importance = widget.MediumImportance
 				size.Importance = widget.MediumImportance
 			}
+
+			controls := it.Objects[1].(*fyne.Container)
+			wanted := controls.Objects[0].(*widget.Check)
+			priority := controls.Objects[1].(*widget.Select)
+			// unset the handlers so that refreshing the values does not trigger them
+			wanted.OnChanged = nil
+			priority.OnChanged = nil
+			wanted.SetChecked(item.Priority != app.FilePrioritySkip)
+			priority.SetSelected(string(item.Priority))
+			wanted.OnChanged = func(b bool) {
+				vm.Want(item, b)
+			}
+			priority.OnChanged = func(s string) {
+				vm.SetPriority(item, app.FilePriority(s))
+			}
 		},
 	)
 	result.OnSelected = func(id widget.ListItemID) {
@@ -46,6 +87,21 @@ func DownloadList(vm *viewmodel.DownloadList) (fyne.CanvasObject, func(bool)) {
 		result.Refresh()
 	})
 
+	// wanted files keep downloading in the background, so we refresh their progress
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(2 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				fyne.Do(result.Refresh)
+			}
+		}
+	}()
+
 	return container.NewBorder(
 			nil,
 			container.NewHBox(layout.NewSpacer(), widget.NewButton("BACK", func() {
@@ -55,6 +111,7 @@ func DownloadList(vm *viewmodel.DownloadList) (fyne.CanvasObject, func(bool)) {
 			nil,
 			result,
 		), func(bool) {
+			close(done)
 			vm.Unmount()
 		}
 }
@@ -0,0 +1,116 @@
+package view
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/quintans/torflix/internal/lib/humanize"
+	"github.com/quintans/torflix/internal/lib/safety"
+	"github.com/quintans/torflix/internal/viewmodel"
+)
+
+func Preview(vm *viewmodel.Preview) (fyne.CanvasObject, func(bool)) {
+	info := vm.Info()
+
+	widgets := []fyne.CanvasObject{}
+	addRow := func(name, value string) {
+		txt := canvas.NewText(name, color.White)
+		txt.Alignment = fyne.TextAlignTrailing
+		lbl := widget.NewLabel(value)
+		lbl.Wrapping = fyne.TextWrapWord
+		widgets = append(widgets, txt, lbl)
+	}
+
+	addRow("Name", info.Name)
+	addRow("Hash", info.InfoHash)
+	addRow("Size", humanize.Bytes(uint64(info.Size), 1))
+	addRow("Pieces", fmt.Sprintf("%d x %s", info.NumPieces, humanize.Bytes(uint64(info.PieceLength), 1)))
+	if !info.CreationDate.IsZero() {
+		addRow("Created", info.CreationDate.Format("2006-01-02 15:04"))
+	}
+	if info.CreatedBy != "" {
+		addRow("Created by", info.CreatedBy)
+	}
+	if info.Comment != "" {
+		addRow("Comment", info.Comment)
+	}
+	addRow("Private", fmt.Sprintf("%t", info.Private))
+	addRow("Trackers", fmt.Sprintf("%d", len(info.Trackers)))
+
+	details := container.NewVBox(container.New(layout.NewFormLayout(), widgets...))
+
+	report := vm.Safety()
+	for _, f := range report.Findings {
+		lbl := widget.NewLabelWithStyle(f.Message, fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+		icon := theme.WarningIcon()
+		lbl.Importance = widget.WarningImportance
+		if f.Level == safety.LevelBlock {
+			icon = theme.ErrorIcon()
+			lbl.Importance = widget.DangerImportance
+		}
+		details.Add(container.NewHBox(widget.NewIcon(icon), lbl))
+	}
+
+	if len(info.Trackers) > 0 {
+		trackers := widget.NewLabel(strings.Join(info.Trackers, "\n"))
+		details.Add(widget.NewAccordion(widget.NewAccordionItem("Trackers", trackers)))
+	}
+
+	tree := widget.NewTree(
+		func(id widget.TreeNodeID) []widget.TreeNodeID {
+			return vm.Tree[id]
+		},
+		func(id widget.TreeNodeID) bool {
+			return id == "" || vm.Nodes[id].Dir
+		},
+		func(branch bool) fyne.CanvasObject {
+			nameLbl := widget.NewLabel("")
+			sizeLbl := widget.NewLabel("")
+			sizeLbl.Alignment = fyne.TextAlignTrailing
+			return container.NewBorder(nil, nil, nil, sizeLbl, nameLbl)
+		},
+		func(id widget.TreeNodeID, branch bool, o fyne.CanvasObject) {
+			node := vm.Nodes[id]
+			it := o.(*fyne.Container)
+			it.Objects[0].(*widget.Label).SetText(node.Name)
+			it.Objects[1].(*widget.Label).SetText(humanize.Bytes(uint64(node.Size), 1))
+		},
+	)
+	tree.OpenAllBranches()
+
+	stream := widget.NewButton("STREAM", func() {
+		vm.Stream()
+	})
+	stream.Importance = widget.HighImportance
+	switch {
+	case vm.Blocked():
+		stream.Disable()
+	case report.Level == safety.LevelWarn:
+		stream.Importance = widget.WarningImportance
+	}
+
+	back := widget.NewButton("BACK", func() {
+		vm.Back()
+	})
+
+	return container.NewBorder(
+		details,
+		container.NewHBox(
+			layout.NewSpacer(),
+			stream,
+			layout.NewSpacer(),
+			back,
+			layout.NewSpacer(),
+		),
+		nil,
+		nil,
+		tree,
+	), nil
+}
@@ -2,13 +2,16 @@ package view
 
 import (
 	"strconv"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 	"github.com/quintans/torflix/internal/components"
 	"github.com/quintans/torflix/internal/gateways/opensubtitles"
 	"github.com/quintans/torflix/internal/lib/humanize"
+	"github.com/quintans/torflix/internal/lib/safety"
 	"github.com/quintans/torflix/internal/model"
 	"github.com/quintans/torflix/internal/viewmodel"
 )
@@ -83,15 +86,20 @@ func buildSearch(vm *viewmodel.App) fyne.CanvasObject {
 	}
 
 	data := vm.Search.Results
-	result := widget.NewList(
+	var result *widget.List
+	result = widget.NewList(
 		func() int {
 			return len(data)
 		},
 		func() fyne.CanvasObject {
-			return components.NewMagnetListItem()
+			item := components.NewMagnetListItem()
+			refresh := widget.NewButtonWithIcon("", theme.ViewRefreshIcon(), nil)
+			return container.NewBorder(nil, nil, nil, refresh, item)
 		},
 		func(i widget.ListItemID, o fyne.CanvasObject) {
 			r := data[i]
+			hb := o.(*fyne.Container)
+			refresh := hb.Objects[1].(*widget.Button)
 
 			var cached bool
 			for _, c := range vm.Cache.Results.Get() {
@@ -100,7 +108,7 @@ func buildSearch(vm *viewmodel.App) fyne.CanvasObject {
 					break
 				}
 			}
-			o.(*components.MagnetListItem).SetData(&components.MagnetItem{
+			item := &components.MagnetItem{
 				Provider: r.Provider,
 				Name:     r.Name,
 				Size:     r.Size,
@@ -108,7 +116,27 @@ func buildSearch(vm *viewmodel.App) fyne.CanvasObject {
 				Magnet:   r.Magnet,
 				Cached:   cached,
 				Quality:  r.QualityName,
-			})
+				Fake:     r.FakeSeeds,
+			}
+			if r.Scraped {
+				item.Peers = strconv.Itoa(r.Leechers)
+			}
+			if r.Safety.Level != safety.LevelNone {
+				item.Safety = strings.ToUpper(r.Safety.Level.String())
+				item.SafetyBlock = r.Safety.Level == safety.LevelBlock
+			}
+			hb.Objects[0].(*components.MagnetListItem).SetData(item)
+			refresh.Enable()
+			refresh.OnTapped = func() {
+				refresh.Disable()
+				go func() {
+					vm.Search.Scrape(r)
+					fyne.Do(func() {
+						refresh.Enable()
+						result.RefreshItem(i)
+					})
+				}()
+			}
 		},
 	)
 	result.OnSelected = func(id widget.ListItemID) {
@@ -0,0 +1,43 @@
+package view
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+	"github.com/quintans/torflix/internal/components"
+	"github.com/quintans/torflix/internal/lib/seeding"
+)
+
+// seedingPolicyForm builds the entries of a seeding policy and a function to read them back
+func seedingPolicyForm(policy seeding.Policy) (*widget.Form, func() seeding.Policy) {
+	ratio := components.NewNumericalEntry()
+	ratio.SetText(fmt.Sprintf("%g", policy.Ratio))
+	seedingTime := components.NewNumericalEntry()
+	seedingTime.SetText(strconv.Itoa(policy.SeedingMinutes))
+	idle := components.NewNumericalEntry()
+	idle.SetText(strconv.Itoa(policy.IdleMinutes))
+
+	size := fyne.NewSize(120, 40)
+	form := widget.NewForm(
+		widget.NewFormItem("Ratio", components.NewMinSizeWrapper(ratio, size)),
+		widget.NewFormItem("Seeding minutes", components.NewMinSizeWrapper(seedingTime, size)),
+		widget.NewFormItem("Idle minutes", components.NewMinSizeWrapper(idle, size)),
+	)
+
+	return form, func() seeding.Policy {
+		return seeding.Policy{
+			Ratio:          parseNumber(ratio.Text),
+			SeedingMinutes: int(parseNumber(seedingTime.Text)),
+			IdleMinutes:    int(parseNumber(idle.Text)),
+		}
+	}
+}
+
+// parseNumber parses the text of a numerical entry, returning zero if it is not a number
+func parseNumber(s string) float64 {
+	f, _ := strconv.ParseFloat(strings.ReplaceAll(s, ",", "."), 64)
+	return f
+}
@@ -0,0 +1,214 @@
+package view
+
+import (
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/quintans/torflix/internal/app"
+	"github.com/quintans/torflix/internal/components"
+	"github.com/quintans/torflix/internal/viewmodel"
+)
+
+// downloadSubtitlesPanel builds the panel to search, preview, download and delete the subtitles of the file
+func downloadSubtitlesPanel(vm *viewmodel.Download) fyne.CanvasObject {
+	query, season, episode, languages := vm.SubtitleQuery()
+	queryEntry := widget.NewEntry()
+	queryEntry.SetText(query)
+	seasonEntry := components.NewNumericalEntry()
+	seasonEntry.SetText(strconv.Itoa(season))
+	episodeEntry := components.NewNumericalEntry()
+	episodeEntry.SetText(strconv.Itoa(episode))
+	languagesEntry := widget.NewEntry()
+	languagesEntry.SetPlaceHolder("en, pt-BR")
+	languagesEntry.SetText(strings.Join(languages, ", "))
+
+	var candidates []app.Subtitle
+	var selected *app.Subtitle
+	preview := widget.NewLabel("")
+	preview.Wrapping = fyne.TextWrapWord
+
+	candidatesList := widget.NewList(
+		func() int {
+			return len(candidates)
+		},
+		func() fyne.CanvasObject {
+			name := widget.NewLabel("")
+			name.Truncation = fyne.TextTruncateEllipsis
+			details := widget.NewLabel("")
+			details.SizeName = theme.SizeNameCaptionText
+			return container.NewVBox(name, details)
+		},
+		func(id widget.ListItemID, o fyne.CanvasObject) {
+			box := o.(*fyne.Container)
+			box.Objects[0].(*widget.Label).SetText(candidates[id].Filename)
+			box.Objects[1].(*widget.Label).SetText(viewmodel.SubtitleDetails(candidates[id]))
+		},
+	)
+
+	download := widget.NewButton("DOWNLOAD", nil)
+	download.Disable()
+
+	var files []string
+	var selectedFile string
+	filesList := widget.NewList(
+		func() int {
+			return len(files)
+		},
+		func() fyne.CanvasObject {
+			l := widget.NewLabel("")
+			l.Truncation = fyne.TextTruncateEllipsis
+			return l
+		},
+		func(id widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(files[id])
+		},
+	)
+	remove := widget.NewButton("DELETE", nil)
+	remove.Disable()
+	// the offset may be negative, to show the subtitles earlier
+	offsetEntry := widget.NewEntry()
+	offsetEntry.SetPlaceHolder("-1.5")
+	fromFPSEntry := components.NewNumericalEntry()
+	fromFPSEntry.SetPlaceHolder("25")
+	toFPSEntry := components.NewNumericalEntry()
+	toFPSEntry.SetPlaceHolder("23.976")
+	correct := widget.NewButton("CORRECT", nil)
+	correct.Disable()
+	refreshFiles := func() {
+		files = vm.Subtitles()
+		selectedFile = ""
+		filesList.UnselectAll()
+		filesList.Refresh()
+		remove.Disable()
+		correct.Disable()
+	}
+	refreshFiles()
+
+	filesList.OnSelected = func(id widget.ListItemID) {
+		selectedFile = files[id]
+		remove.Enable()
+		correct.Enable()
+	}
+	correct.OnTapped = func() {
+		if selectedFile == "" {
+			return
+		}
+		name := selectedFile
+		offset := parseNumber(offsetEntry.Text)
+		from := parseNumber(fromFPSEntry.Text)
+		to := parseNumber(toFPSEntry.Text)
+		correct.Disable()
+		go func() {
+			ok := vm.CorrectSubtitle(name, offset, from, to)
+			fyne.Do(func() {
+				correct.Enable()
+				if ok {
+					offsetEntry.SetText("")
+				}
+			})
+		}()
+	}
+	remove.OnTapped = func() {
+		if selectedFile == "" {
+			return
+		}
+		vm.DeleteSubtitle(selectedFile)
+		refreshFiles()
+	}
+
+	candidatesList.OnSelected = func(id widget.ListItemID) {
+		sub := candidates[id]
+		selected = &sub
+		download.Enable()
+		preview.SetText("Loading preview...")
+		go func() {
+			text := vm.PreviewSubtitle(sub)
+			fyne.Do(func() {
+				// another subtitle may have been selected meanwhile
+				if selected != nil && *selected == sub {
+					preview.SetText(text)
+				}
+			})
+		}()
+	}
+	download.OnTapped = func() {
+		if selected == nil {
+			return
+		}
+		sub := *selected
+		download.Disable()
+		go func() {
+			ok := vm.DownloadSubtitle(sub)
+			fyne.Do(func() {
+				download.Enable()
+				if ok {
+					refreshFiles()
+				}
+			})
+		}()
+	}
+
+	var search *widget.Button
+	search = widget.NewButton("SEARCH", func() {
+		search.Disable()
+		var langs []string
+		for _, l := range strings.Split(languagesEntry.Text, ",") {
+			if l = strings.TrimSpace(l); l != "" {
+				langs = append(langs, l)
+			}
+		}
+		q := strings.TrimSpace(queryEntry.Text)
+		s := int(parseNumber(seasonEntry.Text))
+		e := int(parseNumber(episodeEntry.Text))
+		go func() {
+			found := vm.SearchSubtitles(q, s, e, langs)
+			fyne.Do(func() {
+				search.Enable()
+				candidates = found
+				selected = nil
+				candidatesList.UnselectAll()
+				candidatesList.Refresh()
+				download.Disable()
+				preview.SetText("")
+			})
+		}()
+	})
+	search.Importance = widget.HighImportance
+
+	form := container.NewHBox(
+		widget.NewForm(
+			widget.NewFormItem("Query", components.NewMinSizeWrapper(queryEntry, fyne.NewSize(300, 40))),
+			widget.NewFormItem("Languages", components.NewMinSizeWrapper(languagesEntry, fyne.NewSize(300, 40))),
+		),
+		widget.NewForm(
+			widget.NewFormItem("Season", components.NewMinSizeWrapper(seasonEntry, fyne.NewSize(60, 40))),
+			widget.NewFormItem("Episode", components.NewMinSizeWrapper(episodeEntry, fyne.NewSize(60, 40))),
+		),
+		layout.NewSpacer(),
+	)
+
+	return container.NewVBox(
+		form,
+		container.NewHBox(search, layout.NewSpacer()),
+		container.NewGridWithColumns(2,
+			components.NewMinSizeWrapper(candidatesList, fyne.NewSize(0, 250)),
+			container.NewVScroll(preview),
+		),
+		container.NewHBox(download, layout.NewSpacer()),
+		widget.NewLabel("Subtitles of this file"),
+		components.NewMinSizeWrapper(filesList, fyne.NewSize(0, 120)),
+		container.NewHBox(
+			remove,
+			layout.NewSpacer(),
+			widget.NewForm(widget.NewFormItem("Offset (s)", components.NewMinSizeWrapper(offsetEntry, fyne.NewSize(80, 40)))),
+			widget.NewForm(widget.NewFormItem("FPS from", components.NewMinSizeWrapper(fromFPSEntry, fyne.NewSize(80, 40)))),
+			widget.NewForm(widget.NewFormItem("to", components.NewMinSizeWrapper(toFPSEntry, fyne.NewSize(80, 40)))),
+			correct,
+		),
+	)
+}
@@ -1,14 +1,23 @@
 package viewmodel
 
 import (
+	"context"
+
 	"github.com/quintans/torflix/internal/app"
 	"github.com/quintans/torflix/internal/lib/bind"
+	"github.com/quintans/torflix/internal/lib/proxy"
+	"github.com/quintans/torflix/internal/lib/seeding"
+	"github.com/quintans/torflix/internal/lib/subrank"
 	"github.com/quintans/torflix/internal/model"
 )
 
 type AppService interface {
 	LoadData() (model.AppData, error)
 	SetOpenSubtitles(username, password string) error
+	Proxy() (proxy.Config, error)
+	SetProxy(cfg proxy.Config) error
+	BindInterface() (string, error)
+	SetBindInterface(bind string) error
 }
 
 type App struct {
@@ -16,6 +25,8 @@ type App struct {
 	searchService   SearchService
 	cacheService    CacheService
 	downloadService DownloadService
+	bandwidth       BandwidthService
+	seeding         SeedingService
 	appService      AppService
 	SelectedTab     int
 	OSUsername      bind.Setter[string]
@@ -29,6 +40,8 @@ func NewApp(shared *Shared,
 	searchService SearchService,
 	cacheService CacheService,
 	downloadService DownloadService,
+	bandwidthService BandwidthService,
+	seedingService SeedingService,
 	cacheDir string,
 	params app.AppParams,
 ) *App {
@@ -38,6 +51,8 @@ func NewApp(shared *Shared,
 		searchService:   searchService,
 		cacheService:    cacheService,
 		downloadService: downloadService,
+		bandwidth:       bandwidthService,
+		seeding:         seedingService,
 		Cache:           NewCache(shared, cacheDir, cacheService, downloadService),
 		Search:          NewSearch(shared, searchService, downloadService, params),
 	}
@@ -75,3 +90,138 @@ func (a *App) SetOpenSubtitles(username, password string) {
 	a.OSUsername.Set(username)
 	a.OSPassword.Set(password)
 }
+
+// Rates returns the download and upload limits in KiB/s
+func (a *App) Rates() (int, int) {
+	down, up, err := a.bandwidth.Rates()
+	if err != nil {
+		a.shared.Error(err, "Failed to load bandwidth limits")
+		return 0, 0
+	}
+	return down / 1024, up / 1024
+}
+
+// SetRates changes the download and upload limits, in KiB/s, applying them to the running torrent
+func (a *App) SetRates(download, upload int) {
+	err := a.bandwidth.SetRates(download*1024, upload*1024)
+	if err != nil {
+		a.shared.Error(err, "Failed to set bandwidth limits")
+		return
+	}
+
+	a.shared.Success("Bandwidth limits saved")
+}
+
+func (a *App) Turbo() bool {
+	return a.bandwidth.Turbo()
+}
+
+func (a *App) SetTurbo(turbo bool) {
+	err := a.bandwidth.SetTurbo(turbo)
+	if err != nil {
+		a.shared.Error(err, "Failed to change bandwidth limits")
+	}
+}
+
+func (a *App) SeedingPolicy() seeding.Policy {
+	policy, err := a.seeding.GlobalPolicy()
+	if err != nil {
+		a.shared.Error(err, "Failed to load seeding policy")
+	}
+	return policy
+}
+
+func (a *App) SetSeedingPolicy(policy seeding.Policy) {
+	err := a.seeding.SetGlobalPolicy(policy)
+	if err != nil {
+		a.shared.Error(err, "Failed to set seeding policy")
+		return
+	}
+
+	a.shared.Success("Seeding policy saved")
+}
+
+func (a *App) Proxy() proxy.Config {
+	cfg, err := a.appService.Proxy()
+	if err != nil {
+		a.shared.Error(err, "Failed to load proxy")
+	}
+	return cfg
+}
+
+func (a *App) SetProxy(cfg proxy.Config) {
+	err := a.appService.SetProxy(cfg)
+	if err != nil {
+		a.shared.Error(err, "Failed to set proxy")
+		return
+	}
+
+	a.shared.Success("Proxy saved. It applies to the next torrent.")
+}
+
+func (a *App) BindInterface() string {
+	bind, err := a.appService.BindInterface()
+	if err != nil {
+		a.shared.Error(err, "Failed to load network interface")
+	}
+	return bind
+}
+
+func (a *App) SetBindInterface(bind string) {
+	err := a.appService.SetBindInterface(bind)
+	if err != nil {
+		a.shared.Error(err, "Failed to set network interface")
+		return
+	}
+
+	a.shared.Success("Network interface saved. It applies to the next torrent.")
+}
+
+// SubtitleProviders returns the names of the subtitle providers
+func (a *App) SubtitleProviders() []string {
+	return a.downloadService.SubtitleProviders()
+}
+
+func (a *App) SubtitleSources() model.SubtitleSources {
+	sources, err := a.downloadService.SubtitleSources()
+	if err != nil {
+		a.shared.Error(err, "Failed to load subtitle providers")
+	}
+	return sources
+}
+
+func (a *App) SetSubtitleSources(sources model.SubtitleSources) {
+	err := a.downloadService.SetSubtitleSources(sources)
+	if err != nil {
+		a.shared.Error(err, "Failed to set subtitle providers")
+		return
+	}
+
+	a.shared.Success("Subtitle providers saved")
+}
+
+func (a *App) SubtitlePreferences() subrank.Preferences {
+	prefs, err := a.downloadService.SubtitlePreferences()
+	if err != nil {
+		a.shared.Error(err, "Failed to load subtitle preferences")
+	}
+	return prefs
+}
+
+func (a *App) SetSubtitlePreferences(prefs subrank.Preferences) {
+	err := a.downloadService.SetSubtitlePreferences(prefs)
+	if err != nil {
+		a.shared.Error(err, "Failed to set subtitle preferences")
+	}
+}
+
+// SubtitleQuota describes the daily download quota of the provider.
+// With refresh the provider is asked for it, logging in if needed.
+func (a *App) SubtitleQuota(provider string, refresh bool) string {
+	quotas, err := a.downloadService.SubtitleQuotas(context.Background(), refresh)
+	if err != nil {
+		a.shared.Error(err, "Failed to get subtitle download quota")
+		return ""
+	}
+	return QuotaDescription(quotas[provider])
+}
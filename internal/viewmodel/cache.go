@@ -1,6 +1,9 @@
 package viewmodel
 
 import (
+	"fmt"
+	"log/slog"
+	"path"
 	"slices"
 
 	"github.com/quintans/torflix/internal/app"
@@ -92,6 +95,44 @@ func (c *Cache) ClearCache() {
 	c.shared.Success("Cache cleared")
 }
 
+// Watched describes what was last watched of the torrent, eg: Show.S01E02.mkv at 0:12:03 (27%), 3 finished
+func (c *Cache) Watched(data *model.CacheData) string {
+	entries, err := c.downloadService.WatchHistory(data.Hash)
+	if err != nil {
+		slog.Error("Failed to load the watch history", "error", err)
+		return ""
+	}
+
+	var last string
+	finished := 0
+	for p, e := range entries {
+		if last == "" || e.Updated.After(entries[last].Updated) {
+			last = p
+		}
+		if e.Finished {
+			finished++
+		}
+	}
+	if last == "" {
+		return ""
+	}
+
+	e := entries[last]
+	desc := path.Base(last)
+	switch {
+	case e.Watched >= model.FinishedWatched:
+		desc += " finished"
+	case e.Position > 0:
+		desc += fmt.Sprintf(" at %s (%.0f%%)", clock(e.Position), e.Watched)
+	default:
+		desc += fmt.Sprintf(" at %.0f%%", e.Watched)
+	}
+	if len(entries) > 1 {
+		desc += fmt.Sprintf(", %d finished", finished)
+	}
+	return desc
+}
+
 func (c *Cache) Delete(idx int) {
 	data := c.Results.Get()
 	if idx < 0 || idx >= len(data) {
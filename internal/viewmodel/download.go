@@ -1,16 +1,29 @@
 package viewmodel
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"log/slog"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/anacrolix/torrent"
+	"github.com/quintans/faults"
 	"github.com/quintans/torflix/internal/app"
+	"github.com/quintans/torflix/internal/lib/bandwidth"
+	"github.com/quintans/torflix/internal/lib/humanize"
+	"github.com/quintans/torflix/internal/lib/probe"
+	"github.com/quintans/torflix/internal/lib/safety"
+	"github.com/quintans/torflix/internal/lib/seeding"
+	"github.com/quintans/torflix/internal/lib/stall"
+	"github.com/quintans/torflix/internal/lib/subrank"
 	"github.com/quintans/torflix/internal/lib/timer"
+	"github.com/quintans/torflix/internal/lib/transfer"
+	"github.com/quintans/torflix/internal/model"
 )
 
 type DownloadService interface {
@@ -22,6 +35,17 @@ type DownloadService interface {
 		season int,
 		episode int,
 	) (string, int, error)
+	SearchSubtitles(ctx context.Context, query app.SubtitleQuery) ([]app.Subtitle, error)
+	PreviewSubtitle(ctx context.Context, sub app.Subtitle) (string, error)
+	DownloadSubtitle(ctx context.Context, mediaName string, sub app.Subtitle) (string, error)
+	SubtitlesDir(mediaName string) (string, error)
+	MediaSubtitles(mediaName string) ([]string, error)
+	DeleteSubtitle(mediaName, name string) error
+	CorrectSubtitle(ctx context.Context, mediaName, name string, offset time.Duration, fromFPS, toFPS float64) error
+	SubtitleLanguages() ([]string, error)
+	SubtitleQuotas(ctx context.Context, refresh bool) (map[string]app.SubtitleQuota, error)
+	PrefetchSubtitles(requests []app.SubtitleRequest)
+	SubtitleAvailability(mediaName string) (pending bool, count int)
 	ServeFile(
 		ctx context.Context,
 		asyncError app.AsyncError,
@@ -30,32 +54,91 @@ type DownloadService interface {
 		setStats func(app.Stats),
 	) error
 	Play(ctx context.Context, asyncError app.AsyncError, servingFile, subtitlesDir string, onClose func()) error
+	PlaybackStatus() (app.PlaybackStatus, bool)
+	SetPlaybackPause(ctx context.Context, paused bool) error
+	SeekPlayback(ctx context.Context, offset time.Duration) error
+	WatchHistory(infoHash string) (map[string]model.WatchEntry, error)
+	Probe(ctx context.Context, file *torrent.File) (probe.Info, error)
 	Pause()
+	Recheck()
+	Peers() ([]app.PeerInfo, int64)
+	FilePriorities() map[string]app.FilePriority
+	SetFilePriority(file *torrent.File, priority app.FilePriority) error
+	StallConfig() (stall.Config, error)
+	AutoPlay() (bool, error)
+	SetAutoPlay(autoPlay bool) error
+	SubtitleProviders() []string
+	SubtitleSources() (model.SubtitleSources, error)
+	SetSubtitleSources(sources model.SubtitleSources) error
+	SubtitlePreferences() (subrank.Preferences, error)
+	SetSubtitlePreferences(prefs subrank.Preferences) error
 	Close()
 }
 
+type BandwidthService interface {
+	Limits() bandwidth.Limits
+	Turbo() bool
+	SetTurbo(turbo bool) error
+	Rates() (int, int, error)
+	SetRates(download, upload int) error
+}
+
+type SeedingService interface {
+	Status(hash string) (seeding.Totals, seeding.Policy, bool, error)
+	SetPolicy(hash string, policy *seeding.Policy) error
+	GlobalPolicy() (seeding.Policy, error)
+	SetGlobalPolicy(policy seeding.Policy) error
+}
+
+type StatsService interface {
+	Rates(hash string) (float64, float64)
+	History(hash string) []transfer.Sample
+	Totals(hash string) (model.TransferTotals, model.TransferTotals, error)
+}
+
 type DownloadTorrentResponse struct {
 	Name   string
 	Files  []*torrent.File
 	Folder string
 	Size   int64
+	Info   app.TorrentInfo
+	Safety safety.Report
 }
 
 type Download struct {
 	shared         *Shared
 	params         app.DownloadParams
 	service        DownloadService
+	bandwidth      BandwidthService
+	seeding        SeedingService
+	stats          StatsService
 	queryAndSeason string
 	subtitlesDir   string
 	ctx            context.Context
 	cancel         func()
+
+	// mu guards the stall recovery state, updated by the stats and read by the view,
+	// and the subtitles directory, set by the subtitles panel
+	mu         sync.Mutex
+	recovery   string
+	suggestion *SearchData
 }
 
-func NewDownload(shared *Shared, service DownloadService, params app.DownloadParams) *Download {
+func NewDownload(
+	shared *Shared,
+	service DownloadService,
+	bandwidthService BandwidthService,
+	seedingService SeedingService,
+	statsService StatsService,
+	params app.DownloadParams,
+) *Download {
 	d := &Download{
-		shared:  shared,
-		service: service,
-		params:  params,
+		shared:    shared,
+		service:   service,
+		bandwidth: bandwidthService,
+		seeding:   seedingService,
+		stats:     statsService,
+		params:    params,
 	}
 
 	d.ctx, d.cancel = context.WithCancel(context.Background())
@@ -77,6 +160,118 @@ func (d *Download) Back() {
 	d.shared.Navigate.Back()
 }
 
+// Recheck verifies all the downloaded pieces, discarding the persisted completion state
+func (d *Download) Recheck(onDone func()) {
+	go func() {
+		d.service.Recheck()
+		onDone()
+	}()
+}
+
+func (d *Download) Turbo() bool {
+	return d.bandwidth.Turbo()
+}
+
+// SetTurbo switches between the scheduled limits and the alternative ones
+func (d *Download) SetTurbo(turbo bool) {
+	err := d.bandwidth.SetTurbo(turbo)
+	if err != nil {
+		d.shared.Error(err, "Failed to change bandwidth limits")
+	}
+}
+
+func (d *Download) Limits() string {
+	return d.bandwidth.Limits().String()
+}
+
+// Peers returns the connected peers, sorted by download rate, and the number of unique blocked peer addresses
+func (d *Download) Peers() ([]app.PeerInfo, int64) {
+	peers, blocked := d.service.Peers()
+	slices.SortFunc(peers, func(a, b app.PeerInfo) int {
+		return cmp.Compare(b.DownloadRate, a.DownloadRate)
+	})
+	return peers, blocked
+}
+
+func (d *Download) infoHash() string {
+	return strings.ToUpper(d.params.FileToPlay.Torrent().InfoHash().HexString())
+}
+
+// SeedingStatus describes the lifetime totals of the torrent against its seeding goals
+func (d *Download) SeedingStatus() string {
+	totals, policy, _, err := d.seeding.Status(d.infoHash())
+	if err != nil {
+		slog.Error("Failed to get seeding status", "error", err)
+		return ""
+	}
+
+	status := fmt.Sprintf("ratio %.2f", totals.Ratio())
+	if policy.Ratio > 0 {
+		status += fmt.Sprintf(" of %.2f", policy.Ratio)
+	}
+	status += fmt.Sprintf(", seeded %s", totals.Seeding.Truncate(time.Minute))
+	if policy.SeedingMinutes > 0 {
+		status += fmt.Sprintf(" of %dm", policy.SeedingMinutes)
+	}
+	return status
+}
+
+// SeedingPolicy returns the policy of the torrent and if it is its own, instead of the global one
+func (d *Download) SeedingPolicy() (seeding.Policy, bool) {
+	_, policy, own, err := d.seeding.Status(d.infoHash())
+	if err != nil {
+		d.shared.Error(err, "Failed to get seeding policy")
+	}
+	return policy, own
+}
+
+func (d *Download) SetSeedingPolicy(policy seeding.Policy) {
+	err := d.seeding.SetPolicy(d.infoHash(), &policy)
+	if err != nil {
+		d.shared.Error(err, "Failed to set seeding policy")
+		return
+	}
+	d.shared.Success("Seeding policy saved for this torrent")
+}
+
+// ResetSeedingPolicy makes the torrent follow the global policy
+func (d *Download) ResetSeedingPolicy() {
+	err := d.seeding.SetPolicy(d.infoHash(), nil)
+	if err != nil {
+		d.shared.Error(err, "Failed to reset seeding policy")
+		return
+	}
+	d.shared.Success("The torrent follows the global seeding policy")
+}
+
+// SpeedHistory returns the recent download and upload rates of the torrent, from the oldest to the newest
+func (d *Download) SpeedHistory() ([]float64, []float64) {
+	history := d.stats.History(d.infoHash())
+	download := make([]float64, len(history))
+	upload := make([]float64, len(history))
+	for i, s := range history {
+		download[i] = s.Download
+		upload[i] = s.Upload
+	}
+	return download, upload
+}
+
+// TransferTotals describes the lifetime bytes transferred by the torrent and by all torrents
+func (d *Download) TransferTotals() string {
+	torrent, all, err := d.stats.Totals(d.infoHash())
+	if err != nil {
+		slog.Error("Failed to get transfer totals", "error", err)
+		return ""
+	}
+
+	return fmt.Sprintf("↓ %s ↑ %s (all torrents: ↓ %s ↑ %s)",
+		humanize.Bytes(uint64(torrent.Downloaded), 1),
+		humanize.Bytes(uint64(torrent.Uploaded), 1),
+		humanize.Bytes(uint64(all.Downloaded), 1),
+		humanize.Bytes(uint64(all.Uploaded), 1),
+	)
+}
+
 func (d *Download) TorrentFilename() string {
 	return d.params.FileToPlay.Torrent().Name()
 }
@@ -89,7 +284,7 @@ func (d *Download) TorrentSubFilename() string {
 }
 
 func (d *Download) Serve(onStats func(stats app.Stats)) bool {
-	qc := d.getQueryComponents(d.params.FileToPlay, d.params.OriginalQuery)
+	qc := getQueryComponents(d.params.FileToPlay, d.params.OriginalQuery)
 	if d.params.Subtitles {
 		t := timer.New(time.Second, func() {
 			d.shared.Publish(app.Loading{
@@ -119,11 +314,20 @@ func (d *Download) Serve(onStats func(stats app.Stats)) bool {
 		if downloaded == 0 {
 			d.shared.Info("No subtitles found")
 		}
+		d.warnExhaustedQuotas()
 
+		d.mu.Lock()
 		d.subtitlesDir = subtitlesDir
+		d.mu.Unlock()
 	}
 
-	err := d.service.ServeFile(d.ctx, d.shared.Error, d.params.FileToPlay, qc.mediaName, onStats)
+	err := d.service.ServeFile(d.ctx, d.shared.Error, d.params.FileToPlay, qc.mediaName, func(stats app.Stats) {
+		d.onStall(stats.Stall)
+		down, up := d.stats.Rates(d.infoHash())
+		stats.DownloadSpeed = int64(down)
+		stats.UploadSpeed = int64(up)
+		onStats(stats)
+	})
 	if err != nil {
 		d.shared.Error(err, "Failed to serve file")
 		return false
@@ -135,12 +339,200 @@ func (d *Download) Serve(onStats func(stats app.Stats)) bool {
 }
 
 func (d *Download) Play(onClose func()) {
-	err := d.service.Play(d.ctx, d.shared.Error, d.queryAndSeason, d.subtitlesDir, onClose)
+	d.mu.Lock()
+	subtitlesDir := d.subtitlesDir
+	d.mu.Unlock()
+
+	err := d.service.Play(d.ctx, d.shared.Error, d.queryAndSeason, subtitlesDir, onClose)
 	if err != nil {
 		d.shared.Error(err, "Failed to play file")
 	}
 }
 
+// AutoPlay tells if the player is launched as soon as the file is ready for playback
+func (d *Download) AutoPlay() bool {
+	autoPlay, err := d.service.AutoPlay()
+	if err != nil {
+		d.shared.Error(err, "Failed to load auto play")
+	}
+	return autoPlay
+}
+
+func (d *Download) SetAutoPlay(autoPlay bool) {
+	err := d.service.SetAutoPlay(autoPlay)
+	if err != nil {
+		d.shared.Error(err, "Failed to save auto play")
+	}
+}
+
+// Recovery describes the last recovery action of a stalled download
+func (d *Download) Recovery() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.recovery == "" {
+		return "-"
+	}
+	return d.recovery
+}
+
+// Suggestion returns the name of the source suggested to replace the stalled torrent, if any
+func (d *Download) Suggestion() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.suggestion == nil {
+		return ""
+	}
+	return d.suggestion.Name
+}
+
+func (d *Download) setRecovery(recovery string, suggestion *SearchData) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.recovery = recovery
+	d.suggestion = suggestion
+}
+
+// onStall reports the recovery actions of a stalled download and, as the last resort, switches to another source
+func (d *Download) onStall(action stall.Action) {
+	switch action {
+	case stall.None:
+		return
+	case stall.Recovered:
+		d.setRecovery("", nil)
+		d.shared.Success("The download is progressing again")
+		return
+	case stall.SwitchSource:
+	default:
+		d.setRecovery(action.String(), nil)
+		d.shared.Warn("Download stalled, %s", action)
+		return
+	}
+
+	alternatives := alternativeSources(d.shared.Results, d.infoHash())
+	if len(alternatives) == 0 {
+		d.setRecovery("no other source with the same content", nil)
+		d.shared.Warn("Download stalled and the last search has no other source with the same content")
+		return
+	}
+	alt := alternatives[0]
+
+	cfg, err := d.service.StallConfig()
+	if err != nil {
+		slog.Error("Failed to load stall configuration", "error", err)
+	}
+	if cfg.AutoSwitch {
+		d.setRecovery("switching to "+alt.Name, nil)
+		d.shared.Warn("Download stalled, switching to %s", alt.Name)
+		go d.switchSource(alt)
+		return
+	}
+
+	d.setRecovery("same content in "+alt.Name, alt)
+	d.shared.Warn("Download stalled. %s has the same content", alt.Name)
+}
+
+// SwitchSource replaces the stalled torrent with the suggested source
+func (d *Download) SwitchSource() {
+	d.mu.Lock()
+	alt := d.suggestion
+	d.mu.Unlock()
+
+	if alt != nil {
+		d.switchSource(alt)
+	}
+}
+
+func (d *Download) switchSource(alt *SearchData) {
+	if d.cancel != nil {
+		d.cancel()
+	}
+
+	// a file chosen from a list has the list screen between it and the search
+	screens := 1
+	if d.params.PauseTorrentOnClose {
+		screens = 2
+	}
+
+	t := timer.New(time.Second, func() {
+		d.shared.Publish(app.Loading{
+			Text: "Downloading torrent metadata",
+			Show: true,
+		})
+	})
+	// the current torrent is closed, even on failure
+	response, err := d.service.DownloadTorrent(alt.Magnet)
+	t.Stop()
+	d.shared.Publish(app.Loading{})
+	if err == nil && response.Safety.Level == safety.LevelBlock {
+		err = faults.Errorf("%s was blocked by the safety rules", alt.Name)
+	}
+	if err != nil {
+		d.shared.Error(err, "Failed to switch source")
+		d.shared.Navigate.Unwind(screens+1, app.AppParams{})
+		return
+	}
+
+	d.shared.Navigate.Unwind(screens, app.DownloadParams{
+		FileToPlay:          sameContentFile(d.params.FileToPlay, response.Files),
+		PauseTorrentOnClose: false,
+		OriginalQuery:       d.params.OriginalQuery,
+		Subtitles:           d.params.Subtitles,
+	})
+}
+
+// alternativeSources returns the other results with the same title, episode and quality as the result with the hash,
+// most seeded first
+func alternativeSources(results []*SearchData, hash string) []*SearchData {
+	idx := slices.IndexFunc(results, func(r *SearchData) bool {
+		return strings.EqualFold(r.Hash, hash)
+	})
+	if idx < 0 {
+		return nil
+	}
+	current := results[idx]
+	title := strings.ToLower(extractTitle(current.Name))
+	season, episode := extractSeasonEpisode(current.Name)
+
+	var alternatives []*SearchData
+	for _, r := range results {
+		if r.Hash == "" || strings.EqualFold(r.Hash, hash) || r.Seeds == 0 || r.FakeSeeds ||
+			r.Safety.Level == safety.LevelBlock || r.QualityName != current.QualityName {
+			continue
+		}
+		s, e := extractSeasonEpisode(r.Name)
+		if s != season || e != episode || strings.ToLower(extractTitle(r.Name)) != title {
+			continue
+		}
+		alternatives = append(alternatives, r)
+	}
+	slices.SortStableFunc(alternatives, func(a, b *SearchData) int {
+		return cmp.Compare(b.Seeds, a.Seeds)
+	})
+
+	return alternatives
+}
+
+// sameContentFile picks the file of the new torrent with the episode of the file being played, or else the largest
+func sameContentFile(playing *torrent.File, files []*torrent.File) *torrent.File {
+	season, episode := extractSeasonEpisode(playing.DisplayPath())
+	var largest *torrent.File
+	for _, f := range files {
+		if season > 0 {
+			s, e := extractSeasonEpisode(f.DisplayPath())
+			if s == season && e == episode {
+				return f
+			}
+		}
+		if largest == nil || f.Length() > largest.Length() {
+			largest = f
+		}
+	}
+	return largest
+}
+
 type queryComponents struct {
 	cleanedQuery string
 	mediaName    string
@@ -148,7 +540,7 @@ type queryComponents struct {
 	episode      int
 }
 
-func (c *Download) getQueryComponents(file *torrent.File, originalQuery string) queryComponents {
+func getQueryComponents(file *torrent.File, originalQuery string) queryComponents {
 	season, episode := extractSeasonEpisode(file.DisplayPath())
 	cleanedQuery := extractTitle(originalQuery)
 
@@ -1,9 +1,16 @@
 package viewmodel
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
 	"github.com/anacrolix/torrent"
 	"github.com/quintans/torflix/internal/app"
 	"github.com/quintans/torflix/internal/lib/bind"
+	"github.com/quintans/torflix/internal/lib/probe"
 	"github.com/quintans/torflix/internal/lib/slices"
 )
 
@@ -12,11 +19,24 @@ type DownloadList struct {
 	params    app.DownloadListParams
 	service   DownloadService
 	FileItems bind.Notifier[[]*FileItem]
+	cancel    func()
+
+	// mu guards the media found by probing the files in the background
+	mu    sync.Mutex
+	media map[*torrent.File]media
+}
+
+// media describes what was found in the headers of a file
+type media struct {
+	summary string
+	// invalid tells why the file cannot be played, if it cannot
+	invalid string
 }
 
 type FileItem struct {
 	Selected bool
 	File     *torrent.File
+	Priority app.FilePriority
 }
 
 func NewDownloadList(shared *Shared, service DownloadService, params app.DownloadListParams) *DownloadList {
@@ -25,21 +45,111 @@ func NewDownloadList(shared *Shared, service DownloadService, params app.Downloa
 		service:   service,
 		params:    params,
 		FileItems: bind.NewNotifier[[]*FileItem](),
+		media:     map[*torrent.File]media{},
 	}
 
+	priorities := service.FilePriorities()
 	fileItems := slices.Map(params.Files, func(it *torrent.File) *FileItem {
 		p99 := float64(it.Length()) * 0.99
+		priority, ok := priorities[it.Path()]
+		if !ok {
+			priority = app.FilePrioritySkip
+		}
 		return &FileItem{
 			Selected: it.BytesCompleted() > int64(p99),
 			File:     it,
+			Priority: priority,
 		}
 	})
 	d.FileItems.Notify(fileItems)
 
+	var ctx context.Context
+	ctx, d.cancel = context.WithCancel(context.Background())
+	go d.probe(ctx, params.Files)
+
+	// the subtitles of every episode of a season pack are fetched before they are played
+	if params.Subtitles && len(params.Files) > 1 {
+		service.PrefetchSubtitles(slices.Map(params.Files, func(f *torrent.File) app.SubtitleRequest {
+			qc := getQueryComponents(f, f.DisplayPath())
+			return app.SubtitleRequest{
+				File:      f,
+				MediaName: qc.mediaName,
+				Query:     qc.cleanedQuery,
+				Season:    qc.season,
+				Episode:   qc.episode,
+			}
+		}))
+	}
+
 	return d
 }
 
+// probe reads the headers of the files, one at a time, to tell what is inside them
+func (d *DownloadList) probe(ctx context.Context, files []*torrent.File) {
+	for _, f := range files {
+		if !probe.Supported(f.DisplayPath()) {
+			continue
+		}
+
+		info, err := d.service.Probe(ctx, f)
+		if ctx.Err() != nil {
+			return
+		}
+
+		var m media
+		switch {
+		case errors.Is(err, probe.ErrUnsupported):
+			// the extension does not match the content, which is common in malicious torrents
+			m.invalid = "not a media file"
+		case err != nil:
+			slog.Warn("Failed to probe file", "file", f.DisplayPath(), "error", err)
+			continue
+		case info.Video == nil:
+			m.invalid = "no video track"
+		default:
+			m.summary = info.String()
+		}
+
+		d.mu.Lock()
+		d.media[f] = m
+		d.mu.Unlock()
+	}
+}
+
+// Media describes what is inside the file, or why it cannot be played, once probed
+func (d *DownloadList) Media(item *FileItem) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	m := d.media[item.File]
+	if m.invalid != "" {
+		return m.invalid
+	}
+	return m.summary
+}
+
+// Subtitles tells if the subtitles of the file are still being fetched or how many there are,
+// or nothing if subtitles were not requested
+func (d *DownloadList) Subtitles(item *FileItem) string {
+	if !d.params.Subtitles {
+		return ""
+	}
+
+	pending, count := d.service.SubtitleAvailability(getQueryComponents(item.File, item.File.DisplayPath()).mediaName)
+	switch {
+	case pending:
+		return "fetching subtitles"
+	case count == 0:
+		return "no subtitles"
+	case count == 1:
+		return "1 subtitle"
+	default:
+		return fmt.Sprintf("%d subtitles", count)
+	}
+}
+
 func (d *DownloadList) Unmount() {
+	d.cancel()
 	d.FileItems.UnbindAll()
 }
 
@@ -49,6 +159,14 @@ func (d *DownloadList) Back() {
 }
 
 func (d *DownloadList) Select(item *FileItem) {
+	d.mu.Lock()
+	invalid := d.media[item.File].invalid
+	d.mu.Unlock()
+	if invalid != "" {
+		d.shared.Warn("The file cannot be played: %s", invalid)
+		return
+	}
+
 	item.Selected = true
 	d.shared.Navigate.To(app.DownloadParams{
 		FileToPlay:          item.File,
@@ -57,3 +175,34 @@ func (d *DownloadList) Select(item *FileItem) {
 		Subtitles:           d.params.Subtitles,
 	})
 }
+
+// Want marks the file to be downloaded in the background, with normal priority, or to be skipped
+func (d *DownloadList) Want(item *FileItem, wanted bool) {
+	if wanted {
+		d.SetPriority(item, app.FilePriorityNormal)
+	} else {
+		d.SetPriority(item, app.FilePrioritySkip)
+	}
+}
+
+func (d *DownloadList) SetPriority(item *FileItem, priority app.FilePriority) {
+	if item.Priority == priority {
+		return
+	}
+
+	err := d.service.SetFilePriority(item.File, priority)
+	if err != nil {
+		d.shared.Error(err, "Failed to set file priority")
+		return
+	}
+	item.Priority = priority
+	d.FileItems.Notify(d.FileItems.Get())
+}
+
+// Progress returns the downloaded percentage of the file
+func (d *DownloadList) Progress(item *FileItem) float64 {
+	if item.File.Length() == 0 {
+		return 100
+	}
+	return float64(item.File.BytesCompleted()) / float64(item.File.Length()) * 100
+}
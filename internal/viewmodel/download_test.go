@@ -24,3 +24,24 @@ func TestExtract(t *testing.T) {
 	assert.Equal(t, 0, s)
 	assert.Equal(t, 0, e)
 }
+
+func TestAlternativeSources(t *testing.T) {
+	results := []*SearchData{
+		{Name: "Lioness.S02E03.1080p.WEB.x264", Hash: "aa", QualityName: "1080p", Seeds: 3},
+		{Name: "Lioness S02E03 1080p HEVC", Hash: "bb", QualityName: "1080p", Seeds: 10},
+		{Name: "Lioness.S02E03.1080p.Other", Hash: "cc", QualityName: "1080p", Seeds: 50},
+		{Name: "Lioness.S02E03.720p.WEB", Hash: "dd", QualityName: "720p", Seeds: 90},
+		{Name: "Lioness.S02E04.1080p.WEB", Hash: "ee", QualityName: "1080p", Seeds: 90},
+		{Name: "Lioness.S02E03.1080p.Dead", Hash: "ff", QualityName: "1080p", Seeds: 0},
+		{Name: "Lioness.S02E03.1080p.Fake", Hash: "gg", QualityName: "1080p", Seeds: 900, FakeSeeds: true},
+	}
+
+	alternatives := alternativeSources(results, "AA")
+	hashes := []string{}
+	for _, a := range alternatives {
+		hashes = append(hashes, a.Hash)
+	}
+	assert.Equal(t, []string{"cc", "bb"}, hashes)
+
+	assert.Empty(t, alternativeSources(results, "zz"))
+}
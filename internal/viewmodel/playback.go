@@ -0,0 +1,51 @@
+package viewmodel
+
+import (
+	"fmt"
+	"time"
+)
+
+// Playback describes the player, eg: 0:12:03 / 0:45:00 (paused), and tells if it can be controlled
+func (d *Download) Playback() (string, bool) {
+	status, ok := d.service.PlaybackStatus()
+	if !ok {
+		return "", false
+	}
+
+	desc := clock(status.Position)
+	if status.Duration > 0 {
+		desc += " / " + clock(status.Duration)
+	}
+	switch {
+	case status.Starved:
+		desc += " (waiting for the download)"
+	case status.Paused:
+		desc += " (paused)"
+	}
+	return desc, true
+}
+
+// TogglePause pauses the player, or resumes it if paused
+func (d *Download) TogglePause() {
+	status, ok := d.service.PlaybackStatus()
+	if !ok {
+		return
+	}
+	err := d.service.SetPlaybackPause(d.ctx, !status.Paused)
+	if err != nil {
+		d.shared.Error(err, "Failed to pause the player")
+	}
+}
+
+// Seek moves the position of the player by the offset
+func (d *Download) Seek(offset time.Duration) {
+	err := d.service.SeekPlayback(d.ctx, offset)
+	if err != nil {
+		d.shared.Error(err, "Failed to seek the player")
+	}
+}
+
+func clock(d time.Duration) string {
+	d = d.Truncate(time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
@@ -0,0 +1,132 @@
+package viewmodel
+
+import (
+	"cmp"
+	"path"
+	gslices "slices"
+
+	"github.com/anacrolix/torrent"
+	"github.com/quintans/torflix/internal/app"
+	"github.com/quintans/torflix/internal/lib/safety"
+)
+
+type Preview struct {
+	shared  *Shared
+	params  app.PreviewParams
+	service DownloadService
+	// Tree maps a node id to the ids of its children. The root node id is the empty string.
+	Tree  map[string][]string
+	Nodes map[string]*PreviewNode
+}
+
+type PreviewNode struct {
+	Name string
+	Size int64
+	Dir  bool
+}
+
+func NewPreview(shared *Shared, service DownloadService, params app.PreviewParams) *Preview {
+	p := &Preview{
+		shared:  shared,
+		service: service,
+		params:  params,
+	}
+	p.Tree, p.Nodes = buildFileTree(params.Info.Files)
+
+	return p
+}
+
+// buildFileTree converts the flat list of torrent file paths into a tree, accumulating the sizes on the directories.
+func buildFileTree(files []app.TorrentFileInfo) (map[string][]string, map[string]*PreviewNode) {
+	tree := map[string][]string{}
+	nodes := map[string]*PreviewNode{}
+
+	for _, f := range files {
+		id := f.Path
+		nodes[id] = &PreviewNode{Name: path.Base(id), Size: f.Size}
+		for {
+			parent := path.Dir(id)
+			if parent == "." {
+				parent = ""
+			}
+
+			if !gslices.Contains(tree[parent], id) {
+				tree[parent] = append(tree[parent], id)
+			}
+
+			if parent == "" {
+				break
+			}
+
+			node, ok := nodes[parent]
+			if !ok {
+				node = &PreviewNode{Name: path.Base(parent), Dir: true}
+				nodes[parent] = node
+			}
+			node.Size += f.Size
+			id = parent
+		}
+	}
+
+	for _, children := range tree {
+		gslices.SortFunc(children, func(a, b string) int {
+			// directories first
+			if nodes[a].Dir != nodes[b].Dir {
+				if nodes[a].Dir {
+					return -1
+				}
+				return 1
+			}
+			return cmp.Compare(a, b)
+		})
+	}
+
+	return tree, nodes
+}
+
+func (p *Preview) Info() app.TorrentInfo {
+	return p.params.Info
+}
+
+func (p *Preview) Safety() safety.Report {
+	return p.params.Safety
+}
+
+// Blocked tells if the safety rules forbid streaming this torrent
+func (p *Preview) Blocked() bool {
+	return p.params.Safety.Level == safety.LevelBlock
+}
+
+func (p *Preview) Back() {
+	p.service.Close()
+	p.shared.Navigate.Back()
+}
+
+// Stream proceeds to the streaming screens, replacing the preview in the navigation stack
+func (p *Preview) Stream() {
+	if p.Blocked() {
+		p.shared.Warn("Torrent was blocked by the safety rules")
+		return
+	}
+
+	files := p.params.Files
+	if len(files) == 1 {
+		p.shared.Navigate.Replace(app.DownloadParams{
+			FileToPlay:          files[0],
+			PauseTorrentOnClose: false,
+			OriginalQuery:       p.params.OriginalQuery,
+			Subtitles:           p.params.Subtitles,
+		})
+		return
+	}
+
+	gslices.SortFunc(files, func(i, j *torrent.File) int {
+		return cmp.Compare(i.DisplayPath(), j.DisplayPath())
+	})
+
+	p.shared.Navigate.Replace(app.DownloadListParams{
+		Files:         files,
+		OriginalQuery: p.params.OriginalQuery,
+		Subtitles:     p.params.Subtitles,
+	})
+}
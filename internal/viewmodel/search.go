@@ -2,6 +2,7 @@ package viewmodel
 
 import (
 	"cmp"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -16,6 +17,8 @@ import (
 	"github.com/quintans/torflix/internal/lib/bind"
 	"github.com/quintans/torflix/internal/lib/humanize"
 	"github.com/quintans/torflix/internal/lib/magnet"
+	"github.com/quintans/torflix/internal/lib/safety"
+	"github.com/quintans/torflix/internal/lib/scrape"
 	"github.com/quintans/torflix/internal/lib/timer"
 	"github.com/quintans/torflix/internal/model"
 )
@@ -24,6 +27,15 @@ type SearchService interface {
 	LoadSearch() (*app.SearchSettings, error)
 	SaveSearch(model *model.Search) error
 	Search(query string, providers []string) ([]*SearchResult, error)
+	Scrape(magnetLink string, claimedSeeds int) (ScrapeResult, error)
+}
+
+// ScrapeResult is the swarm reported by the trackers for a search result
+type ScrapeResult struct {
+	Seeders  int
+	Leechers int
+	// FakeSeeds is true when the trackers know of too few of the seeders claimed by the provider
+	FakeSeeds bool
 }
 
 type Search struct {
@@ -46,15 +58,23 @@ type SearchResult struct {
 }
 
 type SearchData struct {
-	Provider    string
-	Name        string
-	Magnet      string
-	Size        string
-	Seeds       int
-	Quality     int
-	QualityName string
-	Hash        string
-	Cached      bool
+	Provider string
+	Name     string
+	Magnet   string
+	Size     string
+	Seeds    int
+	// ClaimedSeeds are the seeds announced by the provider, kept after the trackers are scraped
+	ClaimedSeeds int
+	Quality      int
+	QualityName  string
+	Hash         string
+	Cached       bool
+	Safety       safety.Report
+	Leechers     int
+	// Scraped is true when Seeds and Leechers were confirmed by the trackers
+	Scraped bool
+	// FakeSeeds is true when the seeds announced by the provider are far from the ones reported by the trackers
+	FakeSeeds bool
 }
 
 func NewSearch(shared *Shared, searchService SearchService, downloadService DownloadService, params app.AppParams) *Search {
@@ -238,6 +258,7 @@ func (s *Search) Search(onResults func([]*SearchData)) bool {
 	if len(data) == 0 {
 		s.shared.Info("No results found for query")
 		s.Results = data
+		s.shared.Results = data
 		onResults(data)
 
 		return false
@@ -257,6 +278,7 @@ func (s *Search) Search(onResults func([]*SearchData)) bool {
 	})
 
 	s.Results = data
+	s.shared.Results = data
 	onResults(data)
 
 	return true
@@ -266,6 +288,31 @@ func (s *Search) Download(magnetLink string) (DownloadTorrentResponse, bool) {
 	return download(s.shared, s.downloadService, s.OriginalQuery, magnetLink, s.DownloadSubtitles.Get())
 }
 
+// Scrape refreshes the seeders and leechers of a result with the values reported by the trackers.
+// The result is left as it is when no tracker knows the torrent, since an unknown swarm is not the same as no seeders.
+func (s *Search) Scrape(data *SearchData) bool {
+	res, err := s.searchService.Scrape(data.Magnet, data.ClaimedSeeds)
+	if errors.Is(err, scrape.ErrUnknownTorrent) {
+		s.shared.Warn("No tracker knows the swarm of %s", data.Name)
+		return false
+	}
+	if err != nil {
+		s.shared.Error(err, "Failed to scrape trackers")
+		return false
+	}
+
+	data.FakeSeeds = res.FakeSeeds
+	data.Seeds = res.Seeders
+	data.Leechers = res.Leechers
+	data.Scraped = true
+
+	if data.FakeSeeds {
+		s.shared.Warn("Trackers report much less seeders than the provider for %s", data.Name)
+	}
+
+	return true
+}
+
 func (s *Search) collapseByHash(results []*SearchData) ([]*SearchData, error) {
 	groups := map[string][]*SearchData{}
 	for k, r := range results {
@@ -311,14 +358,17 @@ func (s *Search) collapseByHash(results []*SearchData) ([]*SearchData, error) {
 			})
 
 			merged = append(merged, &SearchData{
-				Provider:    strings.Join(providers, ","),
-				Name:        dn,
-				Magnet:      magnet,
-				Size:        maxSeeded.Size,
-				Seeds:       maxSeeded.Seeds,
-				Quality:     maxSeeded.Quality,
-				QualityName: maxSeeded.QualityName,
-				Hash:        maxSeeded.Hash,
+				Provider:     strings.Join(providers, ","),
+				Name:         dn,
+				Magnet:       magnet,
+				Size:         maxSeeded.Size,
+				Seeds:        maxSeeded.Seeds,
+				ClaimedSeeds: maxSeeded.ClaimedSeeds,
+				Quality:      maxSeeded.Quality,
+				QualityName:  maxSeeded.QualityName,
+				Hash:         maxSeeded.Hash,
+				Cached:       maxSeeded.Cached,
+				Safety:       maxSeeded.Safety,
 			})
 		}
 	}
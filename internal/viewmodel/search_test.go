@@ -0,0 +1,52 @@
+package viewmodel
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/quintans/torflix/internal/app"
+	"github.com/quintans/torflix/internal/lib/bind"
+	"github.com/quintans/torflix/internal/lib/scrape"
+	"github.com/stretchr/testify/assert"
+)
+
+type scrapeService struct {
+	SearchService
+	result ScrapeResult
+	err    error
+}
+
+func (s scrapeService) Scrape(string, int) (ScrapeResult, error) {
+	return s.result, s.err
+}
+
+func TestScrapeKeepsClaimedSeeds(t *testing.T) {
+	s := &Search{
+		shared:        &Shared{ShowNotification: bind.NewNotifier[app.Notify]()},
+		searchService: scrapeService{result: ScrapeResult{Seeders: 10, Leechers: 3, FakeSeeds: true}},
+	}
+	data := &SearchData{Name: "Lioness.S02E03", Seeds: 900, ClaimedSeeds: 900}
+
+	assert.True(t, s.Scrape(data))
+	assert.True(t, data.FakeSeeds)
+	assert.Equal(t, 10, data.Seeds)
+
+	// refreshing again still compares with the seeds claimed by the provider
+	assert.True(t, s.Scrape(data))
+	assert.True(t, data.FakeSeeds)
+	assert.Equal(t, 900, data.ClaimedSeeds)
+}
+
+func TestScrapeUnknownTorrent(t *testing.T) {
+	s := &Search{
+		shared:        &Shared{ShowNotification: bind.NewNotifier[app.Notify]()},
+		searchService: scrapeService{err: fmt.Errorf("scraping 3 trackers: %w", scrape.ErrUnknownTorrent)},
+	}
+	data := &SearchData{Name: "Lioness.S02E03", Seeds: 900, ClaimedSeeds: 900}
+
+	// the claimed seeds are kept when no tracker knows the torrent
+	assert.False(t, s.Scrape(data))
+	assert.False(t, data.Scraped)
+	assert.False(t, data.FakeSeeds)
+	assert.Equal(t, 900, data.Seeds)
+}
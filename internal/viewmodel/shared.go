@@ -16,6 +16,8 @@ type Shared struct {
 	Navigate         *navigation.Navigator
 	ShowNotification bind.Notifier[app.Notify]
 	Publish          func(msg bus.Message)
+	// Results are the results of the last search, where other sources of the same content are looked for
+	Results []*SearchData
 }
 
 func (s *Shared) Error(err error, msg string, args ...any) {
@@ -0,0 +1,167 @@
+package viewmodel
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/quintans/torflix/internal/app"
+)
+
+// SubtitleQuery returns the query, season, episode and languages the subtitles are searched with, by default
+func (d *Download) SubtitleQuery() (string, int, int, []string) {
+	qc := getQueryComponents(d.params.FileToPlay, d.params.OriginalQuery)
+	languages, err := d.service.SubtitleLanguages()
+	if err != nil {
+		d.shared.Error(err, "Failed to load subtitle languages")
+	}
+	return qc.cleanedQuery, qc.season, qc.episode, languages
+}
+
+// SearchSubtitles searches every enabled provider, sorting the results by language and fitness to the file
+func (d *Download) SearchSubtitles(query string, season, episode int, languages []string) []app.Subtitle {
+	subs, err := d.service.SearchSubtitles(d.ctx, app.SubtitleQuery{
+		File:      d.params.FileToPlay,
+		Query:     query,
+		Season:    season,
+		Episode:   episode,
+		Languages: languages,
+	})
+	if err != nil {
+		d.shared.Error(err, "Failed to search subtitles")
+		return nil
+	}
+	if len(subs) == 0 {
+		d.shared.Info("No subtitles found")
+	}
+	return subs
+}
+
+// SubtitleDetails describes what is known about the subtitle, eg: opensubtitles · en · 1.2k downloads · 8.5★ · HI
+func SubtitleDetails(sub app.Subtitle) string {
+	parts := []string{sub.Provider}
+	if sub.Language != "" {
+		parts = append(parts, sub.Language)
+	}
+	if sub.Live {
+		parts = append(parts, "embedded in the file")
+	}
+	if sub.HashMatch {
+		parts = append(parts, "made for this file")
+	}
+	if sub.Downloads > 0 {
+		parts = append(parts, fmt.Sprintf("%d downloads", sub.Downloads))
+	}
+	if sub.Rating > 0 {
+		parts = append(parts, fmt.Sprintf("%.1f★", sub.Rating))
+	}
+	if sub.FPS > 0 {
+		parts = append(parts, fmt.Sprintf("%.3g fps", sub.FPS))
+	}
+	if sub.HearingImpaired {
+		parts = append(parts, "HI")
+	}
+	if sub.Trusted {
+		parts = append(parts, "trusted")
+	}
+	if sub.AITranslated || sub.MachineTranslated {
+		parts = append(parts, "machine translated")
+	}
+	return strings.Join(parts, " · ")
+}
+
+// PreviewSubtitle returns the first lines of the subtitle
+func (d *Download) PreviewSubtitle(sub app.Subtitle) string {
+	preview, err := d.service.PreviewSubtitle(d.ctx, sub)
+	if err != nil {
+		d.shared.Error(err, "Failed to preview subtitle")
+		return ""
+	}
+	return preview
+}
+
+// DownloadSubtitle saves the subtitle with the others of the media, so the player loads it
+func (d *Download) DownloadSubtitle(sub app.Subtitle) bool {
+	mediaName := d.mediaName()
+	name, err := d.service.DownloadSubtitle(d.ctx, mediaName, sub)
+	if errors.Is(err, app.ErrSubtitleQuotaExhausted) {
+		d.warnExhaustedQuotas()
+		return false
+	}
+	if err != nil {
+		d.shared.Error(err, "Failed to download subtitle")
+		return false
+	}
+
+	subsDir, err := d.service.SubtitlesDir(mediaName)
+	if err != nil {
+		d.shared.Error(err, "Failed to get subtitles directory")
+		return false
+	}
+	d.mu.Lock()
+	d.subtitlesDir = subsDir
+	d.mu.Unlock()
+
+	d.shared.Success("Subtitle saved as " + name)
+	return true
+}
+
+// Subtitles returns the names of the subtitle files of the media
+func (d *Download) Subtitles() []string {
+	names, err := d.service.MediaSubtitles(d.mediaName())
+	if err != nil {
+		d.shared.Error(err, "Failed to list subtitles")
+	}
+	return names
+}
+
+func (d *Download) DeleteSubtitle(name string) {
+	err := d.service.DeleteSubtitle(d.mediaName(), name)
+	if err != nil {
+		d.shared.Error(err, "Failed to delete subtitle")
+	}
+}
+
+// CorrectSubtitle shifts the subtitle by the offset in seconds and changes its frame rate, if both are set,
+// for subtitles out of sync with the file
+func (d *Download) CorrectSubtitle(name string, offset, fromFPS, toFPS float64) bool {
+	err := d.service.CorrectSubtitle(d.ctx, d.mediaName(), name, time.Duration(offset*float64(time.Second)), fromFPS, toFPS)
+	if err != nil {
+		d.shared.Error(err, "Failed to correct subtitle")
+		return false
+	}
+	d.shared.Success("Subtitle " + name + " corrected")
+	return true
+}
+
+// warnExhaustedQuotas tells which providers stopped downloading because their daily quota is exhausted
+func (d *Download) warnExhaustedQuotas() {
+	quotas, err := d.service.SubtitleQuotas(d.ctx, false)
+	if err != nil {
+		slog.Error("Failed to get subtitle quotas", "error", err)
+		return
+	}
+	for name, q := range quotas {
+		if q.Exhausted(time.Now()) {
+			d.shared.Warn("No more downloads from %s today. %s", name, QuotaDescription(q))
+		}
+	}
+}
+
+// QuotaDescription describes the downloads left, eg: 5 of 20 downloads left, resets at 00:00
+func QuotaDescription(q app.SubtitleQuota) string {
+	if q.Allowed == 0 {
+		return "Unknown quota"
+	}
+	desc := fmt.Sprintf("%d of %d downloads left", max(q.Remaining, 0), q.Allowed)
+	if !q.ResetAt.IsZero() {
+		desc += ", resets at " + q.ResetAt.Local().Format("15:04")
+	}
+	return desc
+}
+
+func (d *Download) mediaName() string {
+	return getQueryComponents(d.params.FileToPlay, d.params.OriginalQuery).mediaName
+}
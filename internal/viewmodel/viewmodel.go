@@ -1,11 +1,8 @@
 package viewmodel
 
 import (
-	"cmp"
-	gslices "slices"
 	"time"
 
-	"github.com/anacrolix/torrent"
 	"github.com/quintans/torflix/internal/app"
 	"github.com/quintans/torflix/internal/lib/timer"
 )
@@ -34,22 +31,10 @@ func download(shared *Shared, downloadService DownloadService, originalQuery, li
 		return DownloadTorrentResponse{}, false
 	}
 
-	if len(response.Files) == 1 {
-		shared.Navigate.To(app.DownloadParams{
-			FileToPlay:          response.Files[0],
-			PauseTorrentOnClose: false,
-			OriginalQuery:       originalQuery,
-			Subtitles:           subtitles,
-		})
-		return response, true
-	}
-
-	gslices.SortFunc(response.Files, func(i, j *torrent.File) int {
-		return cmp.Compare(i.DisplayPath(), j.DisplayPath())
-	})
-
-	shared.Navigate.To(app.DownloadListParams{
+	shared.Navigate.To(app.PreviewParams{
 		Files:         response.Files,
+		Info:          response.Info,
+		Safety:        response.Safety,
 		OriginalQuery: originalQuery,
 		Subtitles:     subtitles,
 	})
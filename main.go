@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -13,15 +16,21 @@ import (
 	"github.com/quintans/faults"
 	gapp "github.com/quintans/torflix/internal/app"
 	"github.com/quintans/torflix/internal/app/services"
+	"github.com/quintans/torflix/internal/gateways/eventbus"
+	"github.com/quintans/torflix/internal/gateways/localsubs"
 	"github.com/quintans/torflix/internal/gateways/opensubtitles"
 	"github.com/quintans/torflix/internal/gateways/player"
+	"github.com/quintans/torflix/internal/gateways/podnapisi"
 	"github.com/quintans/torflix/internal/gateways/repository"
 	"github.com/quintans/torflix/internal/gateways/secrets"
 	"github.com/quintans/torflix/internal/gateways/tor"
 	"github.com/quintans/torflix/internal/lib/bind"
+	"github.com/quintans/torflix/internal/lib/blocklist"
 	"github.com/quintans/torflix/internal/lib/bus"
 	"github.com/quintans/torflix/internal/lib/extractor"
 	"github.com/quintans/torflix/internal/lib/navigation"
+	"github.com/quintans/torflix/internal/lib/netbind"
+	"github.com/quintans/torflix/internal/lib/proxy"
 	"github.com/quintans/torflix/internal/model"
 	"github.com/quintans/torflix/internal/mycontainer"
 	"github.com/quintans/torflix/internal/view"
@@ -160,6 +169,7 @@ func main() {
 		panic(err)
 	}
 
+	// the subtitles dropped in the default directory are found by the local provider, along with the configured folders
 	defSubTitlesDir := filepath.Join(subtitlesDir, "default")
 	err = os.MkdirAll(defSubTitlesDir, os.ModePerm)
 	if err != nil {
@@ -185,6 +195,17 @@ func main() {
 		}
 	}
 
+	// every outbound HTTP call goes through the configured proxy
+	proxy.Install()
+	settings, err := db.LoadSettings()
+	if err != nil {
+		panic(fmt.Sprintf("loading settings: %s", err))
+	}
+	err = proxy.Set(settings.Proxy())
+	if err != nil {
+		panic(fmt.Sprintf("setting proxy: %s", err))
+	}
+
 	extractors := []gapp.Extractor{}
 	searchScraper, err := extractor.NewScraper(htmlSearchConfig, detailsScrapeConfig)
 	if err != nil {
@@ -203,11 +224,29 @@ func main() {
 	b := bus.New()
 	bus.Register(b, createDialogListener(w))
 
-	openSubtitlesClientFactory := func(usr, pwd string) gapp.SubtitlesClient {
-		return opensubtitles.New(usr, pwd)
+	sec := secrets.NewSecrets()
+	subtitleProviders := []gapp.SubtitleProvider{
+		localsubs.NewProvider(func() ([]string, error) {
+			settings, err := db.LoadSettings()
+			if err != nil {
+				return nil, err
+			}
+			return append([]string{defSubTitlesDir}, settings.SubtitleSources().Folders...), nil
+		}),
+		opensubtitles.NewProvider(func() (string, string, error) {
+			settings, err := db.LoadSettings()
+			if err != nil {
+				return "", "", err
+			}
+			secret, err := sec.GetOpenSubtitles()
+			if err != nil {
+				return "", "", err
+			}
+			return settings.OpenSubtitles.Username, secret.Password, nil
+		}),
+		podnapisi.NewProvider(),
 	}
 
-	sec := secrets.NewSecrets()
 	appSvc := services.NewApp(db, sec, cacheDir, mediaDir, torrentsDir, subtitlesDir)
 	searchSvc, err := services.NewSearch(db, extractors, torrentsDir)
 	if err != nil {
@@ -215,14 +254,20 @@ func main() {
 	}
 	downloadSvc := services.NewDownload(
 		db,
-		player.Player{DefaultSubtitlesDir: defSubTitlesDir},
-		torrentClientFactory(db, mediaDir, torrentsDir),
-		openSubtitlesClientFactory,
+		player.Player{},
+		torrentClientFactory(db, &blocklist.Loader{}, eventbus.New(b), mediaDir, torrentsDir),
 		torrentsDir,
 		subtitlesDir,
-		sec,
+		subtitleProviders,
 	)
 
+	bandwidthSvc := services.NewBandwidth(db, downloadSvc.SetLimits)
+	go bandwidthSvc.Run(context.Background())
+	collectorSvc := services.NewCollector(db, downloadSvc)
+	go collectorSvc.Run(context.Background(), time.Second)
+	seedingSvc := services.NewSeeding(db, downloadSvc, collectorSvc)
+	go seedingSvc.Run(context.Background(), 10*time.Second)
+
 	cachedDir := filepath.Join(cacheDir, "cached")
 	cacheSvc := services.NewCache(cachedDir, mediaDir, torrentsDir, subtitlesDir)
 
@@ -236,6 +281,10 @@ func main() {
 		ShowNotification: bind.NewNotifier[gapp.Notify](),
 	}
 	shared.ShowNotification.Listen(showNotification(notification))
+	bus.Register(b, showNotification(notification))
+
+	killSwitchSvc := services.NewKillSwitch(db, downloadSvc, eventbus.New(b))
+	go killSwitchSvc.Run(context.Background(), 5*time.Second)
 
 	anchor := mycontainer.NewAnchor()
 	anchor.Add(content, mycontainer.FillConstraint)
@@ -251,6 +300,8 @@ func main() {
 				searchSvc,
 				cacheSvc,
 				downloadSvc,
+				bandwidthSvc,
+				seedingSvc,
 				cacheDir,
 				t,
 			)
@@ -260,6 +311,11 @@ func main() {
 				VM:          vm,
 				Constructor: view.App,
 			}
+		case gapp.PreviewParams:
+			return &View[*viewmodel.Preview]{
+				VM:          viewmodel.NewPreview(shared, downloadSvc, t),
+				Constructor: view.Preview,
+			}
 		case gapp.DownloadListParams:
 			return &View[*viewmodel.DownloadList]{
 				VM:          viewmodel.NewDownloadList(shared, downloadSvc, t),
@@ -267,7 +323,7 @@ func main() {
 			}
 		case gapp.DownloadParams:
 			return &View[*viewmodel.Download]{
-				VM:          viewmodel.NewDownload(shared, downloadSvc, t),
+				VM:          viewmodel.NewDownload(shared, downloadSvc, bandwidthSvc, seedingSvc, collectorSvc, t),
 				Constructor: view.Download,
 			}
 		}
@@ -283,25 +339,51 @@ func main() {
 
 	w.SetContent(anchor.Container)
 	w.ShowAndRun()
+
+	downloadSvc.CloseSubtitleProviders()
+
+	err = collectorSvc.Save()
+	if err != nil {
+		slog.Error("Failed to save transfer totals", "error", err)
+	}
 }
 
-func torrentClientFactory(db *repository.DB, mediaDir, torrentFileDir string) func(torrentPath string) (gapp.TorrentClient, error) {
+func torrentClientFactory(
+	db *repository.DB,
+	blocklists *blocklist.Loader,
+	events gapp.EventBus,
+	mediaDir, torrentFileDir string,
+) func(torrentPath string) (gapp.TorrentClient, error) {
 	return func(link string) (gapp.TorrentClient, error) {
 		settings, err := db.LoadSettings()
 		if err != nil {
 			return nil, faults.Errorf("torrent client factory loading settings: %w", err)
 		}
+		// without the bound network no torrent is started, so that the traffic never leaks
+		bindIP, err := netbind.Resolve(settings.BindInterface())
+		if err != nil {
+			return nil, faults.Errorf("resolving bound network: %w", err)
+		}
+		ipBlocklist, err := blocklists.Get(context.Background(), settings.Blocklists())
+		if err != nil {
+			// an unreachable blocklist should not prevent streaming
+			slog.Warn("Failed to load IP blocklists", "error", err)
+			events.Publish(gapp.NewNotifyWarn("Failed to load the IP blocklists, peers are not filtered: %s", err))
+		}
 		tCli, err := tor.NewTorrentClient(
 			tor.ClientConfig{
 				TorrentPort:          settings.TorrentPort(),
 				MaxConnections:       settings.MaxConnections(),
 				Seed:                 settings.Seed(),
-				SeedAfterComplete:    settings.SeedAfterComplete(),
 				TCP:                  settings.TCP(),
 				DownloadAheadPercent: 1,
 				FirstDownloadPercent: 0.25,
 				ValidMediaExtensions: viewmodel.MediaExtensions,
 				UploadRate:           settings.UploadRate(),
+				DownloadRate:         settings.DownloadRate(),
+				IPBlocklist:          ipBlocklist,
+				Proxy:                settings.Proxy(),
+				BindIP:               bindIP,
 			},
 			torrentFileDir,
 			mediaDir,